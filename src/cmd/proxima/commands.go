@@ -0,0 +1,672 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"proxima/internal/adapters/output"
+	"proxima/internal/adapters/proxmox"
+	"proxima/internal/core/domain"
+	"proxima/internal/core/ports"
+
+	"github.com/spf13/cobra"
+)
+
+// waitConditions are the values accepted by wait --for
+var waitConditions = []string{"running", "stopped", "paused", "suspended", "agent", "ip", "ssh"}
+
+func newRootCmd() *cobra.Command {
+	rootCmd := &cobra.Command{
+		Use:   "proxima",
+		Short: "Tool for Proxmox VM management",
+		Long: `Proxima is a CLI tool to create, manage and execute commands on Proxmox VMs via SSH.
+
+The target is either a Proxmox host, managed over SSH, or a YAML config file,
+managed through the Proxmox API. It is given as first argument or with --target.
+Without a target, the context selected with --context, PROXIMA_CONTEXT or
+'proxima context use' is used; see 'proxima help context'.`,
+		Example: `  proxima 192.168.1.100 list
+  proxima --context prod list
+  proxima 192.168.1.100 start 'web-*' --all --wait
+  proxima config.yaml create --name vm1
+  proxima --target config.yaml ip web-server -o json`,
+		SilenceErrors:     true,
+		SilenceUsage:      true,
+		DisableAutoGenTag: true,
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			p, err := output.NewPresenter(outputFlag, redactor.Writer(os.Stdout))
+			if err != nil {
+				return err
+			}
+			presenter = p
+
+			// Keep stdout for structured output only; progress messages go to stderr
+			if !presenter.IsText() {
+				os.Stdout = os.Stderr
+			}
+			return nil
+		},
+		PersistentPostRun: func(cmd *cobra.Command, args []string) {
+			printDryRun()
+		},
+	}
+
+	flags := rootCmd.PersistentFlags()
+	flags.StringVar(&targetFlag, "target", "", "Proxmox host or YAML config file")
+	flags.StringVar(&contextFlag, "context", "", "Context of the user config to use (default: $PROXIMA_CONTEXT, then the current context)")
+	flags.BoolVar(&loginFlag, "login", false, "Interactive login for host authentication")
+	flags.StringVarP(&outputFlag, "output", "o", "table", "Output format: table, wide, json, yaml, csv or template=<go template>")
+	flags.DurationVar(&taskTimeoutFlag, "task-timeout", proxmox.DefaultTaskTimeout, "Maximum time a Proxmox task, such as a clone, may run (API mode)")
+
+	rootCmd.RegisterFlagCompletionFunc("target", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return []string{"yaml", "yml"}, cobra.ShellCompDirectiveFilterFileExt
+	})
+	rootCmd.RegisterFlagCompletionFunc("context", completeContexts)
+	rootCmd.RegisterFlagCompletionFunc("output", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return []string{"table", "wide", "json", "yaml", "csv", "template="}, cobra.ShellCompDirectiveNoFileComp
+	})
+
+	rootCmd.AddCommand(
+		newListCmd(),
+		newTemplatesCmd(),
+		newStartCmd(),
+		withParallel(withDryRun(newSelectorCmd("stop", "Stop VMs immediately", func(vmService ports.VMService, vm *domain.VM) error {
+			return stopVM(vmService, vm.ID)
+		}))),
+		withParallel(withDryRun(newSelectorCmd("shutdown", "Shutdown VMs gracefully", func(vmService ports.VMService, vm *domain.VM) error {
+			return shutdownVM(vmService, vm.ID)
+		}))),
+		newPowerCmd("reboot", "Reboot VMs through ACPI", "Rebooting", "rebooted", ports.VMService.RebootVM),
+		newPowerCmd("reset", "Reset VMs immediately, like a hardware reset button", "Resetting", "reset", ports.VMService.ResetVM),
+		newPowerCmd("suspend", "Pause VMs in memory", "Suspending", "suspended", ports.VMService.SuspendVM),
+		newPowerCmd("resume", "Resume paused or hibernated VMs", "Resuming", "resumed", ports.VMService.ResumeVM),
+		newPowerCmd("hibernate", "Save the state of VMs to disk and stop them", "Hibernating", "hibernated", ports.VMService.HibernateVM),
+		newDeleteCmd(),
+		newCreateCmd(),
+		newApplyCmd(),
+		newScaleCmd(),
+		newValidateCmd(),
+		newSchemaCmd(),
+		newConfigCmd(),
+		newCopyKeyCmd(),
+		newTokenCmd(),
+		newContextCmd(),
+		newWaitCmd(),
+		newExecCmd(),
+		newSelectorCmd("ip", "Show the network interfaces and addresses of VMs", func(vmService ports.VMService, vm *domain.VM) error {
+			return showIP(vmService, vm.ID)
+		}),
+		newManCmd(),
+		newSelectorsTopic(),
+	)
+
+	return rootCmd
+}
+
+// selectorHelp describes the <vm> arguments of selector commands.
+const selectorHelp = "<vm> is a VMID, a VMID range (100-120), a name, a pattern (web-*) or tag:name;\nseveral can be given. See 'proxima help selectors'."
+
+// newSelectorCmd builds a command running action on every VM designated by
+// its selector arguments.
+func newSelectorCmd(name, short string, action func(vmService ports.VMService, vm *domain.VM) error) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:               name + " <vm>...",
+		Short:             short,
+		Long:              short + ".\n\n" + selectorHelp,
+		Args:              selectorArgs,
+		ValidArgsFunction: completeVMs,
+		Run: func(cmd *cobra.Command, args []string) {
+			vmService, err := targetVMService()
+			if err != nil {
+				fail(err)
+				return
+			}
+			forEachVM(vmService, cmd, args, func(vm *domain.VM) error {
+				return action(vmService, vm)
+			})
+		},
+	}
+	addAllFlag(cmd)
+	return cmd
+}
+
+func addAllFlag(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&allFlag, "all", false, "Act on every VM matched by a pattern or tag, or on every VM when no <vm> is given")
+}
+
+// newPowerCmd builds a selector command running a power action, reported as
+// "<doing> VM n..." then "VM n <done> successfully!".
+func newPowerCmd(name, short, doing, done string, action func(vmService ports.VMService, id int) error) *cobra.Command {
+	return withParallel(withDryRun(newSelectorCmd(name, short, func(vmService ports.VMService, vm *domain.VM) error {
+		fmt.Printf("%s VM %d...\n", doing, vm.ID)
+		if err := action(vmService, vm.ID); err != nil {
+			return err
+		}
+		fmt.Printf("VM %d %s successfully!\n", vm.ID, done)
+		return nil
+	})))
+}
+
+// withDryRun adds --dry-run to a mutating command.
+func withDryRun(cmd *cobra.Command) *cobra.Command {
+	cmd.Flags().BoolVar(&dryRunFlag, "dry-run", false, "Resolve and validate, then list the API calls or qm commands that would run instead of running them")
+	return cmd
+}
+
+// withParallel adds --parallel to a command acting on several VMs at once.
+func withParallel(cmd *cobra.Command) *cobra.Command {
+	cmd.Flags().IntVar(&parallelFlag, "parallel", 4, "Number of VMs processed at the same time")
+	return cmd
+}
+
+// workers returns the number of VMs cmd processes at the same time. Dry runs
+// go one VM at a time so the recorded operations keep their order.
+func workers(cmd *cobra.Command) int {
+	if cmd.Flags().Lookup("parallel") == nil || dryRunFlag {
+		return 1
+	}
+	return parallelFlag
+}
+
+// selectorArgs requires at least one VM selector, unless --all selects every VM.
+func selectorArgs(cmd *cobra.Command, args []string) error {
+	if len(args) == 0 && !allFlag {
+		return domain.Errorf(domain.ErrorKindValidation, "%s requires a VM (VMID, range, name, pattern or tag:name) or --all", cmd.CommandPath())
+	}
+	return nil
+}
+
+func newListCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "list",
+		Short: "List all VMs",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			vmService, err := targetVMService()
+			if err != nil {
+				fail(err)
+				return
+			}
+			if err := listVMs(vmService); err != nil {
+				fail(err)
+			}
+		},
+	}
+}
+
+func newTemplatesCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "templates",
+		Short: "List the templates of the cluster and the aliases referring to them",
+		Long: `List the Proxmox templates VMs can be cloned from, with the aliases of the
+config file referring to them by VMID or name. Aliases referring to no
+template are listed last, as not found.`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			vmService, err := targetVMService()
+			if err != nil {
+				fail(err)
+				return
+			}
+			if err := listTemplates(vmService); err != nil {
+				fail(err)
+			}
+		},
+	}
+}
+
+func newStartCmd() *cobra.Command {
+	cmd := newSelectorCmd("start", "Start VMs", nil)
+	cmd.Long = `Start VMs, several at a time (--parallel).
+
+VMs defined in the config file start in waves: lower start_order values first,
+and every VM after the selected VMs listed in its depends_on. Each wave waits
+for the previous one to be running, or reachable over SSH with --wait, and
+VMs after a wave that failed are skipped.
+
+` + selectorHelp
+	cmd.Run = func(cmd *cobra.Command, args []string) {
+		vmService, err := targetVMService()
+		if err != nil {
+			fail(err)
+			return
+		}
+		vms, err := vmService.ResolveVMs(args, allFlag)
+		if err != nil {
+			fail(err)
+			return
+		}
+		report(runInWaves(vmService, cmd, withStartOrder(vmService, vms), func(vm *domain.VM, last bool) error {
+			if err := startVM(vmService, vm.ID); err != nil {
+				return err
+			}
+			return settle(vmService, vm, last)
+		}))
+	}
+	cmd.Flags().BoolVar(&waitFlag, "wait", false, "Wait until the VM accepts SSH connections")
+	cmd.Flags().DurationVar(&timeoutFlag, "timeout", 5*time.Minute, "Maximum time to wait")
+	return withParallel(withDryRun(cmd))
+}
+
+// runInWaves runs action on VMs wave by wave, following their start_order and
+// depends_on (see domain.StartWaves); the VMs of a wave run in parallel. last
+// tells action whether no wave follows. Once a VM fails, later waves are skipped.
+func runInWaves(vmService ports.VMService, cmd *cobra.Command, vms []*domain.VM, action func(vm *domain.VM, last bool) error) []*domain.TaskResult {
+	waves, err := domain.StartWaves(vms)
+	if err != nil {
+		fail(err)
+		return nil
+	}
+
+	var results []*domain.TaskResult
+	failed := false
+	for i, wave := range waves {
+		if failed {
+			for _, vm := range wave {
+				result := domain.NewTaskResult(vm, cmd.Name())
+				result.Skip("a VM it comes after failed")
+				results = append(results, result)
+			}
+			continue
+		}
+
+		last := i == len(waves)-1
+		waveResults := vmService.RunParallel(wave, cmd.Name(), workers(cmd), func(vm *domain.VM) error {
+			return action(vm, last)
+		})
+		for _, result := range waveResults {
+			failed = failed || result.Err != nil
+		}
+		results = append(results, waveResults...)
+	}
+	return results
+}
+
+// settle holds a started VM's wave until the VMs of the next wave can rely on
+// it: the VM must be running (reachable over SSH with --wait, which the start
+// itself takes care of), then its startup_delay must have elapsed.
+func settle(vmService ports.VMService, vm *domain.VM, last bool) error {
+	if last {
+		return nil
+	}
+	if !waitFlag {
+		if err := waitVM(vmService, vm.ID, "running"); err != nil {
+			return err
+		}
+	}
+	if vm.StartupDelay > 0 && !dryRunFlag {
+		fmt.Printf("Waiting %s after starting VM %s (startup_delay)...\n", vm.StartupDelay, vm.Label())
+		time.Sleep(vm.StartupDelay)
+	}
+	return nil
+}
+
+func newDeleteCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "delete <vm>...",
+		Short: "Delete VMs",
+		Long: `Stop and destroy VMs after showing them and asking for confirmation.
+
+Running VMs are stopped immediately, or shut down first with --graceful and
+stopped only if they are still running after --shutdown-timeout. Unless
+--purge=false is given, deleted VMs are also removed from backup jobs, HA and
+replication, and the disks they no longer reference are destroyed.
+
+VMs with Proxmox protection enabled, or marked "protected: true" in the config
+file, are never deleted. Deleting more than ` + strconv.Itoa(maxBulkDelete) + ` VMs at once requires --force.
+
+` + selectorHelp,
+		Args:              selectorArgs,
+		ValidArgsFunction: completeVMs,
+		Run: func(cmd *cobra.Command, args []string) {
+			vmService, err := targetVMService()
+			if err != nil {
+				fail(err)
+				return
+			}
+
+			vms, err := vmService.ResolveVMs(args, allFlag)
+			if err != nil {
+				fail(err)
+				return
+			}
+			protected, err := configProtected(configFilePath())
+			if err != nil {
+				fail(err)
+				return
+			}
+			if vms, err = confirmDelete(vmService, vms, protected); err != nil {
+				fail(err)
+				return
+			}
+
+			runOnVMs(vmService, cmd, vms, func(vm *domain.VM) error {
+				if protected.protects(vm) {
+					return domain.Errorf(domain.ErrorKindConflict, "VM %s is protected in %s", vm.Label(), configFilePath())
+				}
+				return deleteVM(vmService, vm.ID)
+			})
+		},
+	}
+	addAllFlag(cmd)
+	cmd.Flags().BoolVarP(&yesFlag, "yes", "y", false, "Do not ask for confirmation")
+	cmd.Flags().BoolVar(&forceFlag, "force", false, fmt.Sprintf("Allow deleting more than %d VMs at once", maxBulkDelete))
+	cmd.Flags().BoolVar(&gracefulFlag, "graceful", false, "Shut running VMs down gracefully before deleting them")
+	cmd.Flags().DurationVar(&shutdownTimeoutFlag, "shutdown-timeout", domain.DefaultDeleteOptions().ShutdownTimeout, "Time to wait for a graceful shutdown before forcing a stop")
+	cmd.Flags().BoolVar(&purgeFlag, "purge", domain.DefaultDeleteOptions().Purge, "Also remove the VMs from backup jobs, HA and replication, and destroy unreferenced disks")
+	return withParallel(withDryRun(cmd))
+}
+
+func newCreateCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "create --name <name>",
+		Short: "Create a VM from config",
+		Long: `Create a VM defined in the config file: the target itself in config file mode,
+config.yaml in the current directory in host mode.`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			vmService, err := targetVMService()
+			if err != nil {
+				fail(err)
+				return
+			}
+			if err := createVM(vmService, configFilePath(), vmNameFlag); err != nil {
+				fail(err)
+			}
+		},
+	}
+	cmd.Flags().StringVar(&vmNameFlag, "name", "", "Name of the VM in the config file")
+	cmd.Flags().BoolVar(&waitFlag, "wait", false, "Wait until an auto-started VM accepts SSH connections")
+	cmd.Flags().DurationVar(&timeoutFlag, "timeout", 5*time.Minute, "Maximum time to wait")
+	cmd.MarkFlagRequired("name")
+	cmd.RegisterFlagCompletionFunc("name", completeConfigVMNames)
+	return withDryRun(cmd)
+}
+
+func newApplyCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "apply",
+		Short: "Create the VMs of the config file that do not exist yet",
+		Long: `Create every VM of the config file that does not exist yet and leave the
+existing ones untouched: the target itself in config file mode, config.yaml in
+the current directory in host mode.
+
+The instances of a VM with a count that are beyond it, such as web-09 once web
+is scaled down to 8, are shut down and deleted after the same confirmation as
+delete (--yes, --force).
+
+VMs are created in waves following start_order and depends_on, several at a
+time (--parallel). Before the next wave, auto-started VMs must be running, or
+reachable over SSH with --wait, and their startup_delay must have elapsed.
+
+On a terminal, the phase of each VM (cloning, configuring, resizing, starting,
+provisioning) is shown live; otherwise a line is printed at each phase change.
+A summary table with one row per VM ends the run.`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			vmService, err := targetVMService()
+			if err != nil {
+				fail(err)
+				return
+			}
+			if err := applyConfig(vmService, cmd, configFilePath()); err != nil {
+				fail(err)
+			}
+		},
+	}
+	cmd.Flags().BoolVar(&waitFlag, "wait", false, "Wait until auto-started VMs accept SSH connections before creating the VMs depending on them")
+	cmd.Flags().DurationVar(&timeoutFlag, "timeout", 5*time.Minute, "Maximum time to wait for each VM")
+	cmd.Flags().BoolVarP(&yesFlag, "yes", "y", false, "Do not ask for confirmation before removing instances")
+	cmd.Flags().BoolVar(&forceFlag, "force", false, fmt.Sprintf("Allow removing more than %d instances at once", maxBulkDelete))
+	return withParallel(withDryRun(cmd))
+}
+
+func newScaleCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "scale <group> <count>",
+		Short: "Change the number of instances of a VM group",
+		Long: `Set the count of a VM group in the config file that defines it; apply then
+creates the missing instances or removes those beyond the count. A group is a
+VM with a count, named after its name without {{index}}: web-{{index}} is the
+group web.`,
+		Example: `  proxima config.yaml scale web 12
+  proxima config.yaml apply`,
+		Args:              cobra.ExactArgs(2),
+		ValidArgsFunction: completeGroups,
+		Run: func(cmd *cobra.Command, args []string) {
+			count, err := strconv.Atoi(args[1])
+			if err != nil || count < 0 {
+				fail(domain.Errorf(domain.ErrorKindValidation, "invalid count '%s'", args[1]))
+				return
+			}
+			if err := scaleGroup(configFilePath(), args[0], count); err != nil {
+				fail(err)
+			}
+		},
+	}
+}
+
+func newValidateCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "validate",
+		Short: "Check the config file without contacting the cluster",
+		Long: `Check the config file, or directory, with its includes: unknown keys, missing
+or malformed values, unknown network models, VLANs out of range, duplicate VM
+names and VMIDs, and dependencies. Every problem is reported with its
+file:line:column, and the exit code is 2 if there is any, for CI.`,
+		Example: `  proxima config.yaml validate
+  proxima ./infra/ validate`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := validateConfig(configFilePath()); err != nil {
+				fail(err)
+			}
+		},
+	}
+}
+
+func newSchemaCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "schema",
+		Short: "Print the JSON Schema of config files",
+		Long: `Print the JSON Schema of config files, for editors to complete and check
+them. It is generated from the config structures; validate checks the same
+rules and more.`,
+		Example: `  proxima schema > proxima.schema.json`,
+		Args:    cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := printSchema(); err != nil {
+				fail(err)
+			}
+		},
+	}
+}
+
+func newConfigCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "config",
+		Short: "Inspect the config file",
+	}
+	cmd.AddCommand(newConfigShowCmd())
+	return cmd
+}
+
+func newConfigShowCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "show <name>",
+		Short: "Show the effective settings of a VM of the config and where they come from",
+		Long: `Show the settings of a VM of the config once merged from the global ssh
+section, defaults, its template, its entry of vms and, for an instance of a VM
+with count, its instance settings. Each setting is shown with the level it
+comes from and its file:line. Passwords are redacted.`,
+		Example: `  proxima config.yaml config show web-01
+  proxima config.yaml config show web-01 -o json`,
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: completeConfigVMNames,
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := showConfig(configFilePath(), args[0]); err != nil {
+				fail(err)
+			}
+		},
+	}
+}
+
+func newTokenCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "token",
+		Short: "Manage Proxmox API tokens",
+	}
+	cmd.AddCommand(newTokenCreateCmd())
+	return cmd
+}
+
+func newTokenCreateCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "create [name]",
+		Short: "Create an API token and store it in the config file",
+		Long: `Create an API token, named proxima unless a name is given, with the
+credentials of the config file, then make the config file use it.
+
+The token is privilege-separated: it does not inherit the permissions of its
+user, and is granted --role on / instead. Its secret is written to
+--secret-file, relative to the config file and readable by its owner only, and
+the proxmox section of the config file gets token_id and token_secret_file.`,
+		Example: `  proxima config.yaml token create
+  proxima config.yaml token create ci --user automation@pve --role PVEVMUser`,
+		Args: cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			name := "proxima"
+			if len(args) == 1 {
+				name = args[0]
+			}
+			if err := createToken(configFilePath(), name); err != nil {
+				fail(err)
+			}
+		},
+	}
+	cmd.Flags().StringVar(&userFlag, "user", "", "User owning the token (default: proxmox user of the config file)")
+	cmd.Flags().StringVar(&roleFlag, "role", "PVEVMAdmin", "Role granted to the token on /")
+	cmd.Flags().StringVar(&secretFileFlag, "secret-file", ".proxima-token", "File receiving the token secret")
+	cmd.Flags().BoolVar(&privSepFlag, "privsep", true, "Separate the token privileges from those of its user (--privsep=false inherits them)")
+	return cmd
+}
+
+func newCopyKeyCmd() *cobra.Command {
+	cmd := newSelectorCmd("copy-key", "Install SSH public keys on VMs, skipping keys already present", func(vmService ports.VMService, vm *domain.VM) error {
+		sshConfig := domain.SSHConfig{}
+		if isConfigFile(targetFlag) {
+			var err error
+			if sshConfig, err = vmSSHConfig(targetFlag, vm); err != nil {
+				return err
+			}
+		}
+		return copyKey(vmService, vm.ID, sshConfig)
+	})
+	cmd.Flags().StringVar(&userFlag, "user", "", "Target user on the VM (default: SSH user)")
+	cmd.Flags().StringArrayVar(&keyFlags, "key", nil, "Public key file to install or remove (repeatable; installing defaults to ~/.ssh/*.pub)")
+	cmd.Flags().BoolVar(&removeFlag, "remove", false, "Remove the keys given with --key or configured for the VM instead of installing them")
+	return cmd
+}
+
+func newWaitCmd() *cobra.Command {
+	cmd := newSelectorCmd("wait", "Wait until VMs reach the given state", func(vmService ports.VMService, vm *domain.VM) error {
+		return waitVM(vmService, vm.ID, waitForFlag)
+	})
+	cmd.Flags().StringVar(&waitForFlag, "for", "ssh", "Condition to wait for: running, stopped, paused, suspended, agent, ip or ssh")
+	cmd.Flags().DurationVar(&timeoutFlag, "timeout", 5*time.Minute, "Maximum time to wait")
+	cmd.RegisterFlagCompletionFunc("for", cobra.FixedCompletions(waitConditions, cobra.ShellCompDirectiveNoFileComp))
+	return cmd
+}
+
+func newExecCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "exec <vm>... -- <command> [args...]",
+		Short: "Run a command on VMs over SSH",
+		Long: `Run a command on VMs over SSH, several at a time (--parallel). The output of
+each command is printed as it completes, followed by a table of the commands
+with their status and duration. With -o, the commands are rendered with their
+output instead.
+
+` + selectorHelp,
+		Example: `  proxima config.yaml exec web-01 -- uptime
+  proxima config.yaml exec 'web-*' --all -o json -- systemctl is-active nginx`,
+		Args:              execArgs,
+		ValidArgsFunction: completeVMs,
+		Run: func(cmd *cobra.Command, args []string) {
+			dash := cmd.ArgsLenAtDash()
+			vmService, err := targetVMService()
+			if err != nil {
+				fail(err)
+				return
+			}
+			vms, err := vmService.ResolveVMs(args[:dash], allFlag)
+			if err != nil {
+				fail(err)
+				return
+			}
+			execCommand(vmService, cmd, vms, args[dash], args[dash+1:])
+		},
+	}
+	addAllFlag(cmd)
+	return withParallel(cmd)
+}
+
+// execArgs requires VM selectors, or --all, then -- and a command.
+func execArgs(cmd *cobra.Command, args []string) error {
+	dash := cmd.ArgsLenAtDash()
+	if dash < 0 || dash == len(args) {
+		return domain.Errorf(domain.ErrorKindValidation, "%s requires a command after --", cmd.CommandPath())
+	}
+	return selectorArgs(cmd, args[:dash])
+}
+
+// newSelectorsTopic is the "proxima help selectors" topic.
+func newSelectorsTopic() *cobra.Command {
+	return &cobra.Command{
+		Use:   "selectors",
+		Short: "How to designate VMs",
+		Long: `Commands acting on VMs take a selector:
+
+  100         VMID
+  100-120     VMID range, covering the existing VMs in it
+  web-server  Exact VM name
+  web-*       Name pattern (glob)
+  tag:prod    VMs carrying a tag
+
+Several selectors can be given; each VM is acted on once. Patterns and tags
+matching several VMs require --all, and --all without a selector designates
+every VM. Templates are only designated by their VMID or exact name.`,
+	}
+}
+
+// forEachVM resolves the VM selectors (VMID, range, name, glob or tag:name)
+// and runs action on every VM they designate.
+func forEachVM(vmService ports.VMService, cmd *cobra.Command, selectors []string, action func(vm *domain.VM) error) {
+	vms, err := vmService.ResolveVMs(selectors, allFlag)
+	if err != nil {
+		fail(err)
+		return
+	}
+	runOnVMs(vmService, cmd, vms, action)
+}
+
+// runOnVMs runs action on every VM, as many at a time as cmd allows, and
+// reports the result of each.
+func runOnVMs(vmService ports.VMService, cmd *cobra.Command, vms []*domain.VM, action func(vm *domain.VM) error) {
+	report(vmService.RunParallel(vms, cmd.Name(), workers(cmd), action))
+}
+
+// report prints the failures and the per-VM results of a command.
+func report(results []*domain.TaskResult) {
+	for _, result := range results {
+		if result.Err != nil {
+			fail(result.Err)
+		}
+	}
+
+	if err := presenter.Results(results); err != nil {
+		fail(err)
+	}
+}
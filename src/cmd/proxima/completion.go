@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"proxima/internal/adapters/config"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/cobra/doc"
+)
+
+// completeVMs completes VM selectors with the VMIDs, names and tags found on
+// the target. Nothing is proposed when the target cannot be queried.
+func completeVMs(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	// --login would prompt for credentials in the middle of a completion
+	if loginFlag {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+
+	given := make(map[string]bool)
+	for _, arg := range args {
+		given[arg] = true
+	}
+
+	// Adapters report progress on stdout, which carries the completions
+	stdout := os.Stdout
+	os.Stdout = os.Stderr
+	defer func() { os.Stdout = stdout }()
+
+	vmService, err := targetVMService()
+	if err != nil {
+		cobra.CompDebugln(err.Error(), true)
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	vms, err := vmService.ListVMs()
+	if err != nil {
+		cobra.CompDebugln(err.Error(), true)
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+
+	var completions []string
+	add := func(value, description string) {
+		if strings.HasPrefix(value, toComplete) && !given[value] {
+			completions = append(completions, value+"\t"+description)
+		}
+	}
+
+	tags := make(map[string]bool)
+	for _, vm := range vms {
+		add(strconv.Itoa(vm.ID), vm.Name)
+		if vm.Name != "" {
+			add(vm.Name, fmt.Sprintf("VMID %d", vm.ID))
+		}
+		for _, tag := range vm.Tags {
+			if !tags[tag] {
+				tags[tag] = true
+				add("tag:"+tag, "VMs tagged "+tag)
+			}
+		}
+	}
+	return completions, cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeConfigVMNames completes create --name and config show with the VMs
+// of the config file.
+func completeConfigVMNames(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	configAdapter := config.NewConfigAdapter()
+	if err := configAdapter.LoadConfig(configFilePath()); err != nil {
+		cobra.CompDebugln(err.Error(), true)
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+
+	vms, err := configAdapter.GetAllVMConfigs()
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+
+	var names []string
+	for _, vm := range vms {
+		if strings.HasPrefix(vm.Name, toComplete) {
+			names = append(names, vm.Name)
+		}
+	}
+	return names, cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeGroups completes scale with the VM groups of the config file.
+func completeGroups(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	configAdapter := config.NewConfigAdapter()
+	if err := configAdapter.LoadConfig(configFilePath()); err != nil {
+		cobra.CompDebugln(err.Error(), true)
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+
+	var names []string
+	for _, group := range configAdapter.Groups() {
+		if strings.HasPrefix(group.Name, toComplete) {
+			names = append(names, fmt.Sprintf("%s\t%d instance(s)", group.Name, group.Count))
+		}
+	}
+	return names, cobra.ShellCompDirectiveNoFileComp
+}
+
+func newManCmd() *cobra.Command {
+	var dir string
+
+	cmd := &cobra.Command{
+		Use:   "man",
+		Short: "Generate man pages",
+		Long:  "Generate one man page per command (proxima.1, proxima-start.1, ...) in the given directory.",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				fail(fmt.Errorf("failed to create %s: %w", dir, err))
+				return
+			}
+
+			header := &doc.GenManHeader{Title: "PROXIMA", Section: "1", Source: "Proxima"}
+			if err := doc.GenManTree(cmd.Root(), header, dir); err != nil {
+				fail(fmt.Errorf("failed to generate man pages: %w", err))
+				return
+			}
+			fmt.Printf("Man pages written to %s\n", dir)
+		},
+	}
+	cmd.Flags().StringVar(&dir, "dir", "man", "Directory to write the man pages to")
+	return cmd
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"proxima/internal/core/domain"
+	"proxima/internal/core/ports"
+)
+
+// maxBulkDelete is the number of VMs a single delete may remove without --force
+const maxBulkDelete = 5
+
+// confirmDelete shows the VMs about to be deleted and asks for confirmation,
+// unless --yes is given. VMs with Proxmox protection or in protected are not
+// counted. It returns the VMs with their details loaded.
+func confirmDelete(vmService ports.VMService, vms []*domain.VM, protected protectedVMs) ([]*domain.VM, error) {
+	detailed := make([]*domain.VM, 0, len(vms))
+	deletable := 0
+	for _, vm := range vms {
+		details, err := vmService.GetVM(vm.ID)
+		if err != nil {
+			return nil, err
+		}
+		detailed = append(detailed, details)
+		if !details.Protected && !protected.protects(details) {
+			deletable++
+		}
+	}
+
+	if deletable > maxBulkDelete && !forceFlag {
+		return nil, domain.Errorf(domain.ErrorKindValidation, "refusing to delete %d VMs at once (limit %d); pass --force to proceed", deletable, maxBulkDelete)
+	}
+	if yesFlag || dryRunFlag || deletable == 0 {
+		return detailed, nil
+	}
+	if !isTerminal(os.Stdin) {
+		return nil, domain.Errorf(domain.ErrorKindValidation, "refusing to delete without confirmation: stdin is not a terminal; pass --yes")
+	}
+
+	fmt.Fprintf(os.Stderr, "About to delete %d VM(s):\n", deletable)
+	for _, vm := range detailed {
+		note := ""
+		if vm.Protected || protected.protects(vm) {
+			note = " - protected, will be skipped"
+		}
+		fmt.Fprintf(os.Stderr, "  %-6d %-20s %s%s\n", vm.ID, vm.Name, vm.Status, note)
+	}
+
+	if !askYesNo("Continue?") {
+		return nil, fmt.Errorf("aborted, no VM deleted")
+	}
+	return detailed, nil
+}
+
+// askYesNo prompts on stderr and reads the answer from stdin; only y/yes accepts.
+func askYesNo(question string) bool {
+	fmt.Fprintf(os.Stderr, "%s [y/N] ", question)
+
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true
+	}
+	return false
+}
+
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"proxima/internal/adapters/config"
+	"proxima/internal/core/domain"
+	"proxima/internal/core/ports"
+
+	"github.com/spf13/cobra"
+)
+
+// userContexts is the user config, loaded on first use
+var userContexts *config.Contexts
+
+func loadContexts() (*config.Contexts, error) {
+	if userContexts == nil {
+		contexts, err := config.LoadContexts(config.UserConfigPath())
+		if err != nil {
+			return nil, err
+		}
+		userContexts = contexts
+	}
+	return userContexts, nil
+}
+
+// selectedContext returns the context named by --context, PROXIMA_CONTEXT or
+// the current context of the user config, in that order, or nil if none is.
+func selectedContext() (string, *config.Context, error) {
+	contexts, err := loadContexts()
+	if err != nil {
+		return "", nil, err
+	}
+	name := contexts.Selected(contextFlag)
+	if name == "" {
+		return "", nil, nil
+	}
+	return getContext(contexts, name)
+}
+
+// hostContext returns the context giving the SSH settings of a host target:
+// the one named by --context or PROXIMA_CONTEXT, else the one whose proxmox
+// host is host. The current context is not used, since it may be another
+// cluster.
+func hostContext(host string) (*config.Context, error) {
+	contexts, err := loadContexts()
+	if err != nil {
+		return nil, err
+	}
+
+	name := contextFlag
+	if name == "" {
+		name = os.Getenv(config.ContextEnv)
+	}
+	if name == "" {
+		var ok bool
+		if name, ok = contexts.ByHost(host); !ok {
+			return nil, nil
+		}
+	}
+	_, context, err := getContext(contexts, name)
+	return context, err
+}
+
+func getContext(contexts *config.Contexts, name string) (string, *config.Context, error) {
+	context, err := contexts.Get(name)
+	if err != nil {
+		return "", nil, err
+	}
+	redactor.Add(context.Secrets()...)
+	return name, context, nil
+}
+
+// hostSSHConfig returns how to log in to a Proxmox host over SSH: as root on
+// port 22 unless its context says otherwise.
+func hostSSHConfig(context *config.Context) config.SSHConfig {
+	sshConfig := config.SSHConfig{User: "root", Port: 22}
+	if context == nil {
+		return sshConfig
+	}
+	if context.SSH.User != "" {
+		sshConfig.User = context.SSH.User
+	}
+	if context.SSH.Port != 0 {
+		sshConfig.Port = context.SSH.Port
+	}
+	sshConfig.Password = context.SSH.Password
+	sshConfig.KeyPath = context.SSH.KeyPath
+	return sshConfig
+}
+
+// hostVMSSHConfig returns how to reach the VMs of a host managed over SSH: as
+// root on port 22 with the default keys, whatever the host login. The local
+// public key is installed on them unless the context sets copy_local_key to
+// false.
+func hostVMSSHConfig(context *config.Context) config.SSHConfig {
+	copyLocalKey := true
+	sshConfig := config.SSHConfig{User: "root", Port: 22, CopyLocalKey: &copyLocalKey}
+	if context != nil && context.SSH.CopyLocalKey != nil {
+		sshConfig.CopyLocalKey = context.SSH.CopyLocalKey
+	}
+	return sshConfig
+}
+
+// contextVMService builds the VM service of the selected context, when no
+// target is given: through the API if the context has API credentials, over
+// SSH to its host otherwise.
+func contextVMService() (ports.VMService, error) {
+	name, context, err := selectedContext()
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case context == nil:
+		return nil, domain.Errorf(domain.ErrorKindValidation, "no target given; pass a host or config file as first argument or with --target, or select a context with --context, %s or 'proxima context use'", config.ContextEnv)
+	case context.Proxmox.Host == "":
+		return nil, domain.Errorf(domain.ErrorKindValidation, "context %s has no proxmox host", name)
+	case context.UsesAPI():
+		return initializeServices("", "")
+	case loginFlag:
+		return initializeServicesWithLogin(context.Proxmox.Host, context)
+	default:
+		return initializeHostServices(context.Proxmox.Host, hostSSHConfig(context), hostVMSSHConfig(context))
+	}
+}
+
+// completeContexts completes context names from the user config.
+func completeContexts(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	contexts, err := loadContexts()
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	return contexts.Names(), cobra.ShellCompDirectiveNoFileComp
+}
+
+func newContextCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "context",
+		Short: "Manage the Proxmox clusters of the user config",
+		Long: `Contexts are the Proxmox clusters listed in the user config,
+` + "`$XDG_CONFIG_HOME/proxima/config.yaml`" + ` (by default ~/.config/proxima/config.yaml).
+Each has a proxmox section, as in a config file, and an ssh section giving the
+user, port and key to log in to its host.
+
+Without a target, commands act on the context given by --context, else by
+PROXIMA_CONTEXT, else on the current context set by 'proxima context use'.`,
+	}
+	cmd.AddCommand(newContextUseCmd(), newContextListCmd())
+	return cmd
+}
+
+func newContextUseCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:               "use <name>",
+		Short:             "Make a context the current one",
+		Example:           `  proxima context use prod`,
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: completeContexts,
+		Run: func(cmd *cobra.Command, args []string) {
+			contexts, err := loadContexts()
+			if err != nil {
+				fail(err)
+				return
+			}
+			if err := contexts.Use(args[0]); err != nil {
+				fail(err)
+				return
+			}
+			fmt.Printf("Switched to context %s\n", args[0])
+		},
+	}
+}
+
+func newContextListCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "list",
+		Short: "List the contexts, marking the selected one",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			contexts, err := loadContexts()
+			if err != nil {
+				fail(err)
+				return
+			}
+			if len(contexts.Contexts) == 0 {
+				fmt.Printf("No contexts defined in %s\n", config.UserConfigPath())
+				return
+			}
+
+			selected := contexts.Selected(contextFlag)
+			tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(tw, "CURRENT\tNAME\tHOST\tNODE\tMODE")
+			for _, name := range contexts.Names() {
+				context := contexts.Contexts[name]
+				current, mode := "", "ssh"
+				if name == selected {
+					current = "*"
+				}
+				if context.UsesAPI() {
+					mode = "api"
+				}
+				fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", current, name, context.Proxmox.Host, context.Proxmox.Node, mode)
+			}
+			tw.Flush()
+		},
+	}
+}
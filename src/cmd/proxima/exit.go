@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"proxima/internal/core/domain"
+)
+
+// Exit codes returned by proxima, one per error kind so automation can react
+// (e.g. retry on transport errors, abort on authentication errors).
+const (
+	exitOK         = 0
+	exitError      = 1
+	exitValidation = 2
+	exitNotFound   = 3
+	exitAuth       = 4
+	exitConflict   = 5
+	exitTimeout    = 6
+	exitTransport  = 7
+)
+
+// exitCode is the code main exits with; the first failure wins.
+var exitCode = exitOK
+
+// exitCodeFor maps an error to the process exit code for its kind.
+func exitCodeFor(err error) int {
+	switch domain.KindOf(err) {
+	case domain.ErrorKindValidation:
+		return exitValidation
+	case domain.ErrorKindNotFound:
+		return exitNotFound
+	case domain.ErrorKindAuth:
+		return exitAuth
+	case domain.ErrorKindConflict:
+		return exitConflict
+	case domain.ErrorKindTimeout:
+		return exitTimeout
+	case domain.ErrorKindTransport:
+		return exitTransport
+	}
+	return exitError
+}
+
+// fail reports err on stderr, with secrets masked, and records its exit code.
+func fail(err error) {
+	fmt.Fprintf(os.Stderr, "Error: %s\n", redactor.Redact(err.Error()))
+	if exitCode == exitOK {
+		exitCode = exitCodeFor(err)
+	}
+}
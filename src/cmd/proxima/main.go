@@ -2,283 +2,233 @@ package main
 
 import (
 	"bufio"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
 	"os"
-	"strconv"
 	"strings"
+	"time"
 
 	"proxima/internal/adapters/config"
+	"proxima/internal/adapters/dryrun"
+	"proxima/internal/adapters/output"
 	"proxima/internal/adapters/proxmox"
 	"proxima/internal/adapters/proxmox_ssh"
 	"proxima/internal/adapters/ssh"
+	"proxima/internal/adapters/state"
+	"proxima/internal/core/domain"
 	"proxima/internal/core/ports"
 	"proxima/internal/core/service"
 
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 )
 
 var (
 	// Global flags
-	loginFlag bool
+	targetFlag  string
+	contextFlag string
+	loginFlag   bool
+	outputFlag  string
+
+	taskTimeoutFlag time.Duration
 
 	// Command flags
 	vmNameFlag  string
-	commandFlag string
+	userFlag    string
+	keyFlags    []string
+	removeFlag  bool
+	waitFlag    bool
+	waitForFlag string
+	timeoutFlag time.Duration
+	allFlag     bool
+	yesFlag     bool
+	forceFlag   bool
+	dryRunFlag  bool
+
+	gracefulFlag        bool
+	shutdownTimeoutFlag time.Duration
+	purgeFlag           bool
+	parallelFlag        int
+
+	roleFlag       string
+	secretFileFlag string
+	privSepFlag    bool
+
+	// presenter renders command results in the format selected with -o/--output
+	presenter *output.Presenter
+
+	// dryRunLog collects the operations skipped by --dry-run
+	dryRunLog *dryrun.Log
+
+	// redactor masks the passwords of the config in logs and error messages
+	redactor = domain.NewRedactor()
 )
 
-// Helper function to parse int
-func parseInt(s string) int {
-	if i, err := strconv.Atoi(s); err == nil {
-		return i
-	}
-	return 0
-}
-
-// Helper function to show command help
-func showCommandHelp(command string) {
-	switch command {
-	case "list":
-		fmt.Println("Command: list")
-		fmt.Println("Usage: proxima <host> list")
-		fmt.Println("Description: List all VMs on the specified host")
-	case "start":
-		fmt.Println("Command: start")
-		fmt.Println("Usage: proxima <host> start <vmid>")
-		fmt.Println("Description: Start a VM with the specified ID")
-	case "stop":
-		fmt.Println("Command: stop")
-		fmt.Println("Usage: proxima <host> stop <vmid>")
-		fmt.Println("Description: Stop a VM with the specified ID")
-	case "delete":
-		fmt.Println("Command: delete")
-		fmt.Println("Usage: proxima <host> delete <vmid>")
-		fmt.Println("Description: Delete a VM with the specified ID")
-	case "shutdown":
-		fmt.Println("Command: shutdown")
-		fmt.Println("Usage: proxima <host> shutdown <vmid>")
-		fmt.Println("Description: Shutdown a VM gracefully with the specified ID")
-	case "create":
-		fmt.Println("Command: create")
-		fmt.Println("Usage: proxima <host|yaml> create --name <name>")
-		fmt.Println("Description: Create a VM from config")
-		fmt.Println("Flags:")
-		fmt.Println("  --name string    VM name (required)")
-	default:
-		fmt.Printf("Unknown command: %s\n", command)
-		fmt.Println("Available commands: list, start, stop, shutdown, delete, create")
-	}
-}
+func main() {
+	log.SetOutput(redactor.Writer(os.Stderr))
 
-// Helper function to handle config file commands
-func handleConfigCommand(configFile, command string, args []string) {
-	switch command {
-	case "create":
-		if vmNameFlag == "" {
-			fmt.Println("Error: --name flag is required")
-			return
-		}
-		vmService, err := initializeServices(configFile, "")
-		if err != nil {
-			fmt.Printf("Error: %v\n", err)
-			return
-		}
-		if err := createVM(vmService, configFile, vmNameFlag); err != nil {
-			fmt.Printf("Error: %v\n", err)
-		}
-	default:
-		fmt.Printf("Error: unknown command '%s' for config file\n", command)
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs(normalizeArgs(rootCmd, os.Args[1:]))
+
+	// Errors returned by cobra itself are command line mistakes; commands
+	// report their own failures through fail()
+	if err := rootCmd.Execute(); err != nil {
+		fail(domain.WrapError(domain.ErrorKindValidation, err))
 	}
+	os.Exit(exitCode)
 }
 
-// Helper function to handle host commands
-func handleHostCommand(host, command string, args []string) {
-	vmService, err := getVMService(host)
-	if err != nil {
-		fmt.Printf("Error: %v\n", err)
-		return
+// normalizeArgs turns the positional target of "proxima <host|yaml> <command>"
+// into --target so cobra can dispatch on the command name.
+func normalizeArgs(rootCmd *cobra.Command, args []string) []string {
+	rootCmd.InitDefaultHelpCmd()
+	rootCmd.InitDefaultCompletionCmd()
+
+	first, last := 0, len(args)
+	if len(args) > 0 && (args[0] == cobra.ShellCompRequestCmd || args[0] == cobra.ShellCompNoDescRequestCmd) {
+		// The last argument of a completion request is the word being completed
+		first, last = 1, len(args)-1
 	}
 
-	switch command {
-	case "list":
-		if err := listVMs(vmService); err != nil {
-			fmt.Printf("Error: %v\n", err)
-		}
-	case "start":
-		if len(args) < 1 {
-			fmt.Println("Error: vmid is required")
-			fmt.Println("Usage: proxima <host> start <vmid>")
-			return
-		}
-		vmid := parseInt(args[0])
-		if vmid == 0 {
-			fmt.Println("Error: invalid vmid")
-			return
-		}
-		if err := startVM(vmService, vmid); err != nil {
-			fmt.Printf("Error: %v\n", err)
-		}
-	case "stop":
-		if len(args) < 1 {
-			fmt.Println("Error: vmid is required")
-			fmt.Println("Usage: proxima <host> stop <vmid>")
-			return
-		}
-		vmid := parseInt(args[0])
-		if vmid == 0 {
-			fmt.Println("Error: invalid vmid")
-			return
-		}
-		if err := stopVM(vmService, vmid); err != nil {
-			fmt.Printf("Error: %v\n", err)
-		}
-	case "delete":
-		if len(args) < 1 {
-			fmt.Println("Error: vmid is required")
-			fmt.Println("Usage: proxima <host> delete <vmid>")
-			return
+	for i := first; i < last; i++ {
+		arg := args[i]
+		if arg == "--" {
+			break
 		}
-		vmid := parseInt(args[0])
-		if vmid == 0 {
-			fmt.Println("Error: invalid vmid")
-			return
-		}
-		if err := deleteVM(vmService, vmid); err != nil {
-			fmt.Printf("Error: %v\n", err)
-		}
-	case "shutdown":
-		if len(args) < 1 {
-			fmt.Println("Error: vmid is required")
-			fmt.Println("Usage: proxima <host> shutdown <vmid>")
-			return
-		}
-		vmid := parseInt(args[0])
-		if vmid == 0 {
-			fmt.Println("Error: invalid vmid")
-			return
-		}
-		if err := shutdownVM(vmService, vmid); err != nil {
-			fmt.Printf("Error: %v\n", err)
-		}
-	case "create":
-		if vmNameFlag == "" {
-			fmt.Println("Error: --name flag is required")
-			return
+		if strings.HasPrefix(arg, "-") {
+			if flagTakesValue(rootCmd.PersistentFlags(), arg) {
+				i++
+			}
+			continue
 		}
-		if err := createVM(vmService, "config.yaml", vmNameFlag); err != nil {
-			fmt.Printf("Error: %v\n", err)
+		if arg == "" || isCommandName(rootCmd, arg) {
+			break
 		}
-	default:
-		fmt.Printf("Error: unknown command '%s'\n", command)
-		fmt.Println("Available commands: list, start, stop, shutdown, delete, create")
+
+		normalized := append([]string{}, args[:i]...)
+		normalized = append(normalized, "--target", arg)
+		return append(normalized, args[i+1:]...)
 	}
+	return args
 }
 
-func main() {
-	var rootCmd = &cobra.Command{
-		Use:   "proxima",
-		Short: "Tool for Proxmox VM management",
-		Long: `Proxima is a CLI tool to create, manage and execute commands on Proxmox VMs via SSH.
-
-USAGE:
-  proxima <host> <command>
-  proxima <yaml> <command>
-  proxima help <command>
-
-EXAMPLES:
-  proxima 192.168.1.100 list
-  proxima config.yaml create --name vm1`,
-		Run: func(cmd *cobra.Command, args []string) {
-			if len(args) == 0 {
-				fmt.Println("Proxima - Tool for Proxmox VM management")
-				fmt.Println()
-				fmt.Println("Usage:")
-				fmt.Println("  proxima <host> <command>")
-				fmt.Println("  proxima <yaml> <command>")
-				fmt.Println("  proxima help <command>")
-				fmt.Println()
-				fmt.Println("Commands:")
-				fmt.Println("  list           List all VMs")
-				fmt.Println("  start          Start a VM (requires <vmid>)")
-				fmt.Println("  stop           Stop a VM immediately (requires <vmid>)")
-				fmt.Println("  shutdown       Shutdown a VM gracefully (requires <vmid>)")
-				fmt.Println("  delete         Delete a VM (requires <vmid>)")
-				fmt.Println("  create         Create a VM from config (requires --name)")
-				fmt.Println()
-				fmt.Println("Global flags:")
-				fmt.Println("  --login         Interactive login for host authentication")
-				return
-			}
+// flagTakesValue reports whether arg is a flag whose value is the next argument.
+func flagTakesValue(flags *pflag.FlagSet, arg string) bool {
+	if strings.Contains(arg, "=") {
+		return false
+	}
 
-			// Handle help command
-			if args[0] == "help" {
-				if len(args) < 2 {
-					fmt.Println("Usage: proxima help <command>")
-					return
-				}
-				showCommandHelp(args[1])
-				return
-			}
+	var flag *pflag.Flag
+	if strings.HasPrefix(arg, "--") {
+		flag = flags.Lookup(arg[2:])
+	} else if len(arg) == 2 {
+		flag = flags.ShorthandLookup(arg[1:])
+	}
+	return flag != nil && flag.NoOptDefVal == ""
+}
 
-			// Handle regular commands
-			if len(args) < 2 {
-				fmt.Println("Error: missing command")
-				fmt.Println("Usage: proxima <host|yaml> <command>")
-				return
-			}
+func isCommandName(rootCmd *cobra.Command, name string) bool {
+	for _, cmd := range rootCmd.Commands() {
+		if cmd.Name() == name || cmd.HasAlias(name) {
+			return true
+		}
+	}
+	return false
+}
 
-			target := args[0]
-			command := args[1]
+// isConfigFile reports whether a target designates a YAML config file, or a
+// directory of them, rather than a host.
+func isConfigFile(target string) bool {
+	return strings.HasSuffix(target, ".yaml") || strings.HasSuffix(target, ".yml") || config.IsConfigDir(target)
+}
 
-			// Check if target is a YAML file
-			if strings.HasSuffix(target, ".yaml") || strings.HasSuffix(target, ".yml") {
-				handleConfigCommand(target, command, args[2:])
-			} else {
-				handleHostCommand(target, command, args[2:])
-			}
-		},
+// configFilePath returns the config file holding VM definitions: the target
+// itself in config file mode, config.yaml in host mode.
+func configFilePath() string {
+	if isConfigFile(targetFlag) {
+		return targetFlag
 	}
+	return "config.yaml"
+}
 
-	// Disable help flags completely
-	rootCmd.SetHelpCommand(nil)
-	rootCmd.DisableAutoGenTag = true
-	rootCmd.DisableFlagsInUseLine = true
-	rootCmd.SetHelpFunc(func(command *cobra.Command, strings []string) {})
+// targetVMService builds the VM service for --target: a YAML config file is
+// managed through the Proxmox API, anything else is a Proxmox host reached over
+// SSH. Without a target, the selected context is used.
+func targetVMService() (ports.VMService, error) {
+	switch {
+	case targetFlag == "":
+		return contextVMService()
+	case isConfigFile(targetFlag):
+		return initializeServices(targetFlag, "")
+	case loginFlag:
+		context, err := hostContext(targetFlag)
+		if err != nil {
+			return nil, err
+		}
+		return initializeServicesWithLogin(targetFlag, context)
+	default:
+		return initializeServicesWithSSHKey(targetFlag)
+	}
+}
 
-	rootCmd.PersistentFlags().BoolVar(&loginFlag, "login", false, "Interactive login for host authentication")
-	rootCmd.PersistentFlags().StringVar(&vmNameFlag, "name", "", "VM name")
+// newVMService assembles the VM service. With --dry-run, the VM and state
+// repositories are replaced by recording ones logging to dryRunLog.
+func newVMService(vmRepo ports.VMRepository, sshRepo ports.SSHRepository, stateRepo ports.StateRepository) (ports.VMService, error) {
+	if !dryRunFlag {
+		return service.NewVMServiceWithState(vmRepo, sshRepo, stateRepo), nil
+	}
 
-	if err := rootCmd.Execute(); err != nil {
-		fmt.Println("Error:", err.Error())
-		os.Exit(1)
+	dryRunLog = dryrun.NewLog()
+	recordingRepo, err := dryrun.NewRecordingVMRepository(vmRepo, dryRunLog)
+	if err != nil {
+		return nil, err
 	}
+	return service.NewVMServiceWithState(recordingRepo, sshRepo, dryrun.NewRecordingStateRepository(stateRepo, dryRunLog)), nil
 }
 
-// Helper to get VM service based on flags
-func getVMService(host string) (ports.VMService, error) {
-	if loginFlag {
-		return initializeServicesWithLogin(host)
+// printDryRun lists the operations recorded by a dry run, in the output format.
+func printDryRun() {
+	if dryRunLog == nil {
+		return
+	}
+	if err := presenter.Operations(dryRunLog.Entries(), targetLabel()); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 	}
-	return initializeServicesWithSSHKey(host)
 }
 
-// --- Original Logic Functions ---
-
-func runConfigFileMode(cmd *cobra.Command, args []string) error {
-	configFile := "config.yaml"
-	if len(args) > 0 {
-		configFile = args[0]
+// targetLabel names the target in messages: --target, or the selected context.
+func targetLabel() string {
+	if targetFlag != "" {
+		return targetFlag
 	}
-	fmt.Printf("Using config file: %s\n", configFile)
-	vmService, err := initializeServices(configFile, "")
+	if name, _, err := selectedContext(); err == nil && name != "" {
+		return "context " + name
+	}
+	return "no target"
+}
+
+// loadConfig loads a config file, completed by the selected context, and
+// registers its secrets for redaction. An empty configFile loads the context
+// alone.
+func loadConfig(configFile string) (*config.ConfigAdapter, error) {
+	_, context, err := selectedContext()
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	configAdapter := config.NewConfigAdapter()
+	if err := configAdapter.LoadConfigWithContext(configFile, context); err != nil {
+		return nil, err
 	}
-	return runConfigMode(vmService)
+	redactor.Add(configAdapter.Secrets()...)
+	return configAdapter, nil
 }
 
 func initializeServices(configFile, hostOverride string) (ports.VMService, error) {
-	configAdapter := config.NewConfigAdapter()
-	if err := configAdapter.LoadConfig(configFile); err != nil {
+	configAdapter, err := loadConfig(configFile)
+	if err != nil {
 		return nil, fmt.Errorf("error loading configuration: %w", err)
 	}
 
@@ -287,8 +237,30 @@ func initializeServices(configFile, hostOverride string) (ports.VMService, error
 		return nil, fmt.Errorf("configuration validation failed: %w", err)
 	}
 
-	proxmoxConfig := configAdapter.GetProxmoxConfig()
 	sshConfig := configAdapter.GetSSHConfig()
+	proxmoxAdapter := newProxmoxAdapter(configAdapter, hostOverride)
+
+	sshAdapter := ssh.NewSSHAdapterWithProxmox(
+		sshConfig.User,
+		sshConfig.Password,
+		sshConfig.KeyPath,
+		sshConfig.Port,
+		sshConfig.CopiesLocalKey(),
+		proxmoxAdapter,
+	)
+
+	stateAdapter, err := state.NewStateAdapter(state.DefaultPath(configFile))
+	if err != nil {
+		return nil, err
+	}
+
+	return newVMService(proxmoxAdapter, sshAdapter, stateAdapter)
+}
+
+// newProxmoxAdapter returns the Proxmox API adapter of config file mode. An API
+// token, when configured, is used instead of the password.
+func newProxmoxAdapter(configAdapter *config.ConfigAdapter, hostOverride string) *proxmox.ProxmoxAdapter {
+	proxmoxConfig := configAdapter.GetProxmoxConfig()
 
 	// Override host if provided via command line
 	targetHost := hostOverride
@@ -296,79 +268,245 @@ func initializeServices(configFile, hostOverride string) (ports.VMService, error
 		targetHost = proxmoxConfig.Host
 	}
 
-	// For config file mode, use original Proxmox API adapter
-	proxmoxAdapter := proxmox.NewProxmoxAdapterWithVMIPBase(
+	apiToken := ""
+	if token, ok := configAdapter.GetAPIToken(); ok {
+		apiToken = token.Credential()
+	}
+	proxmoxAdapter := proxmox.NewProxmoxAdapterWithToken(
 		targetHost,
 		proxmoxConfig.Port,
 		proxmoxConfig.User,
 		proxmoxConfig.Password,
+		apiToken,
 		proxmoxConfig.Node,
 		proxmoxConfig.VMIPBase,
 	)
+	proxmoxAdapter.SetIPPreferences(configAdapter.GetIPPreferences())
+	proxmoxAdapter.SetTaskTimeout(taskTimeoutFlag)
+	proxmoxAdapter.SetTOTPProvider(totpCode)
+	return proxmoxAdapter
+}
 
-	sshAdapter := ssh.NewSSHAdapterWithProxmox(
-		sshConfig.User,
-		sshConfig.Password,
-		sshConfig.KeyPath,
-		sshConfig.Port,
-		sshConfig.CopyLocalKey,
-		proxmoxAdapter,
-	)
+// totpEnv names the environment variable holding the TOTP code of users with
+// two-factor authentication, for scripts.
+const totpEnv = "PROXIMA_TOTP"
+
+// totpCode returns the TOTP code from PROXIMA_TOTP, or asks for it on stderr.
+func totpCode() (string, error) {
+	if code := os.Getenv(totpEnv); code != "" {
+		return code, nil
+	}
+	if !isTerminal(os.Stdin) {
+		return "", fmt.Errorf("stdin is not a terminal; set %s", totpEnv)
+	}
 
-	vmService := service.NewVMService(proxmoxAdapter, sshAdapter)
-	return vmService, nil
+	fmt.Fprint(os.Stderr, "TOTP code: ")
+	code, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	code = strings.TrimSpace(code)
+	if code == "" {
+		return "", fmt.Errorf("no TOTP code given")
+	}
+	return code, nil
 }
 
-func initializeServicesWithSSHKey(host string) (ports.VMService, error) {
-	// Create SSH direct adapter for Proxmox
-	proxmoxSSHAdapter := proxmox_ssh.NewProxmoxSSHAdapter(host, "root", "", 22)
+// createToken creates an API token with the credentials of the config file,
+// then records it there. The token is recorded even when granting it its role
+// failed, since Proxmox never shows its secret again.
+func createToken(configFile, name string) error {
+	if !isConfigFile(targetFlag) {
+		return domain.Errorf(domain.ErrorKindValidation, "token create manages tokens through the Proxmox API; give a config file as target")
+	}
+	if config.IsConfigDir(configFile) {
+		return domain.Errorf(domain.ErrorKindValidation, "token create records the token in a config file; give the file holding the proxmox section as target")
+	}
 
-	sshAdapter := ssh.NewSSHAdapterWithProxmox(
-		"root",
-		"",
-		"", // use default SSH keys
-		22,
-		true,
-		proxmoxSSHAdapter,
-	)
+	configAdapter, err := loadConfig(configFile)
+	if err != nil {
+		return fmt.Errorf("error loading configuration: %w", err)
+	}
+	if err := configAdapter.ValidateConfig(); err != nil {
+		return fmt.Errorf("configuration validation failed: %w", err)
+	}
 
-	vmService := service.NewVMService(proxmoxSSHAdapter, sshAdapter)
-	return vmService, nil
+	user := userFlag
+	if user == "" {
+		user = configAdapter.GetProxmoxConfig().User
+	}
+	if current, ok := configAdapter.GetAPIToken(); ok && user == "" {
+		user = current.User
+	}
+	if user == "" {
+		return domain.Errorf(domain.ErrorKindValidation, "no user to create the token for; pass --user")
+	}
+
+	token := &domain.APIToken{User: user, Name: name, Comment: "proxima", PrivSep: privSepFlag}
+	accessService := service.NewAccessService(newProxmoxAdapter(configAdapter, ""))
+
+	fmt.Printf("Creating API token %s...\n", token.ID())
+	err = accessService.CreateAPIToken(token, roleFlag)
+	if token.Secret == "" {
+		return err
+	}
+	redactor.Add(token.Secret)
+
+	if writeErr := config.WriteAPIToken(configFile, *token, secretFileFlag); writeErr != nil {
+		// Errors are redacted, so the secret is shown here or never again
+		fmt.Fprintf(os.Stderr, "Secret of API token %s, store it now: %s\n", token.ID(), token.Secret)
+		return fmt.Errorf("API token %s created but could not be stored: %w", token.ID(), writeErr)
+	}
+	fmt.Printf("API token %s stored in %s, secret in %s\n", token.ID(), configFile, secretFileFlag)
+	return err
+}
+
+// initializeServicesWithSSHKey manages a host over SSH with the user, port and
+// key of its context, by default as root on port 22 with the default keys.
+func initializeServicesWithSSHKey(host string) (ports.VMService, error) {
+	context, err := hostContext(host)
+	if err != nil {
+		return nil, err
+	}
+	return initializeHostServices(host, hostSSHConfig(context), hostVMSSHConfig(context))
 }
 
-func initializeServicesWithLogin(host string) (ports.VMService, error) {
+// initializeServicesWithLogin asks for the SSH user and password of a host.
+func initializeServicesWithLogin(host string, context *config.Context) (ports.VMService, error) {
+	login := hostSSHConfig(context)
 	reader := bufio.NewReader(os.Stdin)
 
 	fmt.Print("SSH user: ")
 	user, _ := reader.ReadString('\n')
-	user = strings.TrimSpace(user)
+	login.User = strings.TrimSpace(user)
 
 	fmt.Print("SSH password: ")
 	password, _ := reader.ReadString('\n')
-	password = strings.TrimSpace(password)
+	login.Password = strings.TrimSpace(password)
+	redactor.Add(login.Password)
+
+	return initializeHostServices(host, login, hostVMSSHConfig(context))
+}
+
+// initializeHostServices manages a host over SSH: login is how to log in to
+// the host, vmSSH how to reach its VMs.
+func initializeHostServices(host string, login, vmSSH config.SSHConfig) (ports.VMService, error) {
+	prefs, err := hostIPPreferences()
+	if err != nil {
+		return nil, err
+	}
 
 	// Create SSH direct adapter for Proxmox
-	proxmoxSSHAdapter := proxmox_ssh.NewProxmoxSSHAdapter(host, user, password, 22)
+	proxmoxSSHAdapter := proxmox_ssh.NewProxmoxSSHAdapter(host, login.User, login.Password, login.Port)
+	proxmoxSSHAdapter.SetKeyPath(login.KeyPath)
+	proxmoxSSHAdapter.SetIPPreferences(prefs)
 
 	sshAdapter := ssh.NewSSHAdapterWithProxmox(
-		user,
-		password,
-		"", // use default SSH keys
-		22,
-		true,
+		vmSSH.User,
+		vmSSH.Password,
+		vmSSH.KeyPath,
+		vmSSH.Port,
+		vmSSH.CopiesLocalKey(),
 		proxmoxSSHAdapter,
 	)
 
-	vmService := service.NewVMService(proxmoxSSHAdapter, sshAdapter)
-	return vmService, nil
+	stateAdapter, err := state.NewStateAdapter(state.DefaultPath("config.yaml"))
+	if err != nil {
+		return nil, err
+	}
+
+	return newVMService(proxmoxSSHAdapter, sshAdapter, stateAdapter)
 }
 
-func runConfigMode(vmService ports.VMService) error {
+// hostIPPreferences returns the ip_discovery settings of host mode: those of
+// config.yaml, or of the selected context when there is no config.yaml.
+func hostIPPreferences() (domain.IPPreferences, error) {
+	configFile := configFilePath()
+	if _, err := os.Stat(configFile); os.IsNotExist(err) {
+		configFile = ""
+	}
+	configAdapter, err := loadConfig(configFile)
+	if err != nil {
+		return domain.IPPreferences{}, err
+	}
+	return configAdapter.GetIPPreferences(), nil
+}
+
+// checkConfig loads a config file to validate it, completed by the selected
+// context. The secrets of both are left unresolved, so that validate runs
+// without them, e.g. in CI.
+func checkConfig(configFile string) (*config.ConfigAdapter, error) {
+	contexts, err := loadContexts()
+	if err != nil {
+		return nil, err
+	}
+	var context *config.Context
+	if name := contexts.Selected(contextFlag); name != "" {
+		if context, err = contexts.Unresolved(name); err != nil {
+			return nil, err
+		}
+	}
+
+	configAdapter := config.NewConfigAdapter()
+	if err := configAdapter.CheckConfigWithContext(configFile, context); err != nil {
+		return nil, err
+	}
+	redactor.Add(configAdapter.Secrets()...)
+	return configAdapter, nil
+}
+
+// validateConfig checks a config file and reports each of its problems on
+// stderr.
+func validateConfig(configFile string) error {
+	configAdapter, err := checkConfig(configFile)
+	if err != nil {
+		return err
+	}
+
+	problems := configAdapter.Problems()
+	for _, problem := range problems {
+		fmt.Fprintln(os.Stderr, redactor.Redact(problem.Error()))
+	}
+	if len(problems) > 0 {
+		return domain.Errorf(domain.ErrorKindValidation, "%s has %d problem(s)", configFile, len(problems))
+	}
+
+	vms, err := configAdapter.GetAllVMConfigs()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s is valid: %d VM(s)\n", configFile, len(vms))
+	return nil
+}
+
+// showConfig shows the effective settings of the VM with the given name.
+func showConfig(configFile, name string) error {
+	configAdapter, err := loadConfig(configFile)
+	if err != nil {
+		return err
+	}
+	settings, err := configAdapter.EffectiveSettings(name)
+	if err != nil {
+		return err
+	}
+	return presenter.Settings(settings)
+}
+
+// printSchema prints the JSON Schema of config files.
+func printSchema() error {
+	data, err := json.MarshalIndent(config.Schema(), "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(data))
+	return nil
+}
+
+// applyConfig creates the VMs of the config file that do not exist yet, and
+// deletes the instances of VM groups beyond their count.
+func applyConfig(vmService ports.VMService, cmd *cobra.Command, configFile string) error {
 	fmt.Println("Loading configuration...")
 
 	// Load config to get VM definitions
-	configAdapter := config.NewConfigAdapter()
-	if err := configAdapter.LoadConfig("config.yaml"); err != nil {
+	configAdapter, err := loadConfig(configFile)
+	if err != nil {
 		return fmt.Errorf("error loading configuration: %w", err)
 	}
 
@@ -381,48 +519,140 @@ func runConfigMode(vmService ports.VMService) error {
 	}
 
 	if len(configVMs) == 0 {
-		fmt.Println("No VMs defined in config.yaml")
+		fmt.Printf("No VMs defined in %s\n", configFile)
 		return nil
 	}
 
-	fmt.Printf("Processing %d VM(s) from config.yaml...\n\n", len(configVMs))
+	fmt.Printf("Processing %d VM(s) from %s...\n\n", len(configVMs), configFile)
 
 	fmt.Println("Checking existing VMs...")
-	// Get existing VMs from Proxmox
-	existingVMs, err := vmService.ListVMs()
+	plan, err := vmService.PlanApply(configVMs, configAdapter.Groups())
 	if err != nil {
-		return fmt.Errorf("error listing existing VMs: %w", err)
+		return fmt.Errorf("error planning changes: %w", err)
 	}
 
-	fmt.Printf("Found %d existing VMs\n\n", len(existingVMs))
-
-	// Create map of existing VMs for quick lookup
-	existingVMMap := make(map[int]bool)
-	for _, vm := range existingVMs {
-		existingVMMap[vm.ID] = true
+	// The plan is what a dry run shows; other runs show it in text formats
+	// only, before the results
+	if dryRunFlag || presenter.IsText() {
+		if err := presenter.Plan(plan); err != nil {
+			return err
+		}
+	}
+	create := make(map[*domain.VM]bool)
+	for _, vm := range plan.VMs(domain.PlanActionCreate) {
+		create[vm] = true
 	}
 
-	// Process each VM from config
-	for _, vmConfig := range configVMs {
-		if existingVMMap[vmConfig.ID] {
-			fmt.Printf("[OK] VM '%s' (ID: %d) already exists\n", vmConfig.Name, vmConfig.ID)
-		} else {
-			fmt.Printf("[CREATE] Creating VM '%s' (ID: %d)...\n", vmConfig.Name, vmConfig.ID)
-			if err := vmService.CreateVM(vmConfig); err != nil {
-				fmt.Printf("[ERROR] Failed to create VM '%s': %v\n", vmConfig.Name, err)
-				continue
-			}
-			fmt.Printf("[OK] VM '%s' (ID: %d) created successfully\n", vmConfig.Name, vmConfig.ID)
+	// On a terminal, the phase of every VM is shown live. The messages of the
+	// steps would break that display, so they are discarded until it stops.
+	live := isTerminal(os.Stdout) && !dryRunFlag
+	progress := output.NewProgress(os.Stdout, live, configVMs)
+	stdout := os.Stdout
+	if live {
+		if devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0); err == nil {
+			defer devNull.Close()
+			os.Stdout = devNull
 		}
 	}
 
+	progress.Start()
+	results := runInWaves(vmService, cmd, configVMs, func(vmConfig *domain.VM, last bool) error {
+		err := applyVM(vmService, vmConfig, !create[vmConfig], last, progress.Report)
+		progress.Done(vmConfig, err)
+		return err
+	})
+	progress.Stop()
+	os.Stdout = stdout
+	reportApply(results)
+
+	if err := removeSurplus(vmService, cmd, plan.VMs(domain.PlanActionDelete), protectedIn(configVMs)); err != nil {
+		return err
+	}
+
+	if !presenter.IsText() {
+		return nil
+	}
+
 	fmt.Println("\n[INFO] Current VM status:")
 	return listVMs(vmService)
 }
 
+// reportApply reports the results of apply. Those of a dry run are simulated
+// and its plan is its output, so only their failures are reported.
+func reportApply(results []*domain.TaskResult) {
+	if !dryRunFlag {
+		report(results)
+		return
+	}
+	for _, result := range results {
+		if result.Err != nil {
+			fail(result.Err)
+		}
+	}
+}
+
+// applyVM creates a VM of the config file unless it exists, then, when it is
+// auto-started, waits until the VMs coming after it can rely on it.
+func applyVM(vmService ports.VMService, vm *domain.VM, exists, last bool, progress domain.ProgressFunc) error {
+	if exists {
+		return domain.Skipped("already exists")
+	}
+
+	if err := vmService.CreateVM(vm, progress); err != nil {
+		return fmt.Errorf("failed to create VM '%s': %w", vm.Name, err)
+	}
+
+	if !vm.AutoStart {
+		return nil
+	}
+	if waitFlag {
+		progress.Report(vm, domain.PhaseProvisioning)
+		if err := waitVM(vmService, vm.ID, "ssh"); err != nil {
+			return err
+		}
+	}
+	return settle(vmService, vm, last)
+}
+
+// removeSurplus deletes the instances of groups beyond their count, once
+// confirmed as with delete. They are shut down gracefully first.
+func removeSurplus(vmService ports.VMService, cmd *cobra.Command, surplus []*domain.VM, protected protectedVMs) error {
+	if len(surplus) == 0 {
+		return nil
+	}
+
+	fmt.Printf("\nRemoving %d VM(s) beyond the count of their group...\n", len(surplus))
+	vms, err := confirmDelete(vmService, surplus, protected)
+	if err != nil {
+		return err
+	}
+
+	opts := domain.DefaultDeleteOptions()
+	opts.Graceful = true
+	reportApply(vmService.RunParallel(vms, "delete", workers(cmd), func(vm *domain.VM) error {
+		fmt.Printf("Deleting VM %s...\n", vm.Label())
+		return vmService.DeleteVM(vm.ID, opts)
+	}))
+	return nil
+}
+
+// scaleGroup sets the number of instances of a VM group in the config file.
+func scaleGroup(configFile, name string, count int) error {
+	configAdapter, err := loadConfig(configFile)
+	if err != nil {
+		return err
+	}
+	group, err := configAdapter.Scale(name, count)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Scaled %s from %d to %d instance(s) in %s; run apply to create or remove them\n", group.Name, group.Count, count, configFile)
+	return nil
+}
+
 func createVM(vmService ports.VMService, configFile, vmName string) error {
-	configAdapter := config.NewConfigAdapter()
-	if err := configAdapter.LoadConfig(configFile); err != nil {
+	configAdapter, err := loadConfig(configFile)
+	if err != nil {
 		return err
 	}
 
@@ -431,15 +661,210 @@ func createVM(vmService ports.VMService, configFile, vmName string) error {
 		return fmt.Errorf("VM '%s' not found in configuration: %w", vmName, err)
 	}
 
+	result := domain.NewTaskResult(vm, "create")
+	err = createConfiguredVM(vmService, vm)
+	result.VMID = vm.ID
+	result.Finish(err)
+
+	if err := presenter.Results([]*domain.TaskResult{result}); err != nil {
+		return err
+	}
+	return err
+}
+
+func createConfiguredVM(vmService ports.VMService, vm *domain.VM) error {
+	if err := vmService.AssignVMID(vm); err != nil {
+		return err
+	}
+
 	fmt.Printf("Creating VM '%s' (ID: %d)...\n", vm.Name, vm.ID)
-	if err := vmService.CreateVM(vm); err != nil {
+	progress := output.NewProgress(os.Stdout, false, []*domain.VM{vm})
+	if err := vmService.CreateVM(vm, progress.Report); err != nil {
 		return fmt.Errorf("error creating VM: %w", err)
 	}
 
 	fmt.Printf("VM '%s' created successfully!\n", vm.Name)
+
+	if waitFlag {
+		if !vm.AutoStart {
+			fmt.Printf("VM '%s' is not started (auto_start is false), nothing to wait for\n", vm.Name)
+			return nil
+		}
+		progress.Report(vm, domain.PhaseProvisioning)
+		return waitVM(vmService, vm.ID, "ssh")
+	}
+	return nil
+}
+
+// configuredVM returns the definition of the VM with the given ID or name in
+// the config file, or nil when the VM is not defined there.
+func configuredVM(configFile string, target *domain.VM) (*domain.VM, error) {
+	vms, err := configuredVMs(configFile)
+	if err != nil {
+		return nil, err
+	}
+	return findConfigured(vms, target), nil
+}
+
+func configuredVMs(configFile string) ([]*domain.VM, error) {
+	configAdapter, err := loadConfig(configFile)
+	if err != nil {
+		return nil, err
+	}
+	return configAdapter.GetAllVMConfigs()
+}
+
+// findConfigured returns the VM of vms with the ID or name of target, or nil.
+func findConfigured(vms []*domain.VM, target *domain.VM) *domain.VM {
+	for _, vm := range vms {
+		if (vm.ID != 0 && vm.ID == target.ID) || (target.Name != "" && vm.Name == target.Name) {
+			return vm
+		}
+	}
 	return nil
 }
 
+// withStartOrder copies start_order, depends_on and startup_delay from the
+// config file onto the VMs. VMs selected by VMID are looked up first, since
+// dependencies refer to names. Without a readable config file the VMs are
+// left unordered.
+func withStartOrder(vmService ports.VMService, vms []*domain.VM) []*domain.VM {
+	configured, err := configuredVMs(configFilePath())
+	if err != nil {
+		return vms
+	}
+
+	for _, vm := range vms {
+		if vm.Name == "" {
+			if details, err := vmService.GetVM(vm.ID); err == nil {
+				vm.Name = details.Name
+			}
+		}
+		if c := findConfigured(configured, vm); c != nil {
+			vm.StartOrder = c.StartOrder
+			vm.DependsOn = c.DependsOn
+			vm.StartupDelay = c.StartupDelay
+		}
+	}
+	return vms
+}
+
+// vmSSHConfig returns the SSH settings of the VM with the given ID or name in the
+// config file, or empty settings when the VM is not defined there.
+func vmSSHConfig(configFile string, target *domain.VM) (domain.SSHConfig, error) {
+	vm, err := configuredVM(configFile, target)
+	if err != nil || vm == nil {
+		return domain.SSHConfig{}, err
+	}
+	return vm.SSH, nil
+}
+
+// protectedVMs are the VMs a config file marks as protected.
+type protectedVMs []*domain.VM
+
+// configProtected returns the VMs the config file marks as protected, loading
+// it once for all the VMs of a command. In host mode a missing config.yaml
+// protects nothing; any other error is returned, not to delete a VM the config
+// protects.
+func configProtected(configFile string) (protectedVMs, error) {
+	vms, err := configuredVMs(configFile)
+	switch {
+	case errors.Is(err, domain.ErrNotFound):
+		return nil, nil
+	case err != nil:
+		return nil, fmt.Errorf("error loading protected VMs: %w", err)
+	}
+	return protectedIn(vms), nil
+}
+
+// protectedIn returns the VMs of a config marked as protected.
+func protectedIn(vms []*domain.VM) protectedVMs {
+	var protected protectedVMs
+	for _, vm := range vms {
+		if vm.Protected {
+			protected = append(protected, vm)
+		}
+	}
+	return protected
+}
+
+// protects reports whether target, by ID or name, is one of the protected VMs.
+func (p protectedVMs) protects(target *domain.VM) bool {
+	return findConfigured(p, target) != nil
+}
+
+func copyKey(vmService ports.VMService, vmid int, sshConfig domain.SSHConfig) error {
+	if userFlag != "" {
+		sshConfig.User = userFlag
+	}
+
+	for _, path := range keyFlags {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read public key: %w", err)
+		}
+		for _, line := range strings.Split(string(data), "\n") {
+			if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") {
+				sshConfig.AuthorizedKeys = append(sshConfig.AuthorizedKeys, line)
+			}
+		}
+	}
+
+	if removeFlag {
+		fmt.Printf("Removing SSH keys from VM %d...\n", vmid)
+		removed, err := vmService.RemoveSSHKeys(vmid, sshConfig)
+		if err != nil {
+			return fmt.Errorf("error removing SSH keys: %w", err)
+		}
+		fmt.Printf("%d key(s) removed from VM %d\n", removed, vmid)
+		return nil
+	}
+
+	fmt.Printf("Copying SSH keys to VM %d...\n", vmid)
+	installed, err := vmService.InstallSSHKeys(vmid, sshConfig)
+	if err != nil {
+		return fmt.Errorf("error copying SSH keys: %w", err)
+	}
+	if installed == 0 {
+		fmt.Printf("All keys already present on VM %d\n", vmid)
+		return nil
+	}
+	fmt.Printf("%d key(s) installed on VM %d\n", installed, vmid)
+	return nil
+}
+
+// execCommand runs a command on every VM and renders the commands. Text
+// formats print the output of each as it completes.
+func execCommand(vmService ports.VMService, cmd *cobra.Command, vms []*domain.VM, command string, args []string) {
+	index := make(map[*domain.VM]int, len(vms))
+	for i, vm := range vms {
+		index[vm] = i
+	}
+
+	commands := make([]*domain.Command, len(vms))
+	results := vmService.RunParallel(vms, cmd.Name(), workers(cmd), func(vm *domain.VM) error {
+		run, err := vmService.ExecuteCommandOnVM(vm.ID, command, args, 0)
+		if run == nil {
+			run = domain.NewCommand(vm.ID, command, args, 0)
+			run.Fail(err.Error())
+		}
+		commands[index[vm]] = run
+		if presenter.IsText() {
+			fmt.Printf("=== VM %s ===\n%s\n", vm.Label(), strings.TrimRight(run.Output, "\n"))
+		}
+		return err
+	})
+
+	for _, result := range results {
+		if result.Err != nil {
+			fail(result.Err)
+		}
+	}
+	if err := presenter.Commands(commands); err != nil {
+		fail(err)
+	}
+}
+
 func startVM(vmService ports.VMService, vmid int) error {
 	fmt.Printf("Starting VM %d...\n", vmid)
 	if err := vmService.StartVM(vmid); err != nil {
@@ -447,6 +872,49 @@ func startVM(vmService ports.VMService, vmid int) error {
 	}
 
 	fmt.Printf("VM %d started successfully!\n", vmid)
+
+	if waitFlag {
+		return waitVM(vmService, vmid, "ssh")
+	}
+	return nil
+}
+
+func waitVM(vmService ports.VMService, vmid int, condition string) error {
+	if dryRunFlag {
+		fmt.Printf("Dry run: not waiting for VM %d (%s)\n", vmid, condition)
+		return nil
+	}
+
+	opts := domain.DefaultWaitOptions().WithTimeout(timeoutFlag)
+
+	fmt.Printf("Waiting up to %s for VM %d (%s)...\n", opts.Timeout, vmid, condition)
+
+	switch condition {
+	case "running", "stopped", "paused", "suspended":
+		if err := vmService.WaitForStatus(vmid, domain.VMStatus(condition), opts); err != nil {
+			return err
+		}
+		fmt.Printf("VM %d is %s\n", vmid, condition)
+	case "agent":
+		if err := vmService.WaitForAgent(vmid, opts); err != nil {
+			return err
+		}
+		fmt.Printf("Guest agent of VM %d is responding\n", vmid)
+	case "ip":
+		ip, err := vmService.WaitForIP(vmid, opts)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("VM %d has IP %s\n", vmid, ip)
+	case "ssh":
+		if err := vmService.WaitForSSH(vmid, opts); err != nil {
+			return err
+		}
+		fmt.Printf("VM %d is reachable via SSH\n", vmid)
+	default:
+		return domain.Errorf(domain.ErrorKindValidation, "unknown wait condition '%s' (expected %s)", condition, strings.Join(waitConditions, ", "))
+	}
+
 	return nil
 }
 
@@ -461,8 +929,13 @@ func stopVM(vmService ports.VMService, vmid int) error {
 }
 
 func deleteVM(vmService ports.VMService, vmid int) error {
+	opts := domain.DefaultDeleteOptions()
+	opts.Graceful = gracefulFlag
+	opts.ShutdownTimeout = shutdownTimeoutFlag
+	opts.Purge = purgeFlag
+
 	fmt.Printf("Deleting VM %d...\n", vmid)
-	if err := vmService.DeleteVM(vmid); err != nil {
+	if err := vmService.DeleteVM(vmid, opts); err != nil {
 		return fmt.Errorf("error deleting VM: %w", err)
 	}
 
@@ -480,25 +953,61 @@ func shutdownVM(vmService ports.VMService, vmid int) error {
 	return nil
 }
 
+func showIP(vmService ports.VMService, vmid int) error {
+	ifaces, err := vmService.GetVMInterfaces(vmid)
+	if err != nil {
+		return fmt.Errorf("error getting network interfaces: %w", err)
+	}
+
+	if err := presenter.Interfaces(ifaces); err != nil {
+		return err
+	}
+
+	if presenter.IsText() {
+		ip, err := vmService.GetVMIP(vmid)
+		if err != nil {
+			fmt.Printf("\nPreferred IP: none (%v)\n", err)
+			return nil
+		}
+		fmt.Printf("\nPreferred IP: %s\n", ip)
+	}
+	return nil
+}
+
 func listVMs(vmService ports.VMService) error {
 	vms, err := vmService.ListVMs()
 	if err != nil {
 		return fmt.Errorf("error listing VMs: %w", err)
 	}
 
-	if len(vms) == 0 {
-		fmt.Println("No VMs found.")
-		return nil
+	// Resolving IPs costs one guest agent call per VM, so only the wide table shows them
+	if presenter.Format() == output.FormatWide {
+		for _, vm := range vms {
+			if vm.Status == domain.VMStatusRunning {
+				vm.IP, _ = vmService.GetVMIP(vm.ID)
+			}
+		}
 	}
 
-	fmt.Println("Found VMs:")
-	fmt.Printf("%-6s %-20s %-10s %-8s %-8s\n", "VMID", "Name", "Status", "CPU", "Memory")
-	fmt.Println("----------------------------------------------------")
+	return presenter.VMs(vms)
+}
 
-	for _, vm := range vms {
-		fmt.Printf("%-6d %-20s %-10s %-8d %-8d MB\n",
-			vm.ID, vm.Name, vm.Status, vm.Cores, vm.Memory)
+// listTemplates lists the templates of the cluster with the aliases of the
+// config file. In host mode, a missing config.yaml has no aliases.
+func listTemplates(vmService ports.VMService) error {
+	vms, err := vmService.ListVMs()
+	if err != nil {
+		return fmt.Errorf("error listing templates: %w", err)
 	}
 
-	return nil
+	aliases := map[string]string{}
+	configAdapter, err := loadConfig(configFilePath())
+	switch {
+	case err == nil:
+		aliases = configAdapter.TemplateAliases()
+	case !errors.Is(err, domain.ErrNotFound):
+		return err
+	}
+
+	return presenter.Templates(domain.MatchTemplates(vms, aliases))
 }
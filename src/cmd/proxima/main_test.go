@@ -0,0 +1,104 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"proxima/internal/adapters/config"
+	"proxima/internal/core/domain"
+)
+
+func TestNormalizeArgs(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want []string
+	}{
+		{"host target", []string{"10.0.0.1", "start", "100"}, []string{"--target", "10.0.0.1", "start", "100"}},
+		{"yaml target", []string{"config.yaml", "create", "--name", "web"}, []string{"--target", "config.yaml", "create", "--name", "web"}},
+		{"bool flag first", []string{"--login", "10.0.0.1", "list"}, []string{"--login", "--target", "10.0.0.1", "list"}},
+		{"value flag first", []string{"-o", "json", "10.0.0.1", "list"}, []string{"-o", "json", "--target", "10.0.0.1", "list"}},
+		{"context without target", []string{"--context", "prod", "list"}, []string{"--context", "prod", "list"}},
+		{"explicit target", []string{"--target", "10.0.0.1", "list"}, []string{"--target", "10.0.0.1", "list"}},
+		{"command first", []string{"list", "--target", "10.0.0.1"}, []string{"list", "--target", "10.0.0.1"}},
+		{"help", []string{"help", "start"}, []string{"help", "start"}},
+		{"completion script", []string{"completion", "bash"}, []string{"completion", "bash"}},
+		{"no args", []string{}, []string{}},
+		{"complete command", []string{"__complete", "st"}, []string{"__complete", "st"}},
+		{"complete after target", []string{"__complete", "10.0.0.1", "start", ""}, []string{"__complete", "--target", "10.0.0.1", "start", ""}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := normalizeArgs(newRootCmd(), tt.args)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestProtectedVMs(t *testing.T) {
+	db, web := domain.NewVM("db", 0), domain.NewVM("web", 101)
+	db.Protected = true
+	protected := protectedIn([]*domain.VM{db, web})
+
+	tests := []struct {
+		name string
+		vm   *domain.VM
+		want bool
+	}{
+		{"by name", domain.NewVM("db", 200), true},
+		{"unprotected", domain.NewVM("web", 101), false},
+		{"unknown", domain.NewVM("cache", 102), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := protected.protects(tt.vm); got != tt.want {
+				t.Errorf("Expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestConfigProtected(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	dir := t.TempDir()
+
+	// In host mode, config.yaml may not exist
+	protected, err := configProtected(filepath.Join(dir, "config.yaml"))
+	if err != nil || len(protected) != 0 {
+		t.Errorf("Expected no protected VM without a config, got %v (%v)", protected, err)
+	}
+
+	// A config that cannot be loaded must not unprotect its VMs
+	broken := filepath.Join(dir, "broken.yaml")
+	data := "proxmox:\n  host: pve\n  password: ${PROXIMA_TEST_UNSET}\nvms:\n  - name: db\n    protected: true\n"
+	if err := os.WriteFile(broken, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := configProtected(broken); err == nil {
+		t.Error("Expected an error for a config that cannot be loaded")
+	}
+}
+
+func TestHostSSHConfig(t *testing.T) {
+	copyLocalKey := false
+	context := &config.Context{SSH: config.SSHConfig{User: "admin", Port: 2222, KeyPath: "lab", CopyLocalKey: &copyLocalKey}}
+
+	login := hostSSHConfig(context)
+	if login.User != "admin" || login.Port != 2222 || login.KeyPath != "lab" {
+		t.Errorf("Expected the host login of the context, got %+v", login)
+	}
+
+	// The VMs keep their own settings, honoring copy_local_key
+	vmSSH := hostVMSSHConfig(context)
+	if vmSSH.User != "root" || vmSSH.Port != 22 || vmSSH.KeyPath != "" || vmSSH.CopiesLocalKey() {
+		t.Errorf("Expected root on port 22 without the local key, got %+v", vmSSH)
+	}
+	if !hostVMSSHConfig(nil).CopiesLocalKey() {
+		t.Errorf("Expected the local key copied by default")
+	}
+}
@@ -1,61 +1,131 @@
 package config
 
+// The doc tag of a field is its description in the JSON Schema, and its
+// schema tag lists constraints: required, minimum=N, maximum=N, pattern=RE,
+// example=V and enum=A|B or enum=<name of a list of enums>. See schema.go.
+//
+// VM settings are merged from several levels (see merge.go). A setting is
+// unset, and inherited, when it is absent or null: settings whose zero value
+// is meaningful, such as booleans, are pointers. An empty list is set.
+
 type Config struct {
-	Proxmox   ProxmoxConfig     `yaml:"proxmox"`
-	SSH       SSHConfig         `yaml:"ssh"`
-	Defaults  VMConfig          `yaml:"defaults"`
-	Templates map[string]string `yaml:"templates"`
-	VMs       []VMConfig        `yaml:"vms"`
+	Include   []string                  `yaml:"include" doc:"Globs of other config files to merge with this one, relative to it"`
+	Proxmox   ProxmoxConfig             `yaml:"proxmox" doc:"Proxmox cluster managed through the API"`
+	SSH       SSHConfig                 `yaml:"ssh" doc:"SSH settings used to reach VMs"`
+	Defaults  VMConfig                  `yaml:"defaults" doc:"Settings of VMs that do not set them"`
+	Templates map[string]TemplateConfig `yaml:"templates" doc:"Templates by alias: a VMID or name, or the template with the settings of the VMs cloned from it"`
+	VMs       []VMConfig                `yaml:"vms" doc:"VMs to create"`
 }
 
 type ProxmoxConfig struct {
-	Host     string `yaml:"host"`
-	Port     int    `yaml:"port"`
-	User     string `yaml:"user"`
-	Password string `yaml:"password"`
-	Node     string `yaml:"node"`
-	VMIPBase string `yaml:"vm_ip_base"`
+	Host               string            `yaml:"host" doc:"Address of the Proxmox host"`
+	Port               int               `yaml:"port" doc:"API port" schema:"minimum=1,maximum=65535,example=8006"`
+	User               string            `yaml:"user" doc:"User logging in with a password, as USER@REALM"`
+	Password           string            `yaml:"password" doc:"Password of user; ${VAR} is read from the environment"`
+	PasswordFile       string            `yaml:"password_file" doc:"File holding the password, relative to the config file"`
+	PasswordCommand    string            `yaml:"password_command" doc:"Command printing the password"`
+	TokenID            string            `yaml:"token_id" doc:"API token used instead of a password, as USER@REALM!NAME" schema:"pattern=^[^@!]+@[^@!]+![^@!]+$"`
+	TokenSecret        string            `yaml:"token_secret" doc:"Secret of the API token"`
+	TokenSecretFile    string            `yaml:"token_secret_file" doc:"File holding the token secret, relative to the config file"`
+	TokenSecretCommand string            `yaml:"token_secret_command" doc:"Command printing the token secret"`
+	Node               string            `yaml:"node" doc:"Node VMs are created on"`
+	VMIPBase           string            `yaml:"vm_ip_base" doc:"First three octets of synthetic VM addresses"`
+	IPDiscovery        IPDiscoveryConfig `yaml:"ip_discovery" doc:"How the address of a VM is chosen"`
+}
+
+type IPDiscoveryConfig struct {
+	Interfaces        []string `yaml:"interfaces" doc:"Preferred interfaces, in order (glob patterns)"`
+	CIDRs             []string `yaml:"cidrs" doc:"Only accept addresses inside these networks"`
+	Prefer            string   `yaml:"prefer" doc:"Preferred IP family" schema:"enum=ipv4|ipv6"`
+	SyntheticFallback bool     `yaml:"synthetic_fallback" doc:"Use vm_ip_base.(vmid+100) when no address is found"`
 }
 
 type SSHConfig struct {
-	User         string `yaml:"user"`
-	Password     string `yaml:"password"`
-	KeyPath      string `yaml:"key_path"`
-	Port         int    `yaml:"port"`
-	CopyLocalKey bool   `yaml:"copy_local_key"`
+	User            string `yaml:"user" doc:"SSH user"`
+	Password        string `yaml:"password" doc:"SSH password; ${VAR} is read from the environment"`
+	PasswordFile    string `yaml:"password_file" doc:"File holding the SSH password"`
+	PasswordCommand string `yaml:"password_command" doc:"Command printing the SSH password"`
+	KeyPath         string `yaml:"key_path" doc:"Private key used instead of the default keys"`
+	Port            int    `yaml:"port" doc:"SSH port" schema:"minimum=1,maximum=65535,example=22"`
+	CopyLocalKey    *bool  `yaml:"copy_local_key" doc:"Install the local public key on VMs"`
+}
+
+// CopiesLocalKey reports whether copy_local_key is set to true.
+func (s SSHConfig) CopiesLocalKey() bool {
+	return s.CopyLocalKey != nil && *s.CopyLocalKey
 }
 
 type VMConfig struct {
-	Name      string         `yaml:"name"`
-	VMID      int            `yaml:"vmid"`
-	Cores     int            `yaml:"cores"`
-	Memory    int            `yaml:"memory"`
-	DiskSize  string         `yaml:"disk_size"`
-	Network   NetworkConfig  `yaml:"network"`
-	Template  string         `yaml:"template"`
-	Tags      []string       `yaml:"tags"`
-	AutoStart bool           `yaml:"auto_start"`
-	SSH       SSHVMConfig    `yaml:"ssh"`
-	Scripts   []ScriptConfig `yaml:"scripts"`
+	Name       string `yaml:"name" doc:"VM name, unique in the config; with count, a pattern containing {{index}}"`
+	VMSettings `yaml:",inline"`
+	Count      *int                `yaml:"count" doc:"Number of instances of the VM, named after name with {{index}} replaced by 01, 02..." schema:"minimum=0"`
+	VMIDStart  int                 `yaml:"vmid_start" doc:"VMID of the first instance, the next ones following it" schema:"minimum=100"`
+	Instances  map[int]*VMSettings `yaml:"instances" doc:"Settings of instances by index, overriding those of the VM"`
+
+	// Set on the instances of the config: the index of their entry in vms,
+	// and for those of a VM with count, their index and settings
+	entry    int
+	index    int
+	override *VMSettings
+}
+
+// VMSettings are the settings of a VM that the instances of a VM with count
+// may override.
+type VMSettings struct {
+	VMID         VMIDSpec       `yaml:"vmid" doc:"VMID: a number, auto for the next free one, or a min-max range to allocate from"`
+	Cores        int            `yaml:"cores" doc:"CPU cores" schema:"minimum=1"`
+	Memory       int            `yaml:"memory" doc:"Memory in MB" schema:"minimum=1"`
+	DiskSize     string         `yaml:"disk_size" doc:"Size of the boot disk; a template disk is grown to it, never shrunk" schema:"pattern=^[0-9]+(\\.[0-9]+)?[KMGTkmgt]?$,example=32G"`
+	Network      NetworkConfig  `yaml:"network" doc:"First network interface"`
+	Template     string         `yaml:"template" doc:"Template cloned: VMID, name or alias of templates"`
+	Storage      string         `yaml:"storage" doc:"Storage the disks are cloned to, instead of that of the template"`
+	OSType       string         `yaml:"ostype" doc:"Guest OS type" schema:"enum=os_types"`
+	CIUser       string         `yaml:"ciuser" doc:"Cloud-init user, also the SSH user unless defaults, the VM or its instance set ssh.user"`
+	Tags         []string       `yaml:"tags" doc:"Proxmox tags"`
+	AutoStart    *bool          `yaml:"auto_start" doc:"Start the VM once created"`
+	Protected    *bool          `yaml:"protected" doc:"Refuse to delete the VM and set Proxmox protection"`
+	StartOrder   *int           `yaml:"start_order" doc:"Bulk starts and apply begin with the lowest values"`
+	DependsOn    []string       `yaml:"depends_on" doc:"VMs brought up before this one"`
+	BootOrder    *int           `yaml:"boot_order" doc:"Proxmox startup order, 0 for none" schema:"minimum=0"`
+	StartupDelay *int           `yaml:"startup_delay" doc:"Seconds to wait after starting the VM before the next ones" schema:"minimum=0"`
+	SSH          SSHVMConfig    `yaml:"ssh" doc:"SSH settings of the VM"`
+	Scripts      []ScriptConfig `yaml:"scripts" doc:"Scripts run on the VM once created, after those of ssh, defaults and the template" merge:"append"`
+}
+
+// TemplateConfig is an entry of templates: the Proxmox template and the
+// settings of the VMs cloned from it, which defaults and the VMs override. A
+// bare VMID or name stands for a template without settings.
+type TemplateConfig struct {
+	Source   string         `yaml:"source" doc:"VMID or name of the Proxmox template" schema:"required"`
+	Cores    int            `yaml:"cores" doc:"CPU cores" schema:"minimum=1"`
+	Memory   int            `yaml:"memory" doc:"Memory in MB" schema:"minimum=1"`
+	DiskSize string         `yaml:"disk_size" doc:"Size of the boot disk; the template disk is grown to it, never shrunk" schema:"pattern=^[0-9]+(\\.[0-9]+)?[KMGTkmgt]?$,example=32G"`
+	Network  NetworkConfig  `yaml:"network" doc:"First network interface"`
+	Storage  string         `yaml:"storage" doc:"Storage the disks are cloned to, instead of that of the template"`
+	OSType   string         `yaml:"ostype" doc:"Guest OS type" schema:"enum=os_types"`
+	CIUser   string         `yaml:"ciuser" doc:"Cloud-init user, also the SSH user unless the VMs or defaults set ssh.user"`
+	Scripts  []ScriptConfig `yaml:"scripts" doc:"Scripts run on the VMs once created, before their own" merge:"append"`
 }
 
 type NetworkConfig struct {
-	Bridge string `yaml:"bridge"`
-	VLAN   int    `yaml:"vlan"`
-	Model  string `yaml:"model"`
+	Bridge string `yaml:"bridge" doc:"Bridge the interface is attached to" schema:"example=vmbr0"`
+	VLAN   *int   `yaml:"vlan" doc:"VLAN tag, 0 for none" schema:"minimum=0,maximum=4094"`
+	Model  string `yaml:"model" doc:"Emulated NIC model" schema:"enum=network_models"`
 }
 
 type SSHVMConfig struct {
-	User           string   `yaml:"user"`
-	Password       string   `yaml:"password"`
-	KeyPath        string   `yaml:"key_path"`
-	AuthorizedKeys []string `yaml:"authorized_keys"`
-	CopyLocalKey   bool     `yaml:"copy_local_key"`
+	User            string   `yaml:"user" doc:"SSH user of the VM"`
+	Password        string   `yaml:"password" doc:"SSH password of the VM; ${VAR} is read from the environment"`
+	PasswordFile    string   `yaml:"password_file" doc:"File holding the SSH password of the VM" merge:"-"`
+	PasswordCommand string   `yaml:"password_command" doc:"Command printing the SSH password of the VM" merge:"-"`
+	KeyPath         string   `yaml:"key_path" doc:"Private key used to log in to the VM"`
+	AuthorizedKeys  []string `yaml:"authorized_keys" doc:"Public keys installed on the VM"`
+	CopyLocalKey    *bool    `yaml:"copy_local_key" doc:"Install the local public key on the VM"`
 }
 
 type ScriptConfig struct {
-	Name    string   `yaml:"name"`
-	Path    string   `yaml:"path"`
-	Args    []string `yaml:"args"`
-	Timeout int      `yaml:"timeout"`
+	Name    string   `yaml:"name" doc:"Name shown while the script runs"`
+	Path    string   `yaml:"path" doc:"Local script copied to the VM and run" schema:"required"`
+	Args    []string `yaml:"args" doc:"Arguments of the script"`
+	Timeout int      `yaml:"timeout" doc:"Seconds the script may run" schema:"minimum=0"`
 }
@@ -1,16 +1,30 @@
 package config
 
 import (
+	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
+	"reflect"
+	"time"
+
 	"proxima/internal/core/domain"
 	"proxima/internal/core/ports"
 
 	"gopkg.in/yaml.v3"
 )
 
+// TokenEnv is the environment variable holding an API token, in the form
+// USER@REALM!NAME=SECRET, that overrides the token of the config.
+const TokenEnv = "PROXIMA_TOKEN"
+
 type ConfigAdapter struct {
-	config *Config
+	config  *Config
+	sources *sources
+	secrets []string
+
+	// unresolved is set when the secrets were left as written, by CheckConfig
+	unresolved bool
 }
 
 func NewConfigAdapter() *ConfigAdapter {
@@ -18,32 +32,104 @@ func NewConfigAdapter() *ConfigAdapter {
 }
 
 func (c *ConfigAdapter) LoadConfig(path string) error {
-	data, err := os.ReadFile(path)
-	if err != nil {
-		return fmt.Errorf("failed to read config file: %w", err)
-	}
+	return c.LoadConfigWithContext(path, nil)
+}
+
+// LoadConfigWithContext loads the config at path, a file or a directory of
+// files, with their includes, if path is not empty. It then takes the proxmox
+// and ssh sections it lacks from context, if not nil. A config without a
+// proxmox host thus only defines VMs, and manages them on the cluster of the
+// context.
+func (c *ConfigAdapter) LoadConfigWithContext(path string, context *Context) error {
+	return c.load(path, context, false)
+}
+
+// CheckConfigWithContext loads the config at path as LoadConfigWithContext
+// does, for validate. Secrets are left as written, so checking a config needs
+// neither the environment nor the files and commands giving them. Unknown keys
+// and mistyped values do not stop the loading: Problems reports them with the
+// other problems.
+func (c *ConfigAdapter) CheckConfigWithContext(path string, context *Context) error {
+	return c.load(path, context, true)
+}
 
+func (c *ConfigAdapter) load(path string, context *Context, check bool) error {
 	var config Config
-	if err := yaml.Unmarshal(data, &config); err != nil {
-		return fmt.Errorf("failed to parse config file: %w", err)
+	var sources *sources
+	var secrets []string
+	if path != "" {
+		var err error
+		sources, err = loadSources(path, check)
+		if err != nil {
+			return err
+		}
+		// The schema reports the values of the wrong type when checking
+		var typeErr *yaml.TypeError
+		if err := sources.root.Decode(&config); err != nil && !(check && errors.As(err, &typeErr)) {
+			return domain.WrapError(domain.ErrorKindValidation, fmt.Errorf("failed to parse config file: %w", err))
+		}
+
+		// Secret files are relative to the config file, or to the config directory
+		dir := path
+		if !IsConfigDir(path) {
+			dir = filepath.Dir(path)
+		}
+		if check {
+			secrets = config.literalSecrets()
+		} else if secrets, err = config.resolveSecrets(dir); err != nil {
+			return fmt.Errorf("failed to resolve secrets: %w", err)
+		}
+	}
+
+	if context != nil {
+		if config.Proxmox.Host == "" {
+			// Keep the IP discovery settings of the config file, which are about its VMs
+			discovery := config.Proxmox.IPDiscovery
+			config.Proxmox = context.Proxmox
+			if !reflect.ValueOf(discovery).IsZero() {
+				config.Proxmox.IPDiscovery = discovery
+			}
+		}
+		if config.SSH == (SSHConfig{}) {
+			config.SSH = context.SSH
+		}
+		secrets = append(secrets, context.secrets...)
+	}
+
+	// PROXIMA_TOKEN takes precedence over the token of the config, e.g. in CI
+	if value := os.Getenv(TokenEnv); value != "" {
+		token, err := domain.ParseAPIToken(value)
+		if err != nil {
+			return fmt.Errorf("%s: %w", TokenEnv, err)
+		}
+		config.Proxmox.TokenID, config.Proxmox.TokenSecret = token.ID(), token.Secret
+		secrets = append(secrets, token.Secret)
 	}
 
 	c.config = &config
+	c.sources = sources
+	c.secrets = secrets
+	c.unresolved = check
 	return nil
 }
 
+// Secrets returns the passwords resolved by LoadConfig, for redaction.
+func (c *ConfigAdapter) Secrets() []string {
+	return c.secrets
+}
+
 func (c *ConfigAdapter) GetVMConfig(name string) (*domain.VM, error) {
 	if c.config == nil {
 		return nil, fmt.Errorf("config not loaded")
 	}
 
-	for _, vmConfig := range c.config.VMs {
+	for _, vmConfig := range c.config.instances() {
 		if vmConfig.Name == name {
 			return c.convertToDomainVM(&vmConfig), nil
 		}
 	}
 
-	return nil, fmt.Errorf("VM config with name %s not found", name)
+	return nil, domain.Errorf(domain.ErrorKindNotFound, "VM config with name %s not found", name)
 }
 
 func (c *ConfigAdapter) GetAllVMConfigs() ([]*domain.VM, error) {
@@ -52,7 +138,7 @@ func (c *ConfigAdapter) GetAllVMConfigs() ([]*domain.VM, error) {
 	}
 
 	var vms []*domain.VM
-	for _, vmConfig := range c.config.VMs {
+	for _, vmConfig := range c.config.instances() {
 		vm := c.convertToDomainVM(&vmConfig)
 		vms = append(vms, vm)
 	}
@@ -67,6 +153,19 @@ func (c *ConfigAdapter) GetProxmoxConfig() ProxmoxConfig {
 	return c.config.Proxmox
 }
 
+// GetAPIToken returns the API token of the config, if one is set.
+func (c *ConfigAdapter) GetAPIToken() (domain.APIToken, bool) {
+	if c.config == nil || c.config.Proxmox.TokenID == "" {
+		return domain.APIToken{}, false
+	}
+	token, err := domain.ParseAPITokenID(c.config.Proxmox.TokenID)
+	if err != nil {
+		return domain.APIToken{}, false
+	}
+	token.Secret = c.config.Proxmox.TokenSecret
+	return token, true
+}
+
 func (c *ConfigAdapter) GetSSHConfig() SSHConfig {
 	if c.config == nil {
 		return SSHConfig{}
@@ -74,145 +173,74 @@ func (c *ConfigAdapter) GetSSHConfig() SSHConfig {
 	return c.config.SSH
 }
 
-func (c *ConfigAdapter) ValidateConfig() error {
+func (c *ConfigAdapter) GetIPPreferences() domain.IPPreferences {
 	if c.config == nil {
-		return fmt.Errorf("configuration not loaded")
-	}
-
-	// Validate Proxmox configuration
-	if c.config.Proxmox.Host == "" {
-		return fmt.Errorf("proxmox host is required")
+		return domain.IPPreferences{}
 	}
-	if c.config.Proxmox.User == "" {
-		return fmt.Errorf("proxmox user is required")
+	discovery := c.config.Proxmox.IPDiscovery
+	return domain.IPPreferences{
+		Interfaces:        discovery.Interfaces,
+		CIDRs:             discovery.CIDRs,
+		Prefer:            domain.IPFamily(discovery.Prefer),
+		SyntheticFallback: discovery.SyntheticFallback,
 	}
-	if c.config.Proxmox.Password == "" {
-		return fmt.Errorf("proxmox password is required")
-	}
-	if c.config.Proxmox.Node == "" {
-		return fmt.Errorf("proxmox node is required")
-	}
-
-	// Validate VM configurations
-	for i, vm := range c.config.VMs {
-		if vm.Name == "" {
-			return fmt.Errorf("VM[%d]: name is required", i)
-		}
-		if vm.VMID <= 0 {
-			return fmt.Errorf("VM[%d]: vmid must be positive", i)
-		}
-
-		// Check effective values (VM specific or Default)
-		cores := vm.Cores
-		if cores == 0 {
-			cores = c.config.Defaults.Cores
-		}
-		if cores <= 0 {
-			return fmt.Errorf("VM[%d]: cores must be positive (checked VM and Defaults)", i)
-		}
-
-		memory := vm.Memory
-		if memory == 0 {
-			memory = c.config.Defaults.Memory
-		}
-		if memory <= 0 {
-			return fmt.Errorf("VM[%d]: memory must be positive (checked VM and Defaults)", i)
-		}
-
-		diskSize := vm.DiskSize
-		if diskSize == "" {
-			diskSize = c.config.Defaults.DiskSize
-		}
-		if diskSize == "" {
-			return fmt.Errorf("VM[%d]: disk_size is required (checked VM and Defaults)", i)
-		}
-
-		// Validate that Template is provided (or aliased)
-		template := vm.Template
-		if template == "" {
-			template = c.config.Defaults.Template
-		}
+}
 
-		if template == "" {
-			return fmt.Errorf("VM[%d]: template is required (checked VM and Defaults)", i)
-		}
+// ValidateConfig checks the loaded configuration and returns all its
+// problems at once. The error is a domain.ErrorKindValidation error.
+func (c *ConfigAdapter) ValidateConfig() error {
+	problems := c.Problems()
+	if len(problems) == 0 {
+		return nil
 	}
-
-	return nil
+	return domain.WrapError(domain.ErrorKindValidation, errors.Join(problems...))
 }
 
+// convertToDomainVM converts an instance of the config with its settings
+// merged as merge.go describes.
 func (c *ConfigAdapter) convertToDomainVM(vmConfig *VMConfig) *domain.VM {
-	vm := domain.NewVM(vmConfig.Name, vmConfig.VMID)
-
-	// Merge Defaults
-	defaults := c.config.Defaults
+	settings := c.merge(*vmConfig).VMSettings
+	vm := domain.NewVM(vmConfig.Name, settings.VMID.ID)
+	vm.IDRange = domain.VMIDRange{Min: settings.VMID.Min, Max: settings.VMID.Max}
 
-	vm.Cores = vmConfig.Cores
-	if vm.Cores == 0 {
-		vm.Cores = defaults.Cores
+	// Template with Alias Resolution
+	vm.Template = settings.Template
+	if template, ok := c.config.template(vm.Template); ok {
+		vm.Template = template.Source
 	}
 
-	vm.Memory = vmConfig.Memory
-	if vm.Memory == 0 {
-		vm.Memory = defaults.Memory
-	}
-
-	vm.DiskSize = vmConfig.DiskSize
-	if vm.DiskSize == "" {
-		vm.DiskSize = defaults.DiskSize
-	}
+	vm.Cores = settings.Cores
+	vm.Memory = settings.Memory
+	vm.DiskSize = settings.DiskSize
+	vm.Storage = settings.Storage
+	vm.OSType = settings.OSType
+	vm.CIUser = settings.CIUser
 
 	// Network
 	vm.Network = domain.Network{
-		Bridge: vmConfig.Network.Bridge,
-		VLAN:   vmConfig.Network.VLAN,
-		Model:  vmConfig.Network.Model,
-	}
-	if vm.Network.Bridge == "" {
-		vm.Network.Bridge = defaults.Network.Bridge
-	}
-	if vm.Network.Model == "" {
-		vm.Network.Model = defaults.Network.Model
-	}
-	if vm.Network.VLAN == 0 {
-		vm.Network.VLAN = defaults.Network.VLAN
+		Bridge: settings.Network.Bridge,
+		VLAN:   deref(settings.Network.VLAN),
+		Model:  settings.Network.Model,
 	}
 
-	// Template with Alias Resolution
-	vm.Template = vmConfig.Template
-	if vm.Template == "" {
-		vm.Template = defaults.Template
-	}
-	// Try resolve alias
-	if val, ok := c.config.Templates[vm.Template]; ok {
-		vm.Template = val
-	}
-
-	vm.Tags = vmConfig.Tags
-	if len(vm.Tags) == 0 {
-		vm.Tags = defaults.Tags
-	}
-
-	vm.AutoStart = vmConfig.AutoStart
-	// Boolean defaults are tricky, assuming false as valid default if not set manually,
-	// but if we wanted true default we'd need *bool. For now, sticking to value override if false.
+	vm.Tags = settings.Tags
+	vm.AutoStart = deref(settings.AutoStart)
+	vm.Protected = deref(settings.Protected)
+	vm.StartOrder = deref(settings.StartOrder)
+	vm.DependsOn = settings.DependsOn
+	vm.BootOrder = deref(settings.BootOrder)
+	vm.StartupDelay = time.Duration(deref(settings.StartupDelay)) * time.Second
 
 	// SSH
 	vm.SSH = domain.SSHConfig{
-		User:           vmConfig.SSH.User,
-		Password:       vmConfig.SSH.Password,
-		KeyPath:        vmConfig.SSH.KeyPath,
-		AuthorizedKeys: vmConfig.SSH.AuthorizedKeys,
-		CopyLocalKey:   vmConfig.SSH.CopyLocalKey,
+		User:           settings.SSH.User,
+		Password:       settings.SSH.Password,
+		KeyPath:        settings.SSH.KeyPath,
+		AuthorizedKeys: settings.SSH.AuthorizedKeys,
+		CopyLocalKey:   deref(settings.SSH.CopyLocalKey),
 	}
-	// Basic string merge for SSH User
-	if vm.SSH.User == "" {
-		vm.SSH.User = defaults.SSH.User
-	}
-	// Note: SSH config normally falls back to global SSH config if empty, handled in InitializeServices usually,
-	// but here we can merge VM defaults if provided.
 
-	for _, scriptConfig := range vmConfig.Scripts {
+	for _, scriptConfig := range settings.Scripts {
 		script := domain.Script{
 			Name:    scriptConfig.Name,
 			Path:    scriptConfig.Path,
@@ -225,4 +253,13 @@ func (c *ConfigAdapter) convertToDomainVM(vmConfig *VMConfig) *domain.VM {
 	return vm
 }
 
+// deref returns the value p points to, or the zero value for an unset setting.
+func deref[T any](p *T) T {
+	if p == nil {
+		var zero T
+		return zero
+	}
+	return *p
+}
+
 var _ ports.ConfigService = (*ConfigAdapter)(nil)
@@ -1,8 +1,16 @@
 package config
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
 	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
+
+	"proxima/internal/core/domain"
 )
 
 func TestConfigAdapter_LoadConfig(t *testing.T) {
@@ -32,9 +40,12 @@ vms:
       bridge: "vmbr0"
       vlan: 100
       model: "virtio"
-    os_template: "local:vztmpl/ubuntu-22.04-standard_22.04-1_amd64.tar.zst"
+    template: "ubuntu-base"
     tags: ["test"]
     auto_start: true
+    protected: true
+    start_order: 2
+    depends_on: ["test-vm-db"]
     ssh:
       user: "ubuntu"
       password: "ubuntu-password"
@@ -78,6 +89,14 @@ vms:
 		t.Errorf("Expected VM ID 100, got %d", vm.ID)
 	}
 
+	if !vm.Protected {
+		t.Error("Expected VM to be protected")
+	}
+
+	if vm.StartOrder != 2 || len(vm.DependsOn) != 1 || vm.DependsOn[0] != "test-vm-db" {
+		t.Errorf("Expected start_order 2 and depends_on [test-vm-db], got %d and %v", vm.StartOrder, vm.DependsOn)
+	}
+
 	// Test GetAllVMConfigs
 	vms, err := adapter.GetAllVMConfigs()
 	if err != nil {
@@ -157,7 +176,7 @@ vms:
       bridge: "vmbr0"
       vlan: 100
       model: "virtio"
-    os_template: "local:vztmpl/ubuntu-22.04-standard_22.04-1_amd64.tar.zst"
+    template: "ubuntu-base"
     tags: ["test"]
     auto_start: true
     ssh:
@@ -171,6 +190,97 @@ vms:
 			expectError: true,
 			errorMsg:    "name is required",
 		},
+		{
+			name: "unknown dependency",
+			config: `
+proxmox:
+  host: "test-host"
+  user: "test@pam"
+  password: "test-password"
+  node: "test-node"
+vms:
+  - name: "app"
+    vmid: 100
+    cores: 2
+    memory: 2048
+    disk_size: "20G"
+    template: "9000"
+    depends_on: ["db"]
+`,
+			expectError: true,
+			errorMsg:    "depends_on references unknown VM 'db'",
+		},
+		{
+			name: "dependency cycle",
+			config: `
+proxmox:
+  host: "test-host"
+  user: "test@pam"
+  password: "test-password"
+  node: "test-node"
+defaults:
+  cores: 2
+  memory: 2048
+  disk_size: "20G"
+  template: "9000"
+vms:
+  - name: "app"
+    depends_on: ["db"]
+  - name: "db"
+    depends_on: ["app"]
+`,
+			expectError: true,
+			errorMsg:    "cycle through VM",
+		},
+		{
+			name: "API token without user or password",
+			config: `
+proxmox:
+  host: "test-host"
+  token_id: "proxima@pve!ci"
+  token_secret: "0e8a6d42-1c7b-4b8e-a6f6-2d5c3f1b9e70"
+  node: "test-node"
+vms: []
+`,
+			expectError: false,
+		},
+		{
+			name: "API token without secret",
+			config: `
+proxmox:
+  host: "test-host"
+  token_id: "proxima@pve!ci"
+  node: "test-node"
+vms: []
+`,
+			expectError: true,
+			errorMsg:    "proxmox token_secret is required with token_id",
+		},
+		{
+			name: "invalid API token ID",
+			config: `
+proxmox:
+  host: "test-host"
+  token_id: "ci"
+  token_secret: "0e8a6d42-1c7b-4b8e-a6f6-2d5c3f1b9e70"
+  node: "test-node"
+vms: []
+`,
+			expectError: true,
+			errorMsg:    "invalid API token ID 'ci'",
+		},
+		{
+			name: "neither password nor API token",
+			config: `
+proxmox:
+  host: "test-host"
+  user: "test@pam"
+  node: "test-node"
+vms: []
+`,
+			expectError: true,
+			errorMsg:    "proxmox password or API token is required",
+		},
 	}
 
 	for _, tt := range tests {
@@ -207,6 +317,70 @@ vms:
 	}
 }
 
+func TestVMIDSpec(t *testing.T) {
+	configContent := `
+vms:
+  - name: "fixed"
+    vmid: 100
+  - name: "auto"
+    vmid: auto
+  - name: "omitted"
+  - name: "range"
+    vmid: "200-299"
+`
+
+	tmpFile, err := os.CreateTemp("", "test-config-*.yaml")
+	if err != nil {
+		t.Fatalf("Failed to create temp file: %v", err)
+	}
+	defer os.Remove(tmpFile.Name())
+
+	if _, err := tmpFile.Write([]byte(configContent)); err != nil {
+		t.Fatalf("Failed to write config content: %v", err)
+	}
+	tmpFile.Close()
+
+	adapter := NewConfigAdapter()
+	if err := adapter.LoadConfig(tmpFile.Name()); err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	vms, err := adapter.GetAllVMConfigs()
+	if err != nil {
+		t.Fatalf("Failed to get all VM configs: %v", err)
+	}
+
+	if vms[0].ID != 100 {
+		t.Errorf("Expected fixed VMID 100, got %d", vms[0].ID)
+	}
+	for _, vm := range vms[1:3] {
+		if vm.ID != 0 || !vm.IDRange.IsZero() {
+			t.Errorf("Expected VM '%s' to be auto-allocated, got ID %d range %+v", vm.Name, vm.ID, vm.IDRange)
+		}
+	}
+	if vms[3].ID != 0 || vms[3].IDRange.Min != 200 || vms[3].IDRange.Max != 299 {
+		t.Errorf("Expected range 200-299, got ID %d range %+v", vms[3].ID, vms[3].IDRange)
+	}
+}
+
+func TestVMIDSpec_Invalid(t *testing.T) {
+	tmpFile, err := os.CreateTemp("", "test-config-*.yaml")
+	if err != nil {
+		t.Fatalf("Failed to create temp file: %v", err)
+	}
+	defer os.Remove(tmpFile.Name())
+
+	if _, err := tmpFile.Write([]byte("vms:\n  - name: \"bad\"\n    vmid: \"next\"\n")); err != nil {
+		t.Fatalf("Failed to write config content: %v", err)
+	}
+	tmpFile.Close()
+
+	adapter := NewConfigAdapter()
+	if err := adapter.LoadConfig(tmpFile.Name()); err == nil {
+		t.Error("Expected error for invalid vmid, got nil")
+	}
+}
+
 func contains(s, substr string) bool {
 	return len(s) >= len(substr) && (s == substr || len(s) > len(substr) &&
 		(s[:len(substr)] == substr || s[len(s)-len(substr):] == substr ||
@@ -221,3 +395,1045 @@ func indexOf(s, substr string) int {
 	}
 	return -1
 }
+
+func TestConfigAdapter_LoadConfig_Secrets(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "pve.secret"), []byte("from-file\n"), 0600); err != nil {
+		t.Fatalf("Failed to write secret file: %v", err)
+	}
+	t.Setenv("PROXIMA_TEST_SSH_PASSWORD", "from-env")
+
+	configPath := filepath.Join(dir, "config.yaml")
+	configContent := `
+proxmox:
+  host: "test-host"
+  user: "test@pam"
+  password_file: "pve.secret"
+  node: "test-node"
+ssh:
+  user: "root"
+  password: "prefix-${PROXIMA_TEST_SSH_PASSWORD}"
+vms:
+  - name: "web"
+    ssh:
+      password_command: "echo from-command"
+`
+	if err := os.WriteFile(configPath, []byte(configContent), 0600); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	adapter := NewConfigAdapter()
+	if err := adapter.LoadConfig(configPath); err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	if got := adapter.GetProxmoxConfig().Password; got != "from-file" {
+		t.Errorf("Expected password from file, got '%s'", got)
+	}
+	if got := adapter.GetSSHConfig().Password; got != "prefix-from-env" {
+		t.Errorf("Expected password from environment, got '%s'", got)
+	}
+	if got := adapter.config.VMs[0].SSH.Password; got != "from-command" {
+		t.Errorf("Expected password from command, got '%s'", got)
+	}
+
+	want := []string{"from-file", "prefix-from-env", "from-command"}
+	if !reflect.DeepEqual(adapter.Secrets(), want) {
+		t.Errorf("Expected secrets %v, got %v", want, adapter.Secrets())
+	}
+}
+
+func TestConfigAdapter_LoadConfig_SecretErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   string
+		kind     domain.ErrorKind
+		errorMsg string
+	}{
+		{
+			name:     "unset variable",
+			config:   "proxmox:\n  password: \"${PROXIMA_TEST_UNSET}\"\n",
+			kind:     domain.ErrorKindValidation,
+			errorMsg: "proxmox.password: environment variable PROXIMA_TEST_UNSET is not set",
+		},
+		{
+			name:     "several sources",
+			config:   "ssh:\n  password: \"secret\"\n  password_command: \"echo secret\"\n",
+			kind:     domain.ErrorKindValidation,
+			errorMsg: "ssh.password: give only one of password, password_file and password_command",
+		},
+		{
+			name:     "missing file",
+			config:   "proxmox:\n  password_file: \"missing.secret\"\n",
+			kind:     domain.ErrorKindNotFound,
+			errorMsg: "proxmox.password_file",
+		},
+		{
+			name:     "failing command",
+			config:   "vms:\n  - name: \"web\"\n    ssh:\n      password_command: \"echo leaked; exit 3\"\n",
+			errorMsg: "vms[0].ssh.password_command failed: exit status 3",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configPath := filepath.Join(t.TempDir(), "config.yaml")
+			if err := os.WriteFile(configPath, []byte(tt.config), 0600); err != nil {
+				t.Fatalf("Failed to write config: %v", err)
+			}
+
+			err := NewConfigAdapter().LoadConfig(configPath)
+			if err == nil {
+				t.Fatal("Expected error, got nil")
+			}
+			if !strings.Contains(err.Error(), tt.errorMsg) {
+				t.Errorf("Expected error containing '%s', got '%s'", tt.errorMsg, err.Error())
+			}
+			if strings.Contains(err.Error(), "leaked") {
+				t.Errorf("Expected the command output to stay out of the error, got '%s'", err.Error())
+			}
+			if domain.KindOf(err) != tt.kind {
+				t.Errorf("Expected error kind '%s', got '%s'", tt.kind, domain.KindOf(err))
+			}
+		})
+	}
+}
+
+func TestConfigAdapter_LoadConfig_TokenEnv(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	configContent := "proxmox:\n  host: \"test-host\"\n  token_id: \"old@pve!ci\"\n  token_secret: \"old-secret\"\n  node: \"test-node\"\n"
+	if err := os.WriteFile(configPath, []byte(configContent), 0600); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	t.Setenv(TokenEnv, "proxima@pve!ci=new-secret")
+
+	adapter := NewConfigAdapter()
+	if err := adapter.LoadConfig(configPath); err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	token, ok := adapter.GetAPIToken()
+	if !ok || token.Credential() != "proxima@pve!ci=new-secret" {
+		t.Errorf("Expected the token of %s, got %+v", TokenEnv, token)
+	}
+	if secrets := adapter.Secrets(); len(secrets) == 0 || secrets[len(secrets)-1] != "new-secret" {
+		t.Errorf("Expected the token secret to be registered for redaction, got %v", secrets)
+	}
+
+	t.Setenv(TokenEnv, "proxima@pve!ci")
+	if err := NewConfigAdapter().LoadConfig(configPath); !errors.Is(err, domain.ErrValidation) {
+		t.Errorf("Expected a validation error for a token without secret, got %v", err)
+	}
+}
+
+func TestWriteAPIToken(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config.yaml")
+	configContent := `# Lab cluster
+proxmox:
+  host: "test-host" # primary node
+  user: "root@pam"
+  password: "${PVE_PASSWORD}"
+  token_secret: "old-secret"
+  node: "test-node"
+vms: []
+`
+	if err := os.WriteFile(configPath, []byte(configContent), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	token := domain.APIToken{User: "root@pam", Name: "proxima", Secret: "0e8a6d42-1c7b-4b8e-a6f6-2d5c3f1b9e70"}
+	if err := WriteAPIToken(configPath, token, ".proxima-token"); err != nil {
+		t.Fatalf("Failed to write API token: %v", err)
+	}
+
+	data, _ := os.ReadFile(configPath)
+	for _, want := range []string{"# Lab cluster", "# primary node", `token_id: "root@pam!proxima"`, `token_secret_file: ".proxima-token"`, `password: "${PVE_PASSWORD}"`} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("Expected config to contain '%s', got:\n%s", want, data)
+		}
+	}
+	if strings.Contains(string(data), "old-secret") {
+		t.Errorf("Expected the previous token secret to be removed, got:\n%s", data)
+	}
+
+	info, err := os.Stat(filepath.Join(dir, ".proxima-token"))
+	if err != nil || info.Mode().Perm() != 0600 {
+		t.Fatalf("Expected a secret file readable by its owner only, got %v, %v", info, err)
+	}
+
+	t.Setenv("PVE_PASSWORD", "unused")
+	adapter := NewConfigAdapter()
+	if err := adapter.LoadConfig(configPath); err != nil {
+		t.Fatalf("Failed to load updated config: %v", err)
+	}
+	if loaded, ok := adapter.GetAPIToken(); !ok || loaded.Credential() != token.Credential() {
+		t.Errorf("Expected token %s to be loaded, got %+v", token.ID(), loaded)
+	}
+}
+
+const userConfigContent = `# Clusters managed with proxima
+current_context: "lab"
+contexts:
+  lab:
+    proxmox:
+      host: "10.0.0.1"
+    ssh:
+      user: "admin"
+      port: 2222
+  prod:
+    proxmox:
+      host: "10.1.0.1"
+      port: 8006
+      user: "root@pam"
+      password_file: "prod.pass"
+      node: "pve1"
+`
+
+func writeUserConfig(t *testing.T) string {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(path, []byte(userConfigContent), 0600); err != nil {
+		t.Fatalf("Failed to write user config: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "prod.pass"), []byte("prod-password\n"), 0600); err != nil {
+		t.Fatalf("Failed to write password file: %v", err)
+	}
+	return path
+}
+
+func TestContexts(t *testing.T) {
+	contexts, err := LoadContexts(writeUserConfig(t))
+	if err != nil {
+		t.Fatalf("Failed to load contexts: %v", err)
+	}
+
+	if names := contexts.Names(); !reflect.DeepEqual(names, []string{"lab", "prod"}) {
+		t.Errorf("Expected contexts [lab prod], got %v", names)
+	}
+
+	t.Setenv(ContextEnv, "")
+	if got := contexts.Selected(""); got != "lab" {
+		t.Errorf("Expected the current context lab, got %s", got)
+	}
+	t.Setenv(ContextEnv, "prod")
+	if got := contexts.Selected(""); got != "prod" {
+		t.Errorf("Expected %s to take precedence, got %s", ContextEnv, got)
+	}
+	if got := contexts.Selected("lab"); got != "lab" {
+		t.Errorf("Expected the given context to take precedence, got %s", got)
+	}
+
+	prod, err := contexts.Get("prod")
+	if err != nil {
+		t.Fatalf("Failed to get context: %v", err)
+	}
+	if prod.Proxmox.Password != "prod-password" || !prod.UsesAPI() {
+		t.Errorf("Expected an API context with its password file read, got %+v", prod.Proxmox)
+	}
+	if lab, _ := contexts.Get("lab"); lab.UsesAPI() {
+		t.Errorf("Expected lab to be managed over SSH")
+	}
+
+	if name, ok := contexts.ByHost("10.0.0.1"); !ok || name != "lab" {
+		t.Errorf("Expected host 10.0.0.1 to be context lab, got %s", name)
+	}
+
+	if _, err := contexts.Get("staging"); !errors.Is(err, domain.ErrNotFound) {
+		t.Errorf("Expected a not found error for an unknown context, got %v", err)
+	}
+}
+
+func TestContexts_Use(t *testing.T) {
+	path := writeUserConfig(t)
+	contexts, _ := LoadContexts(path)
+
+	if err := contexts.Use("prod"); err != nil {
+		t.Fatalf("Failed to switch context: %v", err)
+	}
+	data, _ := os.ReadFile(path)
+	for _, want := range []string{"# Clusters managed with proxima", `current_context: "prod"`} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("Expected user config to contain '%s', got:\n%s", want, data)
+		}
+	}
+
+	if err := contexts.Use("staging"); !errors.Is(err, domain.ErrNotFound) {
+		t.Errorf("Expected a not found error for an unknown context, got %v", err)
+	}
+}
+
+func TestConfigAdapter_LoadConfigWithContext(t *testing.T) {
+	contexts, _ := LoadContexts(writeUserConfig(t))
+	prod, _ := contexts.Get("prod")
+
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	configContent := "proxmox:\n  ip_discovery:\n    prefer: \"ipv6\"\nvms:\n  - name: \"web\"\n    vmid: 100\n    cores: 2\n    memory: 2048\n    disk_size: \"20G\"\n    template: \"ubuntu\"\n"
+	if err := os.WriteFile(configPath, []byte(configContent), 0600); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	adapter := NewConfigAdapter()
+	if err := adapter.LoadConfigWithContext(configPath, prod); err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	proxmox := adapter.GetProxmoxConfig()
+	if proxmox.Host != "10.1.0.1" || proxmox.Node != "pve1" || proxmox.IPDiscovery.Prefer != "ipv6" {
+		t.Errorf("Expected the proxmox section of the context with the IP discovery of the file, got %+v", proxmox)
+	}
+	if err := adapter.ValidateConfig(); err != nil {
+		t.Errorf("Expected config completed by its context to be valid, got %v", err)
+	}
+	if secrets := adapter.Secrets(); !reflect.DeepEqual(secrets, []string{"prod-password"}) {
+		t.Errorf("Expected the context password to be registered for redaction, got %v", secrets)
+	}
+
+	adapter = NewConfigAdapter()
+	if err := adapter.LoadConfigWithContext("", prod); err != nil {
+		t.Fatalf("Failed to load context alone: %v", err)
+	}
+	if adapter.GetProxmoxConfig().Host != "10.1.0.1" {
+		t.Errorf("Expected the context alone to be loaded, got %+v", adapter.GetProxmoxConfig())
+	}
+}
+
+func writeFiles(t *testing.T, files map[string]string) string {
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+	return dir
+}
+
+func TestConfigAdapter_LoadConfig_Includes(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"config.yaml":    "include: [\"vms/*.yaml\"]\nproxmox:\n  host: \"test-host\"\ntemplates:\n  ubuntu: \"9000\"\ndefaults:\n  cores: 2\nvms:\n  - name: \"db\"\n    vmid: 100\n",
+		"vms/web.yaml":   "templates:\n  debian: \"9001\"\ndefaults:\n  memory: 2048\nvms:\n  - name: \"web\"\n    vmid: 101\n",
+		"vms/cache.yaml": "templates:\n  ubuntu: \"9000\"\nvms:\n  - name: \"cache\"\n",
+	})
+
+	adapter := NewConfigAdapter()
+	if err := adapter.LoadConfig(filepath.Join(dir, "config.yaml")); err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	vms, _ := adapter.GetAllVMConfigs()
+	var names []string
+	for _, vm := range vms {
+		names = append(names, vm.Name)
+	}
+	if !reflect.DeepEqual(names, []string{"db", "cache", "web"}) {
+		t.Errorf("Expected VMs [db cache web], got %v", names)
+	}
+	if len(adapter.config.Templates) != 2 {
+		t.Errorf("Expected the templates of both files, got %v", adapter.config.Templates)
+	}
+	if defaults := adapter.config.Defaults; defaults.Cores != 2 || defaults.Memory != 2048 {
+		t.Errorf("Expected the defaults of both files, got cores %d, memory %d", defaults.Cores, defaults.Memory)
+	}
+}
+
+func TestConfigAdapter_LoadConfig_Directory(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"00-cluster.yaml":     "proxmox:\n  host: \"test-host\"\n",
+		"web.yml":             "vms:\n  - name: \"web\"\n",
+		"db.yaml":             "vms:\n  - name: \"db\"\n",
+		".proxima-state.yaml": "vmids:\n  web: 100\n",
+		"notes.txt":           "not a config",
+	})
+
+	adapter := NewConfigAdapter()
+	if err := adapter.LoadConfig(dir); err != nil {
+		t.Fatalf("Failed to load config directory: %v", err)
+	}
+	if adapter.GetProxmoxConfig().Host != "test-host" {
+		t.Errorf("Expected the proxmox section of 00-cluster.yaml, got %+v", adapter.GetProxmoxConfig())
+	}
+	vms, _ := adapter.GetAllVMConfigs()
+	if len(vms) != 2 || vms[0].Name != "db" || vms[1].Name != "web" {
+		t.Errorf("Expected VMs db and web in file order, got %v", vms)
+	}
+
+	if err := NewConfigAdapter().LoadConfig(t.TempDir()); !errors.Is(err, domain.ErrNotFound) {
+		t.Errorf("Expected a not found error for a directory without config files, got %v", err)
+	}
+}
+
+func TestConfigAdapter_LoadConfig_Conflicts(t *testing.T) {
+	tests := []struct {
+		name     string
+		files    map[string]string
+		errorMsg string
+	}{
+		{
+			name:     "conflicting defaults",
+			files:    map[string]string{"a.yaml": "defaults:\n  cores: 2\n", "b.yaml": "defaults:\n  cores: 4\n"},
+			errorMsg: "defaults.cores is set in both a.yaml:2 and b.yaml:2",
+		},
+		{
+			name:     "conflicting template",
+			files:    map[string]string{"a.yaml": "templates:\n  ubuntu: \"9000\"\n", "b.yaml": "\ntemplates:\n  ubuntu: \"9001\"\n"},
+			errorMsg: "templates.ubuntu is set in both a.yaml:2 and b.yaml:3",
+		},
+		{
+			name:     "duplicate name",
+			files:    map[string]string{"a.yaml": "vms:\n  - name: \"web\"\n", "b.yaml": "vms:\n  - name: \"db\"\n  - name: \"web\"\n"},
+			errorMsg: "b.yaml:3:11: vms[2].name: web is already used by vms[0] (a.yaml:2)",
+		},
+		{
+			name:     "duplicate vmid",
+			files:    map[string]string{"a.yaml": "vms:\n  - name: \"web\"\n    vmid: 100\n", "b.yaml": "vms:\n  - name: \"db\"\n    vmid: 100\n"},
+			errorMsg: "b.yaml:3:11: vms[1].vmid: 100 is already used by vms[0] web (a.yaml:2)",
+		},
+		{
+			name:     "missing include",
+			files:    map[string]string{"a.yaml": "include: [\"common.yaml\"]\n"},
+			errorMsg: "common.yaml does not exist",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := writeFiles(t, tt.files)
+			adapter := NewConfigAdapter()
+			err := adapter.LoadConfig(dir)
+			if err == nil {
+				err = adapter.ValidateConfig()
+			}
+			if err == nil {
+				t.Fatalf("Expected error containing '%s', got nil", tt.errorMsg)
+			}
+			message := strings.ReplaceAll(err.Error(), dir+string(filepath.Separator), "")
+			if !strings.Contains(message, tt.errorMsg) {
+				t.Errorf("Expected error containing '%s', got '%s'", tt.errorMsg, message)
+			}
+		})
+	}
+}
+
+func TestConfigAdapter_LoadConfig_UnknownKeys(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"config.yaml": "proxmox:\n  host: \"test-host\"\n  nod: \"pve\"\nvms:\n  - name: \"web\"\n    memroy: 2048\n",
+	})
+
+	err := NewConfigAdapter().LoadConfig(filepath.Join(dir, "config.yaml"))
+	if !errors.Is(err, domain.ErrValidation) {
+		t.Fatalf("Expected a validation error, got %v", err)
+	}
+	message := strings.ReplaceAll(err.Error(), dir+string(filepath.Separator), "")
+	for _, want := range []string{"config.yaml:3: unknown key nod", "config.yaml:6: unknown key memroy"} {
+		if !strings.Contains(message, want) {
+			t.Errorf("Expected error containing '%s', got '%s'", want, message)
+		}
+	}
+}
+
+func TestConfigAdapter_Problems(t *testing.T) {
+	configContent := `proxmox:
+  host: "test-host"
+  user: "root@pam"
+  password: "secret"
+  node: "pve"
+defaults:
+  disk_size: "32G"
+  template: "9000"
+  network:
+    model: "virtio-net"
+vms:
+  - name: "web"
+    vmid: 100
+    cores: 2
+    memory: 2048
+    disk_size: "big"
+    network:
+      model: "virtio"
+      vlan: 5000
+  - name: "db"
+    vmid: 101
+    cores: 2
+    memory: 2048
+    scripts:
+      - name: "setup"
+`
+	dir := writeFiles(t, map[string]string{"config.yaml": configContent})
+
+	adapter := NewConfigAdapter()
+	if err := adapter.LoadConfig(filepath.Join(dir, "config.yaml")); err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	var got []string
+	for _, problem := range adapter.Problems() {
+		got = append(got, strings.ReplaceAll(problem.Error(), dir+string(filepath.Separator), ""))
+	}
+	want := []string{
+		"config.yaml:10:12: defaults.network.model: unknown value 'virtio-net' (expected one of " + strings.Join(domain.NetworkModels, ", ") + ")",
+		"config.yaml:16:16: vms[0].disk_size: invalid value 'big' (expected e.g. 32G)",
+		"config.yaml:19:13: vms[0].network.vlan: 5000 is above the maximum 4094",
+		"config.yaml:25:9: vms[1].scripts[0]: path is required",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected problems:\n%s\ngot:\n%s", strings.Join(want, "\n"), strings.Join(got, "\n"))
+	}
+
+	if err := adapter.ValidateConfig(); !errors.Is(err, domain.ErrValidation) {
+		t.Errorf("Expected a validation error, got %v", err)
+	}
+}
+
+func TestConfigAdapter_CheckConfig(t *testing.T) {
+	configContent := `proxmox:
+  host: "test-host"
+  user: "root@pam"
+  password: "${PROXIMA_TEST_UNSET}"
+  node: "pve"
+ssh:
+  password: "literal"
+  password_command: "touch ran"
+defaults:
+  cores: 2
+  disk_size: "32G"
+  template: "9000"
+vms:
+  - name: "web"
+    memroy: 2048
+    memory: 1024
+    vmid: "next"
+    network:
+      vlan: 5000
+`
+	dir := writeFiles(t, map[string]string{"config.yaml": configContent})
+
+	// Loading refuses the unknown key before anything else is checked
+	if err := NewConfigAdapter().LoadConfig(filepath.Join(dir, "config.yaml")); !errors.Is(err, domain.ErrValidation) {
+		t.Fatalf("Expected a validation error, got %v", err)
+	}
+
+	adapter := NewConfigAdapter()
+	if err := adapter.CheckConfigWithContext(filepath.Join(dir, "config.yaml"), nil); err != nil {
+		t.Fatalf("Failed to check config: %v", err)
+	}
+	var got []string
+	for _, problem := range adapter.Problems() {
+		got = append(got, strings.ReplaceAll(problem.Error(), dir+string(filepath.Separator), ""))
+	}
+	want := []string{
+		"config.yaml:15:5: vms[0]: unknown key memroy",
+		"config.yaml:17:11: vms[0].vmid: invalid value 'next' (expected e.g. auto)",
+		"config.yaml:19:13: vms[0].network.vlan: 5000 is above the maximum 4094",
+		"config.yaml:7:3: ssh.password: give only one of password, password_file and password_command",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected problems:\n%s\ngot:\n%s", strings.Join(want, "\n"), strings.Join(got, "\n"))
+	}
+
+	// Secrets are left as written: no variable, file or command is needed
+	if _, err := os.Stat(filepath.Join(dir, "ran")); !os.IsNotExist(err) {
+		t.Errorf("Expected password_command not to run, got %v", err)
+	}
+	if got := adapter.GetProxmoxConfig().Password; got != "${PROXIMA_TEST_UNSET}" {
+		t.Errorf("Expected the password as written, got %q", got)
+	}
+	if secrets := adapter.Secrets(); !reflect.DeepEqual(secrets, []string{"literal"}) {
+		t.Errorf("Expected the literal password for redaction, got %v", secrets)
+	}
+}
+
+func TestConfigAdapter_CheckConfig_PasswordRequired(t *testing.T) {
+	tests := []struct {
+		name     string
+		password string
+		want     bool
+	}{
+		{"password file", "  password_file: \"missing\"\n", false},
+		{"password command", "  password_command: \"pass show pve\"\n", false},
+		{"none", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := writeFiles(t, map[string]string{
+				"config.yaml": "proxmox:\n  host: \"pve\"\n  user: \"root@pam\"\n  node: \"pve\"\n" + tt.password,
+			})
+			adapter := NewConfigAdapter()
+			if err := adapter.CheckConfigWithContext(filepath.Join(dir, "config.yaml"), nil); err != nil {
+				t.Fatalf("Failed to check config: %v", err)
+			}
+			required := false
+			for _, problem := range adapter.Problems() {
+				required = required || strings.Contains(problem.Error(), "proxmox password or API token is required")
+			}
+			if required != tt.want {
+				t.Errorf("Expected password required %v, got %v", tt.want, required)
+			}
+		})
+	}
+}
+
+const replicasConfig = `proxmox:
+  host: "test-host"
+  user: "root@pam"
+  password: "secret"
+  node: "pve"
+defaults:
+  cores: 2
+  memory: 2048
+  disk_size: "32G"
+  template: "9000"
+vms:
+  - name: "db"
+    vmid: 100
+  - name: "web-{{index}}"
+    count: 3
+    vmid_start: 200
+    tags: ["web"]
+    network:
+      bridge: "vmbr0"
+    depends_on: ["db"]
+    instances:
+      2:
+        memory: 8192
+        network:
+          vlan: 20
+      3:
+        vmid: 250
+`
+
+func TestConfigAdapter_Replicas(t *testing.T) {
+	dir := writeFiles(t, map[string]string{"config.yaml": replicasConfig})
+
+	adapter := NewConfigAdapter()
+	if err := adapter.LoadConfig(filepath.Join(dir, "config.yaml")); err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if err := adapter.ValidateConfig(); err != nil {
+		t.Fatalf("Expected a valid config, got %v", err)
+	}
+
+	vms, _ := adapter.GetAllVMConfigs()
+	var got []string
+	for _, vm := range vms {
+		got = append(got, fmt.Sprintf("%s %d %d %s/%d %v %v", vm.Name, vm.ID, vm.Memory, vm.Network.Bridge, vm.Network.VLAN, vm.Tags, vm.DependsOn))
+	}
+	want := []string{
+		"db 100 2048 /0 [] []",
+		"web-01 200 2048 vmbr0/0 [web] [db]",
+		"web-02 201 8192 vmbr0/20 [web] [db]",
+		"web-03 250 2048 vmbr0/0 [web] [db]",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected VMs:\n%s\ngot:\n%s", strings.Join(want, "\n"), strings.Join(got, "\n"))
+	}
+
+	if vm, err := adapter.GetVMConfig("web-02"); err != nil || vm.ID != 201 {
+		t.Errorf("Expected web-02 with VMID 201, got %v, %v", vm, err)
+	}
+	groups := adapter.Groups()
+	if len(groups) != 1 || groups[0].Name != "web" || groups[0].Count != 3 {
+		t.Errorf("Expected the group web of 3 instances, got %v", groups)
+	}
+}
+
+func TestConfigAdapter_Replicas_Problems(t *testing.T) {
+	tests := []struct {
+		name    string
+		vm      string
+		problem string
+	}{
+		{"NoIndex", "name: \"web\"\n    count: 2", "vms[0].name: must contain {{index}} with count"},
+		{"NoCount", "name: \"web-{{index}}\"", "vms[0]: count is required with {{index}} in name"},
+		{"InstancesWithoutCount", "name: \"web\"\n    vmid_start: 200", "vms[0]: vmid_start and instances require count"},
+		{"SharedVMID", "name: \"web-{{index}}\"\n    count: 2\n    vmid: 200", "vms[0].vmid: 200 cannot be shared by 2 instances (use vmid_start, auto or a range)"},
+		{"VMIDAndStart", "name: \"web-{{index}}\"\n    count: 2\n    vmid: 200\n    vmid_start: 300", "vms[0]: vmid_start and vmid cannot both be set"},
+		{"InstanceVMID", "name: \"web-{{index}}\"\n    count: 2\n    vmid_start: 200\n    instances:\n      2:\n        vmid: 200", "vms[0].vmid: 200 is already used by vms[0] web-{{index}}"},
+		{"InstanceIndex", "name: \"web-{{index}}\"\n    count: 2\n    instances:\n      0:\n        cores: 4", "vms[0].instances: 0 is not an instance index (they start at 1)"},
+		{"SelfDependency", "name: \"web-{{index}}\"\n    count: 2\n    depends_on: [\"web-01\"]", "vms[0]: depends_on lists the VM itself"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configContent := "proxmox:\n  host: \"test-host\"\n  user: \"root@pam\"\n  password: \"secret\"\n  node: \"pve\"\n" +
+				"defaults:\n  cores: 2\n  memory: 2048\n  disk_size: \"32G\"\n  template: \"9000\"\nvms:\n  - " + tt.vm + "\n"
+			adapter := NewConfigAdapter()
+			if err := adapter.LoadConfig(filepath.Join(writeFiles(t, map[string]string{"config.yaml": configContent}), "config.yaml")); err != nil {
+				t.Fatalf("Failed to load config: %v", err)
+			}
+
+			var problems []string
+			for _, problem := range adapter.Problems() {
+				problems = append(problems, problem.Error())
+			}
+			found := false
+			for _, problem := range problems {
+				found = found || strings.Contains(problem, tt.problem)
+			}
+			if !found {
+				t.Errorf("Expected problem %q, got %v", tt.problem, problems)
+			}
+		})
+	}
+}
+
+func TestConfigAdapter_Scale(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"config.yaml": "include: [\"web.yaml\"]\nvms:\n  - name: \"db\"\n    vmid: 100\n  - name: \"api-{{index}}\"\n    count: 1\n",
+		"web.yaml":    "vms:\n  # Front ends\n  - name: \"web-{{index}}\"\n    count: 3\n    vmid_start: 200\n",
+	})
+	path := filepath.Join(dir, "config.yaml")
+
+	adapter := NewConfigAdapter()
+	if err := adapter.LoadConfig(path); err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	group, err := adapter.Scale("web", 12)
+	if err != nil {
+		t.Fatalf("Failed to scale: %v", err)
+	}
+	if group.Count != 3 {
+		t.Errorf("Expected the previous count 3, got %d", group.Count)
+	}
+
+	data, _ := os.ReadFile(filepath.Join(dir, "web.yaml"))
+	if !strings.Contains(string(data), "count: 12\n") || !strings.Contains(string(data), "# Front ends") {
+		t.Errorf("Expected web.yaml to keep its comment and count 12, got:\n%s", data)
+	}
+	if err := adapter.LoadConfig(path); err != nil {
+		t.Fatalf("Failed to reload config: %v", err)
+	}
+	if vms, _ := adapter.GetAllVMConfigs(); len(vms) != 14 {
+		t.Errorf("Expected 14 VMs after scaling, got %d", len(vms))
+	}
+
+	if _, err := adapter.Scale("db", 2); !errors.Is(err, domain.ErrNotFound) {
+		t.Errorf("Expected a not found error for a VM without count, got %v", err)
+	}
+}
+
+func TestConfigAdapter_Templates(t *testing.T) {
+	configContent := `proxmox:
+  host: "test-host"
+  user: "root@pam"
+  password: "secret"
+  node: "pve"
+templates:
+  debian: "9001"
+  ubuntu:
+    source: "9000"
+    cores: 2
+    memory: 1024
+    disk_size: "20G"
+    network:
+      bridge: "vmbr1"
+      model: "e1000"
+    storage: "local-lvm"
+    ostype: "l26"
+    ciuser: "ubuntu"
+    scripts:
+      - path: "base.sh"
+defaults:
+  memory: 2048
+  network:
+    bridge: "vmbr0"
+  template: "ubuntu"
+vms:
+  - name: "web"
+    cores: 4
+    scripts:
+      - path: "web.sh"
+  - name: "db"
+    template: "debian"
+    cores: 2
+    disk_size: "50G"
+`
+	dir := writeFiles(t, map[string]string{"config.yaml": configContent})
+
+	adapter := NewConfigAdapter()
+	if err := adapter.LoadConfig(filepath.Join(dir, "config.yaml")); err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if err := adapter.ValidateConfig(); err != nil {
+		t.Fatalf("Expected a valid config, got %v", err)
+	}
+
+	// The VM wins over the template, which wins over defaults
+	web, _ := adapter.GetVMConfig("web")
+	got := fmt.Sprintf("%s %d %d %s %s/%s %s %s %s %s", web.Template, web.Cores, web.Memory, web.DiskSize, web.Network.Bridge, web.Network.Model, web.Storage, web.OSType, web.CIUser, web.SSH.User)
+	if want := "9000 4 1024 20G vmbr1/e1000 local-lvm l26 ubuntu ubuntu"; got != want {
+		t.Errorf("Expected web to be %q, got %q", want, got)
+	}
+	if len(web.Scripts) != 2 || web.Scripts[0].Path != "base.sh" || web.Scripts[1].Path != "web.sh" {
+		t.Errorf("Expected the template script before the VM script, got %v", web.Scripts)
+	}
+
+	db, _ := adapter.GetVMConfig("db")
+	if db.Template != "9001" || db.Storage != "" || len(db.Scripts) != 0 {
+		t.Errorf("Expected db to be cloned from 9001 without the ubuntu settings, got %s %q %v", db.Template, db.Storage, db.Scripts)
+	}
+
+	aliases := adapter.TemplateAliases()
+	if !reflect.DeepEqual(aliases, map[string]string{"debian": "9001", "ubuntu": "9000"}) {
+		t.Errorf("Expected the aliases debian and ubuntu, got %v", aliases)
+	}
+}
+
+func TestConfigAdapter_Templates_Problems(t *testing.T) {
+	tests := []struct {
+		name      string
+		templates string
+		problem   string
+	}{
+		{"UnknownKey", "ubuntu:\n    source: \"9000\"\n    memroy: 1024", "config.yaml:6: unknown key memroy"},
+		{"UnknownNestedKey", "ubuntu:\n    source: \"9000\"\n    network:\n      bridg: \"vmbr0\"", "config.yaml:7: unknown key bridg"},
+		{"NoSource", "ubuntu:\n    cores: 2", "config.yaml:5:5: templates.ubuntu: source is required"},
+		{"OSType", "ubuntu:\n    source: \"9000\"\n    ostype: \"linux\"", "config.yaml:6:13: templates.ubuntu.ostype: unknown value 'linux'"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := writeFiles(t, map[string]string{"config.yaml": "proxmox:\n  host: \"test-host\"\ntemplates:\n  " + tt.templates + "\n"})
+
+			var problems []string
+			adapter := NewConfigAdapter()
+			if err := adapter.LoadConfig(filepath.Join(dir, "config.yaml")); err != nil {
+				problems = append(problems, err.Error())
+			} else {
+				for _, problem := range adapter.Problems() {
+					problems = append(problems, problem.Error())
+				}
+			}
+			joined := strings.ReplaceAll(strings.Join(problems, "\n"), dir+string(filepath.Separator), "")
+			if !strings.Contains(joined, tt.problem) {
+				t.Errorf("Expected problem %q, got:\n%s", tt.problem, joined)
+			}
+		})
+	}
+}
+
+func TestConfigAdapter_Merge(t *testing.T) {
+	configContent := `proxmox:
+  host: "test-host"
+  user: "root@pam"
+  password: "secret"
+  node: "pve"
+ssh:
+  user: "admin"
+  password: "global-secret"
+  key_path: "~/.ssh/global"
+  copy_local_key: true
+defaults:
+  cores: 2
+  memory: 1024
+  disk_size: "10G"
+  template: "9000"
+  auto_start: true
+  protected: true
+  network:
+    bridge: "vmbr0"
+    vlan: 10
+  ssh:
+    authorized_keys: ["ssh-ed25519 AAAA team"]
+  scripts:
+    - path: "base.sh"
+vms:
+  - name: "web"
+    scripts:
+      - path: "web.sh"
+  - name: "db"
+    auto_start: false
+    protected: null
+    network:
+      vlan: 0
+    ssh:
+      user: "postgres"
+      copy_local_key: false
+    scripts: []
+`
+	dir := writeFiles(t, map[string]string{"config.yaml": configContent})
+
+	adapter := NewConfigAdapter()
+	if err := adapter.LoadConfig(filepath.Join(dir, "config.yaml")); err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if err := adapter.ValidateConfig(); err != nil {
+		t.Fatalf("Expected a valid config, got %v", err)
+	}
+
+	web, _ := adapter.GetVMConfig("web")
+	if !web.AutoStart || !web.Protected || web.Network.VLAN != 10 {
+		t.Errorf("Expected web to inherit auto_start, protected and vlan 10, got %v %v %d", web.AutoStart, web.Protected, web.Network.VLAN)
+	}
+	wantSSH := domain.SSHConfig{User: "admin", Password: "global-secret", KeyPath: "~/.ssh/global", AuthorizedKeys: []string{"ssh-ed25519 AAAA team"}, CopyLocalKey: true}
+	if !reflect.DeepEqual(web.SSH, wantSSH) {
+		t.Errorf("Expected web to merge the ssh settings into %+v, got %+v", wantSSH, web.SSH)
+	}
+	if len(web.Scripts) != 2 || web.Scripts[0].Path != "base.sh" || web.Scripts[1].Path != "web.sh" {
+		t.Errorf("Expected the scripts of defaults before those of web, got %v", web.Scripts)
+	}
+
+	// Explicit false and 0 override defaults, null inherits them, [] clears
+	db, _ := adapter.GetVMConfig("db")
+	if db.AutoStart || !db.Protected || db.Network.VLAN != 0 || db.Network.Bridge != "vmbr0" {
+		t.Errorf("Expected db not to auto start, to be protected and on vmbr0 without vlan, got %v %v %s %d", db.AutoStart, db.Protected, db.Network.Bridge, db.Network.VLAN)
+	}
+	if db.SSH.User != "postgres" || db.SSH.CopyLocalKey || db.SSH.KeyPath != "~/.ssh/global" {
+		t.Errorf("Expected db to log in as postgres without copying the local key, got %+v", db.SSH)
+	}
+	if len(db.Scripts) != 0 {
+		t.Errorf("Expected no scripts for db, got %v", db.Scripts)
+	}
+}
+
+func TestConfigAdapter_Merge_GlobalFalse(t *testing.T) {
+	configContent := `proxmox:
+  host: "test-host"
+  user: "root@pam"
+  password: "secret"
+  node: "pve"
+ssh:
+  copy_local_key: false
+defaults:
+  cores: 2
+  memory: 1024
+  disk_size: "10G"
+  template: "9000"
+vms:
+  - name: "web"
+  - name: "db"
+    ssh:
+      copy_local_key: true
+`
+	dir := writeFiles(t, map[string]string{"config.yaml": configContent})
+
+	adapter := NewConfigAdapter()
+	if err := adapter.LoadConfig(filepath.Join(dir, "config.yaml")); err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if ssh := adapter.GetSSHConfig(); ssh.CopyLocalKey == nil || ssh.CopiesLocalKey() {
+		t.Errorf("Expected an explicit global copy_local_key: false, got %v", ssh.CopyLocalKey)
+	}
+
+	settings, err := adapter.EffectiveSettings("web")
+	if err != nil {
+		t.Fatalf("Failed to get the settings: %v", err)
+	}
+	found := false
+	for _, setting := range settings {
+		if setting.Key == "ssh.copy_local_key" {
+			found = true
+			if setting.Value != "false" || !strings.HasPrefix(setting.Source, "ssh") {
+				t.Errorf("Expected copy_local_key false from ssh, got %s from %s", setting.Value, setting.Source)
+			}
+		}
+	}
+	if !found {
+		t.Error("Expected the global copy_local_key: false among the settings of web")
+	}
+
+	db, _ := adapter.GetVMConfig("db")
+	if !db.SSH.CopyLocalKey {
+		t.Error("Expected db to override the global copy_local_key")
+	}
+}
+
+func TestConfigAdapter_EffectiveSettings(t *testing.T) {
+	configContent := `proxmox:
+  host: "test-host"
+  user: "root@pam"
+  password: "secret"
+  node: "pve"
+ssh:
+  password: "global-secret"
+templates:
+  ubuntu:
+    source: "9000"
+    memory: 1024
+    ciuser: "ubuntu"
+defaults:
+  disk_size: "10G"
+  template: "ubuntu"
+  auto_start: true
+  scripts:
+    - path: "base.sh"
+vms:
+  - name: "web-{{index}}"
+    count: 2
+    vmid_start: 200
+    cores: 2
+    instances:
+      2:
+        cores: 4
+        scripts:
+          - path: "web.sh"
+`
+	dir := writeFiles(t, map[string]string{"config.yaml": configContent})
+
+	adapter := NewConfigAdapter()
+	if err := adapter.LoadConfig(filepath.Join(dir, "config.yaml")); err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	settings, err := adapter.EffectiveSettings("web-02")
+	if err != nil {
+		t.Fatalf("Failed to get the settings: %v", err)
+	}
+
+	var got []string
+	for _, setting := range settings {
+		source := strings.ReplaceAll(setting.Source, dir+string(filepath.Separator), "")
+		got = append(got, fmt.Sprintf("%s=%s from %s", setting.Key, setting.Value, source))
+	}
+	want := []string{
+		"name=web-02 from vms[0] (config.yaml:20)",
+		"vmid=201 from vms[0] (config.yaml:22)",
+		"cores=4 from vms[0].instances.2 (config.yaml:26)",
+		"memory=1024 from templates.ubuntu (config.yaml:11)",
+		"disk_size=10G from defaults (config.yaml:14)",
+		"template=ubuntu (9000) from defaults (config.yaml:15)",
+		"ciuser=ubuntu from templates.ubuntu (config.yaml:12)",
+		"auto_start=true from defaults (config.yaml:16)",
+		"ssh.user=ubuntu from templates.ubuntu (config.yaml:12)",
+		"ssh.password=[REDACTED] from ssh (config.yaml:7)",
+		"scripts=base.sh,web.sh from defaults (config.yaml:18), vms[0].instances.2 (config.yaml:28)",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected the settings:\n%s\ngot:\n%s", strings.Join(want, "\n"), strings.Join(got, "\n"))
+	}
+
+	if _, err := adapter.EffectiveSettings("web-03"); !errors.Is(err, domain.ErrNotFound) {
+		t.Errorf("Expected a not found error for web-03, got %v", err)
+	}
+}
+
+func TestSchema_UpToDate(t *testing.T) {
+	want, err := json.MarshalIndent(Schema(), "", "  ")
+	if err != nil {
+		t.Fatalf("Failed to marshal schema: %v", err)
+	}
+	got, err := os.ReadFile("../../../../schema/config.schema.json")
+	if err != nil {
+		t.Fatalf("Failed to read published schema: %v", err)
+	}
+	if strings.TrimSpace(string(got)) != string(want) {
+		t.Errorf("Expected schema/config.schema.json to match the config structs, run make schema")
+	}
+}
+
+func TestSchema_Descriptions(t *testing.T) {
+	var walk func(path string, schema *JSONSchema)
+	walk = func(path string, schema *JSONSchema) {
+		for name, property := range schema.Properties {
+			if property.Description == "" {
+				t.Errorf("Expected a doc tag on %s", joinPath(path, name))
+			}
+			walk(joinPath(path, name), property)
+		}
+		if schema.Items != nil {
+			walk(path+"[]", schema.Items)
+		}
+	}
+	walk("", Schema())
+}
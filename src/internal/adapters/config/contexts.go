@@ -0,0 +1,151 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"proxima/internal/core/domain"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ContextEnv is the environment variable naming the context to use, which
+// takes precedence over the current context of the user config.
+const ContextEnv = "PROXIMA_CONTEXT"
+
+// Context is a named Proxmox cluster of the user config: how to reach it
+// through the API and how to log in to it over SSH.
+type Context struct {
+	Proxmox ProxmoxConfig `yaml:"proxmox"`
+	SSH     SSHConfig     `yaml:"ssh"`
+
+	secrets []string
+}
+
+// Contexts is the user config, listing the clusters proxima manages.
+type Contexts struct {
+	Current  string             `yaml:"current_context"`
+	Contexts map[string]Context `yaml:"contexts"`
+
+	path string
+}
+
+// UserConfigPath returns the path of the user config:
+// $XDG_CONFIG_HOME/proxima/config.yaml, by default ~/.config/proxima/config.yaml.
+func UserConfigPath() string {
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		dir = filepath.Join(home, ".config")
+	}
+	return filepath.Join(dir, "proxima", "config.yaml")
+}
+
+// LoadContexts reads the user config at path. A missing file has no contexts.
+func LoadContexts(path string) (*Contexts, error) {
+	contexts := &Contexts{path: path}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return contexts, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read user config: %w", err)
+	}
+	if err := decodeStrict(data, contexts); err != nil {
+		return nil, decodeError(path, err)
+	}
+	return contexts, nil
+}
+
+// Names returns the names of the contexts, sorted.
+func (c *Contexts) Names() []string {
+	names := make([]string, 0, len(c.Contexts))
+	for name := range c.Contexts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Selected returns the name of the context to use: name when given, else
+// PROXIMA_CONTEXT, else the current context. It is empty when none is set.
+func (c *Contexts) Selected(name string) string {
+	if name != "" {
+		return name
+	}
+	if env := os.Getenv(ContextEnv); env != "" {
+		return env
+	}
+	return c.Current
+}
+
+// Get returns the context called name with its secrets resolved, relative to
+// the user config for password files.
+func (c *Contexts) Get(name string) (*Context, error) {
+	context, ok := c.Contexts[name]
+	if !ok {
+		return nil, domain.Errorf(domain.ErrorKindNotFound, "context %s not found in %s", name, c.path)
+	}
+
+	config := Config{Proxmox: context.Proxmox, SSH: context.SSH}
+	secrets, err := config.resolveSecrets(filepath.Dir(c.path))
+	if err != nil {
+		return nil, fmt.Errorf("context %s: %w", name, err)
+	}
+	context.Proxmox, context.SSH, context.secrets = config.Proxmox, config.SSH, secrets
+	return &context, nil
+}
+
+// Unresolved returns the context called name as written, its secrets not
+// resolved, for checks that must not need them.
+func (c *Contexts) Unresolved(name string) (*Context, error) {
+	context, ok := c.Contexts[name]
+	if !ok {
+		return nil, domain.Errorf(domain.ErrorKindNotFound, "context %s not found in %s", name, c.path)
+	}
+	return &context, nil
+}
+
+// ByHost returns the name of the context whose Proxmox host is host.
+func (c *Contexts) ByHost(host string) (string, bool) {
+	for _, name := range c.Names() {
+		if c.Contexts[name].Proxmox.Host == host {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// Use makes name the current context and records it in the user config,
+// keeping its comments.
+func (c *Contexts) Use(name string) error {
+	if _, ok := c.Contexts[name]; !ok {
+		return domain.Errorf(domain.ErrorKindNotFound, "context %s not found in %s", name, c.path)
+	}
+	err := editFile(c.path, func(root *yaml.Node) error {
+		setKey(root, "current_context", name)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	c.Current = name
+	return nil
+}
+
+// UsesAPI reports whether the context has API credentials; without them its
+// host is managed over SSH.
+func (c *Context) UsesAPI() bool {
+	return c.Proxmox.User != "" || c.Proxmox.TokenID != ""
+}
+
+// Secrets returns the passwords resolved by Get, for redaction.
+func (c *Context) Secrets() []string {
+	return c.secrets
+}
@@ -0,0 +1,266 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"proxima/internal/core/domain"
+
+	"gopkg.in/yaml.v3"
+)
+
+// sources reads the config at path, a file or a directory, with the files it
+// includes, and merges them into a single YAML mapping. It remembers the file
+// each node comes from to report conflicts and duplicates.
+type sources struct {
+	root   *yaml.Node
+	files  map[*yaml.Node]string
+	loaded map[string]bool
+
+	// check leaves decoding problems, such as unknown keys, to the schema
+	check bool
+}
+
+// loadSources reads a config file, or the .yaml and .yml files of a directory
+// in name order, skipping hidden ones such as the state file. Files list the
+// files to merge with theirs under include, as globs relative to themselves.
+//
+// Mappings are merged key by key, and the vms of every file are put together.
+// A key given different values in two files is an error. With check, files
+// are loaded despite unknown keys and mistyped values, which the schema reports.
+func loadSources(path string, check bool) (*sources, error) {
+	s := &sources{
+		root:   &yaml.Node{Kind: yaml.MappingNode},
+		files:  make(map[*yaml.Node]string),
+		loaded: make(map[string]bool),
+		check:  check,
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, domain.WrapError(domain.ErrorKindNotFound, fmt.Errorf("failed to read config file: %w", err))
+		}
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+	if !info.IsDir() {
+		return s, s.load(path)
+	}
+
+	files, err := configFiles(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, domain.Errorf(domain.ErrorKindNotFound, "no .yaml or .yml config file in %s", path)
+	}
+	for _, file := range files {
+		if err := s.load(file); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// IsConfigDir reports whether path is a directory of config files.
+func IsConfigDir(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
+
+func configFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config directory: %w", err)
+	}
+	var files []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || strings.HasPrefix(name, ".") {
+			continue
+		}
+		if ext := filepath.Ext(name); ext == ".yaml" || ext == ".yml" {
+			files = append(files, filepath.Join(dir, name))
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+func (s *sources) load(file string) error {
+	if abs, err := filepath.Abs(file); err == nil {
+		if s.loaded[abs] {
+			return nil
+		}
+		s.loaded[abs] = true
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return domain.WrapError(domain.ErrorKindNotFound, fmt.Errorf("failed to read config file: %w", err))
+		}
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return domain.WrapError(domain.ErrorKindValidation, fmt.Errorf("failed to parse config file %s: %w", file, err))
+	}
+	if doc.Kind == 0 {
+		return nil
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return domain.Errorf(domain.ErrorKindValidation, "config file %s is not a YAML mapping", file)
+	}
+
+	// Decoding each file alone names the file in errors; unknown keys, such
+	// as misspelled ones, are errors rather than ignored
+	var config Config
+	var typeErr *yaml.TypeError
+	if err := decodeStrict(data, &config); err != nil && !(s.check && errors.As(err, &typeErr)) {
+		return decodeError(file, err)
+	}
+	s.record(root, file)
+
+	removeInclude(root)
+	if err := s.merge(s.root, root, ""); err != nil {
+		return err
+	}
+
+	for _, pattern := range config.Include {
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(filepath.Dir(file), pattern)
+		}
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return domain.WrapError(domain.ErrorKindValidation, fmt.Errorf("%s: invalid include %s: %w", file, pattern, err))
+		}
+		if len(matches) == 0 && !hasGlobMeta(pattern) {
+			return domain.Errorf(domain.ErrorKindNotFound, "%s: included file %s does not exist", file, pattern)
+		}
+		sort.Strings(matches)
+		for _, match := range matches {
+			if err := s.load(match); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s *sources) record(node *yaml.Node, file string) {
+	s.files[node] = file
+	for _, child := range node.Content {
+		s.record(child, file)
+	}
+}
+
+// removeInclude removes the include key of a file, which only concerns it.
+func removeInclude(root *yaml.Node) {
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if root.Content[i].Value == "include" {
+			root.Content = append(root.Content[:i], root.Content[i+2:]...)
+			return
+		}
+	}
+}
+
+func hasGlobMeta(pattern string) bool {
+	return strings.ContainsAny(pattern, `*?[\`)
+}
+
+// merge adds the keys of the mapping src to dst; key is the path of both.
+func (s *sources) merge(dst, src *yaml.Node, key string) error {
+	for i := 0; i+1 < len(src.Content); i += 2 {
+		name, value := src.Content[i].Value, src.Content[i+1]
+		path := name
+		if key != "" {
+			path = key + "." + name
+		}
+
+		existing := mappingEntry(dst, name)
+		switch {
+		case existing == nil:
+			dst.Content = append(dst.Content, src.Content[i], value)
+		case path == "vms" && existing.Kind == yaml.SequenceNode && value.Kind == yaml.SequenceNode:
+			existing.Content = append(existing.Content, value.Content...)
+		case existing.Kind == yaml.MappingNode && value.Kind == yaml.MappingNode:
+			if err := s.merge(existing, value, path); err != nil {
+				return err
+			}
+		case !sameValue(existing, value):
+			return domain.Errorf(domain.ErrorKindValidation, "%s is set in both %s and %s", path, s.position(existing), s.position(value))
+		}
+	}
+	return nil
+}
+
+func mappingEntry(mapping *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return mapping.Content[i+1]
+		}
+	}
+	return nil
+}
+
+func sameValue(a, b *yaml.Node) bool {
+	if a.Kind != b.Kind || a.Value != b.Value || len(a.Content) != len(b.Content) {
+		return false
+	}
+	for i := range a.Content {
+		if !sameValue(a.Content[i], b.Content[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// position returns the file and line of node, as file:line.
+func (s *sources) position(node *yaml.Node) string {
+	return fmt.Sprintf("%s:%d", s.files[node], node.Line)
+}
+
+func decodeStrict(data []byte, out any) error {
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(out); err != nil && err != io.EOF {
+		return err
+	}
+	return nil
+}
+
+var decodeProblem = regexp.MustCompile(`^line (\d+): (?:field (\S+) not found in type \S+|(.*))$`)
+
+// decodeError reports every problem of a decoding error as file:line: problem.
+func decodeError(file string, err error) error {
+	var messages []string
+	if typeErr, ok := err.(*yaml.TypeError); ok {
+		messages = typeErr.Errors
+	} else {
+		messages = []string{err.Error()}
+	}
+
+	problems := make([]error, len(messages))
+	for i, message := range messages {
+		match := decodeProblem.FindStringSubmatch(strings.TrimPrefix(message, "yaml: "))
+		switch {
+		case match == nil:
+			problems[i] = fmt.Errorf("%s: %s", file, message)
+		case match[2] != "":
+			problems[i] = fmt.Errorf("%s:%s: unknown key %s", file, match[1], match[2])
+		default:
+			problems[i] = fmt.Errorf("%s:%s: %s", file, match[1], match[3])
+		}
+	}
+	return domain.WrapError(domain.ErrorKindValidation, errors.Join(problems...))
+}
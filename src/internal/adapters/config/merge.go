@@ -0,0 +1,261 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"proxima/internal/core/domain"
+
+	"gopkg.in/yaml.v3"
+)
+
+// The settings of a VM are merged from up to five levels, each overriding
+// those before it:
+//
+//  1. ssh, the global SSH settings, for the ssh settings of the VM
+//  2. defaults
+//  3. the entry of templates the VM is cloned from
+//  4. the entry of vms
+//  5. the settings of the instance, for a VM with count
+//
+// A setting comes from the last level setting it, and the settings of network
+// and ssh are merged one by one. Scripts add up instead, in the order of the
+// levels, and an empty list drops those of the levels before. The cloud-init
+// user is also the SSH user, unless a level other than ssh sets ssh.user.
+
+// level is a level of settings and the path to it in the config.
+type level struct {
+	name     string
+	path     []any
+	settings VMSettings
+}
+
+// origin is the level a setting comes from and its node, when the config was
+// read from files.
+type origin struct {
+	level string
+	node  *yaml.Node
+}
+
+// merged are the effective settings of a VM and their origins by key, such
+// as network.bridge. Scripts have one origin per level adding some.
+type merged struct {
+	VMSettings
+	origins map[string][]origin
+}
+
+// levels returns the levels of settings of vm, an instance of the config.
+func (c *ConfigAdapter) levels(vm VMConfig) []level {
+	global := c.config.SSH
+	ssh := VMSettings{SSH: SSHVMConfig{
+		User:         global.User,
+		Password:     global.Password,
+		KeyPath:      global.KeyPath,
+		CopyLocalKey: global.CopyLocalKey,
+	}}
+	defaults := c.config.Defaults.VMSettings
+	levels := []level{{name: "ssh", settings: ssh}, {name: "defaults", path: []any{"defaults"}, settings: defaults}}
+
+	alias := defaults.Template
+	if vm.Template != "" {
+		alias = vm.Template
+	}
+	if vm.override != nil && vm.override.Template != "" {
+		alias = vm.override.Template
+	}
+	if template, ok := c.config.template(alias); ok {
+		levels = append(levels, level{name: "templates." + alias, path: []any{"templates", alias}, settings: template.settings()})
+	}
+
+	entry := fmt.Sprintf("vms[%d]", vm.entry)
+	levels = append(levels, level{name: entry, path: []any{"vms", vm.entry}, settings: vm.VMSettings})
+	if vm.override != nil {
+		index := strconv.Itoa(vm.index)
+		levels = append(levels, level{name: entry + ".instances." + index, path: []any{"vms", vm.entry, "instances", index}, settings: *vm.override})
+	}
+	return levels
+}
+
+// settings returns the VM settings of the template.
+func (t TemplateConfig) settings() VMSettings {
+	return VMSettings{
+		Cores:    t.Cores,
+		Memory:   t.Memory,
+		DiskSize: t.DiskSize,
+		Network:  t.Network,
+		Storage:  t.Storage,
+		OSType:   t.OSType,
+		CIUser:   t.CIUser,
+		Scripts:  t.Scripts,
+	}
+}
+
+// merge returns the effective settings of vm, an instance of the config.
+func (c *ConfigAdapter) merge(vm VMConfig) merged {
+	v := &validator{sources: c.sources}
+	m := merged{origins: make(map[string][]origin)}
+	for _, l := range c.levels(vm) {
+		mergeFields(reflect.ValueOf(&m.VMSettings).Elem(), reflect.ValueOf(l.settings), "", func(key string, added bool) {
+			path := append(append([]any{}, l.path...), splitKey(key)...)
+			o := origin{level: l.name}
+			if node, ok := v.lookup(path...); ok {
+				o.node = node
+			}
+			if added {
+				m.origins[key] = append(m.origins[key], o)
+			} else {
+				m.origins[key] = []origin{o}
+			}
+		})
+	}
+
+	// The VMID of an instance comes from vmid_start
+	if c.config.VMs[vm.entry].VMIDStart != 0 {
+		for i, o := range m.origins["vmid"] {
+			if o.level == fmt.Sprintf("vms[%d]", vm.entry) {
+				m.origins["vmid"][i].node = v.at("vms", vm.entry, "vmid_start")
+			}
+		}
+	}
+
+	if user := m.origins["ssh.user"]; m.CIUser != "" && (len(user) == 0 || user[0].level == "ssh") {
+		m.SSH.User = m.CIUser
+		m.origins["ssh.user"] = m.origins["ciuser"]
+	}
+	return m
+}
+
+// node returns the node of the setting with the given key, from the last
+// level setting it, or fallback when it is unknown.
+func (m merged) node(key string, fallback *yaml.Node) *yaml.Node {
+	if origins := m.origins[key]; len(origins) > 0 && origins[len(origins)-1].node != nil {
+		return origins[len(origins)-1].node
+	}
+	return fallback
+}
+
+// mergeFields sets the fields of dst that are set in src, calling set with
+// the dotted key of each and whether src added to the list already in dst.
+func mergeFields(dst, src reflect.Value, prefix string, set func(key string, added bool)) {
+	t := src.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+		value, target, key := src.Field(i), dst.Field(i), prefix+name
+		switch merge := field.Tag.Get("merge"); {
+		case merge == "-" || name == "":
+		case value.Kind() == reflect.Struct && value.Type() != vmidType:
+			mergeFields(target, value, key+".", set)
+		case merge == "append" && value.Len() > 0 && target.Len() > 0:
+			// A new list, not to append to the backing array of the config
+			list := reflect.MakeSlice(value.Type(), 0, target.Len()+value.Len())
+			target.Set(reflect.AppendSlice(reflect.AppendSlice(list, target), value))
+			set(key, true)
+		case !value.IsZero():
+			target.Set(value)
+			set(key, false)
+		}
+	}
+}
+
+func splitKey(key string) []any {
+	var path []any
+	for _, part := range strings.Split(key, ".") {
+		path = append(path, part)
+	}
+	return path
+}
+
+// EffectiveSettings returns the settings of the VM with the given name once
+// merged, in the order of the config structure, each with the level it comes
+// from. Passwords are redacted.
+func (c *ConfigAdapter) EffectiveSettings(name string) ([]domain.Setting, error) {
+	if c.config == nil {
+		return nil, fmt.Errorf("config not loaded")
+	}
+	for _, vm := range c.config.instances() {
+		if vm.Name != name {
+			continue
+		}
+		v := &validator{sources: c.sources}
+		m := c.merge(vm)
+		settings := []domain.Setting{{
+			Key:    "name",
+			Value:  vm.Name,
+			Source: source(v, []origin{{level: fmt.Sprintf("vms[%d]", vm.entry), node: v.at("vms", vm.entry, "name")}}),
+		}}
+		walkFields(reflect.ValueOf(m.VMSettings), "", func(key string, value reflect.Value) {
+			origins, ok := m.origins[key]
+			if !ok {
+				return
+			}
+			setting := domain.Setting{Key: key, Value: settingValue(value), Source: source(v, origins)}
+			switch {
+			case strings.HasSuffix(key, "password"):
+				setting.Value = "[REDACTED]"
+			case key == "template":
+				if template, ok := c.config.template(m.Template); ok {
+					setting.Value = fmt.Sprintf("%s (%s)", m.Template, template.Source)
+				}
+			}
+			settings = append(settings, setting)
+		})
+		return settings, nil
+	}
+	return nil, domain.Errorf(domain.ErrorKindNotFound, "VM %s not found in config", name)
+}
+
+// walkFields calls fn with the dotted key and value of every setting of v.
+func walkFields(v reflect.Value, prefix string, fn func(key string, value reflect.Value)) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("yaml"), ",")
+		value := v.Field(i)
+		switch {
+		case name == "":
+		case value.Kind() == reflect.Struct && value.Type() != vmidType:
+			walkFields(value, prefix+name+".", fn)
+		default:
+			fn(prefix+name, value)
+		}
+	}
+}
+
+// settingValue formats a setting for display.
+func settingValue(value reflect.Value) string {
+	switch value := value.Interface().(type) {
+	case VMIDSpec:
+		return value.String()
+	case []string:
+		if len(value) == 0 {
+			return "[]"
+		}
+		return strings.Join(value, ",")
+	case []ScriptConfig:
+		if len(value) == 0 {
+			return "[]"
+		}
+		paths := make([]string, len(value))
+		for i, script := range value {
+			paths[i] = script.Path
+		}
+		return strings.Join(paths, ",")
+	}
+	if value.Kind() == reflect.Pointer {
+		value = value.Elem()
+	}
+	return fmt.Sprint(value.Interface())
+}
+
+// source describes the origins of a setting: their levels, with the position
+// of the setting when known. A password read from a file or a command has
+// none.
+func source(v *validator, origins []origin) string {
+	parts := make([]string, len(origins))
+	for i, o := range origins {
+		parts[i] = o.level + v.position(o.node)
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,115 @@
+package config
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+
+	"proxima/internal/core/domain"
+
+	"gopkg.in/yaml.v3"
+)
+
+// group returns the group of instances of vm, which must have a count.
+func (vm VMConfig) group() domain.VMGroup {
+	group := domain.NewVMGroup(vm.Name, *vm.Count)
+	group.VMIDStart = vm.VMIDStart
+	return group
+}
+
+// instances returns the VMs that vm, at index entry of vms, stands for: vm
+// itself, or with a count, its instances, named after their index and
+// numbered from vmid_start. Their own settings are merged with those of vm.
+func (vm VMConfig) instances(entry int) []VMConfig {
+	if vm.Count == nil {
+		vm.entry = entry
+		return []VMConfig{vm}
+	}
+	group := vm.group()
+	instances := make([]VMConfig, 0, group.Count)
+	for index := 1; index <= group.Count; index++ {
+		instance := VMConfig{Name: group.InstanceName(index), VMSettings: vm.VMSettings, entry: entry, index: index, override: vm.Instances[index]}
+		if vm.VMIDStart != 0 {
+			instance.VMID = VMIDSpec{ID: vm.VMIDStart + index - 1}
+		}
+		instances = append(instances, instance)
+	}
+	return instances
+}
+
+// instances returns the VMs of the config, with the instances of those with a
+// count in place of them.
+func (c *Config) instances() []VMConfig {
+	var instances []VMConfig
+	for i, vm := range c.VMs {
+		instances = append(instances, vm.instances(i)...)
+	}
+	return instances
+}
+
+// instanceIndexes returns the indexes of the instance settings of vm, in order.
+func (vm VMConfig) instanceIndexes() []int {
+	indexes := make([]int, 0, len(vm.Instances))
+	for index := range vm.Instances {
+		indexes = append(indexes, index)
+	}
+	slices.Sort(indexes)
+	return indexes
+}
+
+// Groups returns the VMs of the config that have a count.
+func (c *ConfigAdapter) Groups() []domain.VMGroup {
+	if c.config == nil {
+		return nil
+	}
+	var groups []domain.VMGroup
+	for _, vm := range c.config.VMs {
+		if vm.Count != nil {
+			groups = append(groups, vm.group())
+		}
+	}
+	return groups
+}
+
+// Scale sets the count of the group with the given name, or name pattern, in
+// the config file defining it, and returns the group as it was.
+func (c *ConfigAdapter) Scale(name string, count int) (domain.VMGroup, error) {
+	if c.config == nil || c.sources == nil {
+		return domain.VMGroup{}, fmt.Errorf("config not loaded")
+	}
+	if count < 0 {
+		return domain.VMGroup{}, domain.Errorf(domain.ErrorKindValidation, "invalid count %d", count)
+	}
+
+	for i, vm := range c.config.VMs {
+		if vm.Count == nil || (vm.group().Name != name && vm.Name != name) {
+			continue
+		}
+		v := &validator{sources: c.sources}
+		file := c.sources.files[v.at("vms", i)]
+		err := editFile(file, func(root *yaml.Node) error {
+			vms := mappingEntry(root, "vms")
+			if vms == nil || vms.Kind != yaml.SequenceNode {
+				return fmt.Errorf("no vms in %s", file)
+			}
+			for _, item := range vms.Content {
+				if item.Kind != yaml.MappingNode {
+					continue
+				}
+				if entry := mappingEntry(item, "name"); entry != nil && entry.Value == vm.Name {
+					// The count is set in place, keeping its comments
+					value := mappingEntry(item, "count")
+					if value == nil {
+						value = &yaml.Node{}
+						setKeyNode(item, "count", value)
+					}
+					value.Kind, value.Tag, value.Style, value.Value = yaml.ScalarNode, "!!int", 0, strconv.Itoa(count)
+					return nil
+				}
+			}
+			return fmt.Errorf("VM %s not found in %s", vm.Name, file)
+		})
+		return vm.group(), err
+	}
+	return domain.VMGroup{}, domain.Errorf(domain.ErrorKindNotFound, "no VM group %s in the config (a VM with count)", name)
+}
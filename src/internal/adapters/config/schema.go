@@ -0,0 +1,263 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"proxima/internal/core/domain"
+
+	"gopkg.in/yaml.v3"
+)
+
+// SchemaURL is the JSON Schema dialect of Schema.
+const SchemaURL = "https://json-schema.org/draft/2020-12/schema"
+
+// enums are the lists of values schema tags can refer to by name.
+var enums = map[string][]string{
+	"network_models": domain.NetworkModels,
+	"os_types":       domain.OSTypes,
+}
+
+// JSONSchema is the subset of JSON Schema describing config files.
+type JSONSchema struct {
+	Schema               string                 `json:"$schema,omitempty"`
+	Title                string                 `json:"title,omitempty"`
+	Description          string                 `json:"description,omitempty"`
+	Type                 string                 `json:"type,omitempty"`
+	Properties           map[string]*JSONSchema `json:"properties,omitempty"`
+	AdditionalProperties any                    `json:"additionalProperties,omitempty"`
+	PropertyNames        *JSONSchema            `json:"propertyNames,omitempty"`
+	Required             []string               `json:"required,omitempty"`
+	Items                *JSONSchema            `json:"items,omitempty"`
+	OneOf                []*JSONSchema          `json:"oneOf,omitempty"`
+	Enum                 []string               `json:"enum,omitempty"`
+	Pattern              string                 `json:"pattern,omitempty"`
+	Minimum              *int                   `json:"minimum,omitempty"`
+	Maximum              *int                   `json:"maximum,omitempty"`
+	Examples             []any                  `json:"examples,omitempty"`
+}
+
+// Schema returns the JSON Schema of config files, generated from Config and
+// the doc and schema tags of its fields.
+func Schema() *JSONSchema {
+	schema := schemaOf(reflect.TypeOf(Config{}))
+	schema.Schema = SchemaURL
+	schema.Title = "proxima config"
+	schema.Description = "VMs managed by proxima and the Proxmox cluster they live on"
+	return schema
+}
+
+var (
+	vmidType     = reflect.TypeOf(VMIDSpec{})
+	templateType = reflect.TypeOf(TemplateConfig{})
+)
+
+func schemaOf(t reflect.Type) *JSONSchema {
+	switch {
+	case t == vmidType:
+		return &JSONSchema{OneOf: []*JSONSchema{
+			{Type: "integer"},
+			{Type: "string", Pattern: `^(auto|[0-9]+|[0-9]+-[0-9]+)$`, Examples: []any{"auto", "200-299"}},
+		}}
+	case t == templateType:
+		return &JSONSchema{OneOf: []*JSONSchema{{Type: "string"}, structSchema(t)}}
+	case t.Kind() == reflect.String:
+		return &JSONSchema{Type: "string"}
+	case t.Kind() == reflect.Int:
+		return &JSONSchema{Type: "integer"}
+	case t.Kind() == reflect.Bool:
+		return &JSONSchema{Type: "boolean"}
+	case t.Kind() == reflect.Slice:
+		return &JSONSchema{Type: "array", Items: schemaOf(t.Elem())}
+	case t.Kind() == reflect.Pointer:
+		return schemaOf(t.Elem())
+	case t.Kind() == reflect.Map:
+		schema := &JSONSchema{Type: "object", AdditionalProperties: schemaOf(t.Elem())}
+		if t.Key().Kind() == reflect.Int {
+			schema.PropertyNames = &JSONSchema{Type: "string", Pattern: `^[0-9]+$`}
+		}
+		return schema
+	case t.Kind() == reflect.Struct:
+		return structSchema(t)
+	}
+	panic(fmt.Sprintf("config: no JSON Schema for %s", t))
+}
+
+// structSchema returns the schema of a struct from the yaml, doc and schema
+// tags of its fields. Inline fields add their own.
+func structSchema(t reflect.Type) *JSONSchema {
+	schema := &JSONSchema{Type: "object", Properties: make(map[string]*JSONSchema), AdditionalProperties: false}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, options, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+		if options == "inline" {
+			inline := schemaOf(field.Type)
+			for name, property := range inline.Properties {
+				schema.Properties[name] = property
+			}
+			schema.Required = append(schema.Required, inline.Required...)
+			continue
+		}
+		if name == "" || name == "-" {
+			continue
+		}
+		property := schemaOf(field.Type)
+		property.Description = field.Tag.Get("doc")
+		if applyConstraints(property, field.Tag.Get("schema")) {
+			schema.Required = append(schema.Required, name)
+		}
+		schema.Properties[name] = property
+	}
+	return schema
+}
+
+// applyConstraints sets the constraints of a schema tag on schema, and
+// reports whether the tag makes the field required. Constraints are separated
+// by commas, so patterns cannot contain any.
+func applyConstraints(schema *JSONSchema, tag string) bool {
+	required := false
+	for _, constraint := range strings.Split(tag, ",") {
+		key, value, _ := strings.Cut(constraint, "=")
+		switch key {
+		case "":
+		case "required":
+			required = true
+		case "minimum", "maximum":
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				panic(fmt.Sprintf("config: invalid schema %s %q", key, value))
+			}
+			if key == "minimum" {
+				schema.Minimum = &n
+			} else {
+				schema.Maximum = &n
+			}
+		case "pattern":
+			schema.Pattern = value
+		case "example":
+			schema.Examples = append(schema.Examples, value)
+		case "enum":
+			if values, ok := enums[value]; ok {
+				schema.Enum = values
+			} else {
+				schema.Enum = strings.Split(value, "|")
+			}
+		default:
+			panic(fmt.Sprintf("config: unknown schema constraint %q", key))
+		}
+	}
+	return required
+}
+
+// check reports, through report, the values of node that do not satisfy
+// schema. path names node in messages.
+func (s *JSONSchema) check(node *yaml.Node, path string, report func(node *yaml.Node, format string, args ...any)) {
+	if node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+	if node.Kind == yaml.ScalarNode && node.Tag == "!!null" {
+		return
+	}
+
+	if len(s.OneOf) > 0 {
+		// A mapping can only be the object option, whose problems say more
+		// than the value being invalid
+		for _, option := range s.OneOf {
+			if option.Type == "object" && node.Kind == yaml.MappingNode {
+				option.check(node, path, report)
+				return
+			}
+		}
+		for _, option := range s.OneOf {
+			valid := true
+			option.check(node, path, func(*yaml.Node, string, ...any) { valid = false })
+			if valid {
+				return
+			}
+		}
+		report(node, "%s: invalid value '%s'%s", path, node.Value, s.OneOf[len(s.OneOf)-1].hint())
+		return
+	}
+
+	switch s.Type {
+	case "object":
+		if node.Kind != yaml.MappingNode {
+			report(node, "%s: expected a mapping", path)
+			return
+		}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i].Value, node.Content[i+1]
+			property, ok := s.Properties[key]
+			if !ok {
+				property, ok = s.AdditionalProperties.(*JSONSchema)
+				if ok && s.PropertyNames != nil {
+					s.PropertyNames.check(node.Content[i], joinPath(path, key), report)
+				}
+			}
+			if !ok {
+				report(node.Content[i], "%s: unknown key %s", path, key)
+				continue
+			}
+			property.check(value, joinPath(path, key), report)
+		}
+		for _, key := range s.Required {
+			if mappingEntry(node, key) == nil {
+				report(node, "%s: %s is required", path, key)
+			}
+		}
+	case "array":
+		if node.Kind != yaml.SequenceNode {
+			report(node, "%s: expected a list", path)
+			return
+		}
+		for i, item := range node.Content {
+			s.Items.check(item, fmt.Sprintf("%s[%d]", path, i), report)
+		}
+	case "integer":
+		n, err := strconv.Atoi(node.Value)
+		if node.Kind != yaml.ScalarNode || node.Tag != "!!int" || err != nil {
+			report(node, "%s: expected an integer", path)
+			return
+		}
+		if s.Minimum != nil && n < *s.Minimum {
+			report(node, "%s: %d is below the minimum %d", path, n, *s.Minimum)
+		}
+		if s.Maximum != nil && n > *s.Maximum {
+			report(node, "%s: %d is above the maximum %d", path, n, *s.Maximum)
+		}
+	case "boolean":
+		if node.Kind != yaml.ScalarNode || node.Tag != "!!bool" {
+			report(node, "%s: expected true or false", path)
+		}
+	case "string":
+		if node.Kind != yaml.ScalarNode {
+			report(node, "%s: expected a string", path)
+			return
+		}
+		if len(s.Enum) > 0 && !slices.Contains(s.Enum, node.Value) {
+			report(node, "%s: unknown value '%s' (expected one of %s)", path, node.Value, strings.Join(s.Enum, ", "))
+		}
+		if s.Pattern != "" && !regexp.MustCompile(s.Pattern).MatchString(node.Value) {
+			report(node, "%s: invalid value '%s'%s", path, node.Value, s.hint())
+		}
+	}
+}
+
+// hint returns " (expected e.g. <example>)" for a schema with examples.
+func (s *JSONSchema) hint() string {
+	if len(s.Examples) == 0 {
+		return ""
+	}
+	return fmt.Sprintf(" (expected e.g. %v)", s.Examples[0])
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
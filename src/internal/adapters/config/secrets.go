@@ -0,0 +1,187 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"proxima/internal/core/domain"
+)
+
+// secretCommandTimeout bounds a password_command, which may wait for a prompt.
+const secretCommandTimeout = time.Minute
+
+var envReference = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// commandOutputs caches the output of each password_command, so that a command
+// prompting for a passphrase runs once even when the config is loaded again.
+var commandOutputs = struct {
+	sync.Mutex
+	values map[string]string
+}{values: make(map[string]string)}
+
+// secret is a secret field of the config, with the ways it may be given:
+// <field>, <field>_file or <field>_command.
+type secret struct {
+	field   string
+	value   *string
+	file    string
+	command string
+}
+
+func (c *Config) secrets() []secret {
+	secrets := []secret{
+		{"proxmox.password", &c.Proxmox.Password, c.Proxmox.PasswordFile, c.Proxmox.PasswordCommand},
+		{"proxmox.token_secret", &c.Proxmox.TokenSecret, c.Proxmox.TokenSecretFile, c.Proxmox.TokenSecretCommand},
+		{"ssh.password", &c.SSH.Password, c.SSH.PasswordFile, c.SSH.PasswordCommand},
+		{"defaults.ssh.password", &c.Defaults.SSH.Password, c.Defaults.SSH.PasswordFile, c.Defaults.SSH.PasswordCommand},
+	}
+	for i := range c.VMs {
+		ssh := &c.VMs[i].SSH
+		secrets = append(secrets, secret{fmt.Sprintf("vms[%d].ssh.password", i), &ssh.Password, ssh.PasswordFile, ssh.PasswordCommand})
+		for _, index := range c.VMs[i].instanceIndexes() {
+			if c.VMs[i].Instances[index] == nil {
+				continue
+			}
+			ssh := &c.VMs[i].Instances[index].SSH
+			secrets = append(secrets, secret{fmt.Sprintf("vms[%d].instances.%d.ssh.password", i, index), &ssh.Password, ssh.PasswordFile, ssh.PasswordCommand})
+		}
+	}
+	return secrets
+}
+
+// resolveSecrets replaces every secret field by its value and returns the
+// values found. ${VAR} references are expanded from the environment, the
+// _file variant is read, relative to dir, and the _command variant is run
+// through sh -c; a trailing newline is dropped from both.
+func (c *Config) resolveSecrets(dir string) ([]string, error) {
+	var values []string
+	for _, s := range c.secrets() {
+		value, err := s.resolve(dir)
+		if err != nil {
+			return nil, err
+		}
+		*s.value = value
+		if value != "" {
+			values = append(values, value)
+		}
+	}
+	return values, nil
+}
+
+// literalSecrets returns the secret values written in the config itself, for
+// redaction when the secrets are not resolved.
+func (c *Config) literalSecrets() []string {
+	var values []string
+	for _, s := range c.secrets() {
+		if *s.value != "" && !envReference.MatchString(*s.value) {
+			values = append(values, *s.value)
+		}
+	}
+	return values
+}
+
+// given returns the number of ways the secret is given.
+func (s secret) given() int {
+	given := 0
+	for _, source := range []string{*s.value, s.file, s.command} {
+		if source != "" {
+			given++
+		}
+	}
+	return given
+}
+
+// conflict describes a secret given more than one way.
+func (s secret) conflict() string {
+	key := s.field[strings.LastIndex(s.field, ".")+1:]
+	return fmt.Sprintf("%s: give only one of %s, %s_file and %s_command", s.field, key, key, key)
+}
+
+func (s secret) resolve(dir string) (string, error) {
+	if s.given() > 1 {
+		return "", domain.Errorf(domain.ErrorKindValidation, "%s", s.conflict())
+	}
+
+	switch {
+	case s.file != "":
+		return readSecretFile(s.field, s.file, dir)
+	case s.command != "":
+		return runSecretCommand(s.field, s.command)
+	}
+	return expandEnv(s.field, *s.value)
+}
+
+// expandEnv replaces the ${VAR} references of value. Unset variables are an
+// error rather than an empty password.
+func expandEnv(field, value string) (string, error) {
+	var missing []string
+	expanded := envReference.ReplaceAllStringFunc(value, func(reference string) string {
+		name := envReference.FindStringSubmatch(reference)[1]
+		env, ok := os.LookupEnv(name)
+		if !ok {
+			missing = append(missing, name)
+		}
+		return env
+	})
+	if len(missing) > 0 {
+		return "", domain.Errorf(domain.ErrorKindValidation, "%s: environment variable %s is not set", field, strings.Join(missing, ", "))
+	}
+	return expanded, nil
+}
+
+func readSecretFile(field, path, dir string) (string, error) {
+	if rest, ok := strings.CutPrefix(path, "~/"); ok {
+		if home, err := os.UserHomeDir(); err == nil {
+			path = filepath.Join(home, rest)
+		}
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(dir, path)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", domain.WrapError(domain.ErrorKindNotFound, fmt.Errorf("%s_file: %w", field, err))
+		}
+		return "", fmt.Errorf("%s_file: %w", field, err)
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// runSecretCommand runs command and returns its output. Its stderr and stdin
+// stay attached to the terminal, for password managers that prompt; its
+// output never appears in errors.
+func runSecretCommand(field, command string) (string, error) {
+	commandOutputs.Lock()
+	defer commandOutputs.Unlock()
+	if value, ok := commandOutputs.values[command]; ok {
+		return value, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), secretCommandTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.Stdin = os.Stdin
+	cmd.Stderr = os.Stderr
+	output, err := cmd.Output()
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return "", domain.Errorf(domain.ErrorKindTimeout, "%s_command did not finish within %s", field, secretCommandTimeout)
+	}
+	if err != nil {
+		return "", fmt.Errorf("%s_command failed: %w", field, err)
+	}
+
+	value := strings.TrimRight(string(output), "\r\n")
+	commandOutputs.values[command] = value
+	return value, nil
+}
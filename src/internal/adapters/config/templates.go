@@ -0,0 +1,92 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// UnmarshalYAML accepts a bare VMID or name, or a mapping with the source and
+// the settings of the template.
+func (t *TemplateConfig) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		*t = TemplateConfig{Source: node.Value}
+		return nil
+	}
+	type plain TemplateConfig
+	return decodeNode(node, (*plain)(t))
+}
+
+// template returns the entry of templates with the given alias.
+func (c *Config) template(alias string) (TemplateConfig, bool) {
+	template, ok := c.Templates[alias]
+	return template, ok
+}
+
+// TemplateAliases returns the VMID or name each template alias refers to.
+func (c *ConfigAdapter) TemplateAliases() map[string]string {
+	aliases := make(map[string]string)
+	if c.config == nil {
+		return aliases
+	}
+	for alias, template := range c.config.Templates {
+		aliases[alias] = template.Source
+	}
+	return aliases
+}
+
+// decodeNode decodes node into out, reporting unknown keys as decodeStrict
+// does: yaml.v3 does not pass KnownFields on to custom unmarshalers.
+func decodeNode(node *yaml.Node, out any) error {
+	if problems := unknownKeys(node, reflect.TypeOf(out).Elem()); len(problems) > 0 {
+		return &yaml.TypeError{Errors: problems}
+	}
+	return node.Decode(out)
+}
+
+// unknownKeys returns a problem for every key of node that t has no field
+// for, in the words of yaml.v3.
+func unknownKeys(node *yaml.Node, t reflect.Type) []string {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch {
+	case t.Kind() == reflect.Slice && node.Kind == yaml.SequenceNode:
+		var problems []string
+		for _, item := range node.Content {
+			problems = append(problems, unknownKeys(item, t.Elem())...)
+		}
+		return problems
+	case t.Kind() != reflect.Struct || node.Kind != yaml.MappingNode:
+		return nil
+	}
+
+	fields := make(map[string]reflect.Type)
+	var collect func(t reflect.Type)
+	collect = func(t reflect.Type) {
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			name, options, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+			if options == "inline" {
+				collect(field.Type)
+			} else if name != "" && name != "-" {
+				fields[name] = field.Type
+			}
+		}
+	}
+	collect(t)
+
+	var problems []string
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key := node.Content[i]
+		fieldType, ok := fields[key.Value]
+		if !ok {
+			problems = append(problems, fmt.Sprintf("line %d: field %s not found in type %s", key.Line, key.Value, t))
+			continue
+		}
+		problems = append(problems, unknownKeys(node.Content[i+1], fieldType)...)
+	}
+	return problems
+}
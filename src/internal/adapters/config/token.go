@@ -0,0 +1,117 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"proxima/internal/core/domain"
+
+	"gopkg.in/yaml.v3"
+)
+
+// WriteAPIToken records token in a config file. Its secret is written to
+// secretFile, relative to the config file and readable by its owner only, and
+// the proxmox section refers to it with token_id and token_secret_file. Other
+// token settings are removed; comments and the rest of the file are kept.
+func WriteAPIToken(configPath string, token domain.APIToken, secretFile string) error {
+	secretPath := secretFile
+	if !filepath.IsAbs(secretPath) {
+		secretPath = filepath.Join(filepath.Dir(configPath), secretPath)
+	}
+
+	return editFile(configPath, func(root *yaml.Node) error {
+		proxmox := mappingValue(root, "proxmox")
+		removeKey(proxmox, "token_secret")
+		removeKey(proxmox, "token_secret_command")
+		setKey(proxmox, "token_id", token.ID())
+		setKey(proxmox, "token_secret_file", secretFile)
+
+		if err := os.WriteFile(secretPath, []byte(token.Secret+"\n"), 0600); err != nil {
+			return fmt.Errorf("failed to write token secret: %w", err)
+		}
+		return nil
+	})
+}
+
+// editFile applies edit to the root mapping of a YAML file and writes it
+// back, keeping its comments and mode. Nothing is written if edit fails.
+func editFile(path string, edit func(root *yaml.Node) error) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return domain.WrapError(domain.ErrorKindValidation, fmt.Errorf("failed to parse config file: %w", err))
+	}
+	if doc.Kind == 0 {
+		doc = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode}}}
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return domain.Errorf(domain.ErrorKindValidation, "config file %s is not a YAML mapping", path)
+	}
+
+	if err := edit(root); err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&doc); err != nil {
+		return fmt.Errorf("failed to encode config file: %w", err)
+	}
+	encoder.Close()
+
+	if err := os.WriteFile(path, buf.Bytes(), info.Mode().Perm()); err != nil {
+		return fmt.Errorf("failed to write config file: %w", err)
+	}
+	return nil
+}
+
+// mappingValue returns the mapping under key, adding an empty one if needed.
+func mappingValue(mapping *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			value := mapping.Content[i+1]
+			if value.Kind != yaml.MappingNode {
+				*value = yaml.Node{Kind: yaml.MappingNode}
+			}
+			return value
+		}
+	}
+	value := &yaml.Node{Kind: yaml.MappingNode}
+	mapping.Content = append(mapping.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: key}, value)
+	return value
+}
+
+func setKey(mapping *yaml.Node, key, value string) {
+	setKeyNode(mapping, key, &yaml.Node{Kind: yaml.ScalarNode, Value: value, Style: yaml.DoubleQuotedStyle})
+}
+
+func setKeyNode(mapping *yaml.Node, key string, value *yaml.Node) {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			mapping.Content[i+1] = value
+			return
+		}
+	}
+	mapping.Content = append(mapping.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: key}, value)
+}
+
+func removeKey(mapping *yaml.Node, key string) {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			mapping.Content = append(mapping.Content[:i], mapping.Content[i+2:]...)
+			return
+		}
+	}
+}
@@ -0,0 +1,299 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"proxima/internal/core/domain"
+
+	"gopkg.in/yaml.v3"
+)
+
+// validator collects the problems of a config, each prefixed with the
+// file:line:column of the value at fault when the config was read from files.
+type validator struct {
+	sources  *sources
+	problems []error
+}
+
+// at returns the node at path, made of mapping keys and sequence indexes, or
+// the deepest node found on the way.
+func (v *validator) at(path ...any) *yaml.Node {
+	node, _ := v.lookup(path...)
+	return node
+}
+
+// lookup returns the node at path, and whether it was found entirely.
+func (v *validator) lookup(path ...any) (*yaml.Node, bool) {
+	if v.sources == nil {
+		return nil, false
+	}
+	node := v.sources.root
+	for _, step := range path {
+		var next *yaml.Node
+		switch step := step.(type) {
+		case string:
+			if node.Kind == yaml.MappingNode {
+				next = mappingEntry(node, step)
+			}
+		case int:
+			if node.Kind == yaml.SequenceNode && step < len(node.Content) {
+				next = node.Content[step]
+			}
+		}
+		if next == nil {
+			return node, false
+		}
+		node = next
+	}
+	return node, true
+}
+
+func (v *validator) addf(node *yaml.Node, format string, args ...any) {
+	message := fmt.Sprintf(format, args...)
+	if node != nil && v.sources.files[node] != "" {
+		message = fmt.Sprintf("%s:%d:%d: %s", v.sources.files[node], node.Line, node.Column, message)
+	}
+	v.problems = append(v.problems, fmt.Errorf("%s", message))
+}
+
+// Problems returns every problem of the loaded configuration: the values
+// not satisfying the schema, then the checks across fields. It is empty for a
+// valid configuration.
+func (c *ConfigAdapter) Problems() []error {
+	if c.config == nil {
+		return []error{fmt.Errorf("configuration not loaded")}
+	}
+	v := &validator{sources: c.sources}
+	if c.sources != nil {
+		Schema().check(c.sources.root, "", v.addf)
+	}
+	c.validateProxmox(v)
+	c.validateSecrets(v)
+	c.validateVMs(v)
+	return v.problems
+}
+
+// validateSecrets checks that no secret is given more than one way. Loading
+// the config refuses that while resolving them, so only a config checked with
+// its secrets unresolved can have such problems.
+func (c *ConfigAdapter) validateSecrets(v *validator) {
+	if !c.unresolved {
+		return
+	}
+	for _, s := range c.config.secrets() {
+		if s.given() > 1 {
+			v.addf(v.at(secretPath(s.field)...), "%s", s.conflict())
+		}
+	}
+}
+
+// secretPath returns the path of the mapping holding a secret field, such as
+// vms, 0, ssh for vms[0].ssh.password.
+func secretPath(field string) []any {
+	parts := strings.Split(field, ".")
+	var path []any
+	for _, part := range parts[:len(parts)-1] {
+		name, index, ok := strings.Cut(strings.TrimSuffix(part, "]"), "[")
+		path = append(path, name)
+		if i, err := strconv.Atoi(index); ok && err == nil {
+			path = append(path, i)
+		}
+	}
+	return path
+}
+
+func (c *ConfigAdapter) validateProxmox(v *validator) {
+	proxmox := c.config.Proxmox
+	at := func(key string) *yaml.Node { return v.at("proxmox", key) }
+
+	if proxmox.Host == "" {
+		v.addf(at("host"), "proxmox host is required")
+	}
+	switch {
+	case proxmox.TokenID != "":
+		if _, err := domain.ParseAPITokenID(proxmox.TokenID); err != nil {
+			v.addf(at("token_id"), "proxmox token_id: %v", err)
+		}
+		if proxmox.TokenSecret == "" && proxmox.TokenSecretFile == "" && proxmox.TokenSecretCommand == "" {
+			v.addf(at("token_id"), "proxmox token_secret is required with token_id (token_secret, token_secret_file or token_secret_command)")
+		}
+	case proxmox.TokenSecret != "" || proxmox.TokenSecretFile != "" || proxmox.TokenSecretCommand != "":
+		v.addf(at("token_secret"), "proxmox token_id is required with token_secret")
+	case proxmox.User == "":
+		v.addf(at("user"), "proxmox user is required")
+	case proxmox.Password == "" && proxmox.PasswordFile == "" && proxmox.PasswordCommand == "":
+		v.addf(at("password"), "proxmox password or API token is required (password, password_file or password_command, or token_id with token_secret)")
+	}
+	if proxmox.Node == "" {
+		v.addf(at("node"), "proxmox node is required")
+	}
+	if err := c.GetIPPreferences().Validate(); err != nil {
+		v.addf(at("ip_discovery"), "proxmox ip_discovery: %v", err)
+	}
+}
+
+// validateVMs checks what the schema cannot: values required once merged,
+// counts, duplicates and dependencies.
+func (c *ConfigAdapter) validateVMs(v *validator) {
+	names := make(map[string]int)
+	ids := make(map[int]int)
+	for i, vm := range c.config.VMs {
+		for _, instance := range vm.instances(i) {
+			if _, ok := names[instance.Name]; !ok && instance.Name != "" {
+				names[instance.Name] = i
+			}
+		}
+	}
+
+	dependencies := true
+	var vms []*domain.VM
+	for i, vm := range c.config.VMs {
+		at := func(key ...any) *yaml.Node { return v.at(append([]any{"vms", i}, key...)...) }
+		instances := vm.instances(i)
+		settings := make([]merged, len(instances))
+		for j, instance := range instances {
+			settings[j] = c.merge(instance)
+		}
+
+		if vm.Name == "" {
+			v.addf(at("name"), "vms[%d]: name is required", i)
+		}
+		for _, instance := range instances {
+			if first := names[instance.Name]; instance.Name != "" && first != i {
+				v.addf(at("name"), "vms[%d].name: %s is already used by vms[%d]%s", i, instance.Name, first, v.position(v.at("vms", first)))
+			}
+		}
+
+		c.validateCount(v, i, vm)
+
+		switch {
+		case vm.VMID.IsRange() && (vm.VMID.Min < 100 || vm.VMID.Max < vm.VMID.Min):
+			v.addf(at("vmid"), "vms[%d].vmid: range %s is invalid (must start at 100 or above and end after its start)", i, vm.VMID)
+		case !vm.VMID.IsAuto() && vm.VMID.ID <= 0:
+			v.addf(at("vmid"), "vms[%d].vmid: must be positive", i)
+		}
+		// A VMID shared by the instances is reported by validateCount
+		shared := vm.Count != nil && *vm.Count > 1 && vm.VMIDStart == 0 && !vm.VMID.IsAuto()
+		for _, m := range settings {
+			if m.VMID.IsAuto() || (shared && m.VMID == vm.VMID) {
+				continue
+			}
+			if first, ok := ids[m.VMID.ID]; ok {
+				v.addf(m.node("vmid", at("vmid")), "vms[%d].vmid: %d is already used by vms[%d] %s%s", i, m.VMID.ID, first, c.config.VMs[first].Name, v.position(v.at("vms", first)))
+			} else {
+				ids[m.VMID.ID] = i
+			}
+		}
+
+		// Check effective values (merged from ssh, Defaults, template, VM and instance)
+		missing := make(map[string]bool)
+		for _, m := range settings {
+			required := []struct {
+				key string
+				set bool
+			}{
+				{"cores", m.Cores != 0},
+				{"memory", m.Memory != 0},
+				{"disk_size", m.DiskSize != ""},
+				{"template", m.Template != ""},
+			}
+			for _, field := range required {
+				if !field.set && !missing[field.key] {
+					missing[field.key] = true
+					v.addf(at(), "vms[%d]: %s is required (checked VM, Defaults and templates)", i, field.key)
+				}
+			}
+		}
+
+		itself := func(name string) bool {
+			for _, instance := range instances {
+				if instance.Name == name {
+					return true
+				}
+			}
+			return name == vm.Name
+		}
+		// Instances sharing depends_on share its problems
+		reported := make(map[string]bool)
+		for _, m := range settings {
+			list := m.node("depends_on", at("depends_on"))
+			for j, dep := range m.DependsOn {
+				node := list
+				if list != nil && list.Kind == yaml.SequenceNode && j < len(list.Content) {
+					node = list.Content[j]
+				}
+				var problem string
+				switch _, ok := names[dep]; {
+				case itself(dep):
+					problem = fmt.Sprintf("vms[%d]: depends_on lists the VM itself", i)
+				case !ok:
+					problem = fmt.Sprintf("vms[%d]: depends_on references unknown VM '%s'", i, dep)
+				default:
+					continue
+				}
+				dependencies = false
+				if key := v.position(node) + problem; !reported[key] {
+					reported[key] = true
+					v.addf(node, "%s", problem)
+				}
+			}
+		}
+
+		for j, instance := range instances {
+			vm := domain.NewVM(instance.Name, settings[j].VMID.ID)
+			vm.StartOrder = deref(settings[j].StartOrder)
+			vm.DependsOn = settings[j].DependsOn
+			vms = append(vms, vm)
+		}
+	}
+
+	// depends_on and start_order must leave an order to create and start VMs in
+	if !dependencies {
+		return
+	}
+	if _, err := domain.StartWaves(vms); err != nil {
+		v.addf(v.at("vms"), "%v", err)
+	}
+}
+
+// validateCount checks the count of the VM at index i and the settings that
+// come with it.
+func (c *ConfigAdapter) validateCount(v *validator, i int, vm VMConfig) {
+	at := func(key ...any) *yaml.Node { return v.at(append([]any{"vms", i}, key...)...) }
+	indexed := strings.Contains(vm.Name, domain.IndexPlaceholder)
+
+	if vm.Count == nil {
+		if indexed {
+			v.addf(at("name"), "vms[%d]: count is required with %s in name", i, domain.IndexPlaceholder)
+		}
+		if vm.VMIDStart != 0 || len(vm.Instances) > 0 {
+			v.addf(at(), "vms[%d]: vmid_start and instances require count", i)
+		}
+		return
+	}
+
+	if !indexed {
+		v.addf(at("name"), "vms[%d].name: must contain %s with count", i, domain.IndexPlaceholder)
+	}
+	switch {
+	case vm.VMIDStart != 0 && (!vm.VMID.IsAuto() || vm.VMID.IsRange()):
+		v.addf(at("vmid_start"), "vms[%d]: vmid_start and vmid cannot both be set", i)
+	case !vm.VMID.IsAuto() && *vm.Count > 1:
+		v.addf(at("vmid"), "vms[%d].vmid: %d cannot be shared by %d instances (use vmid_start, auto or a range)", i, vm.VMID.ID, *vm.Count)
+	}
+	for _, index := range vm.instanceIndexes() {
+		if index < 1 {
+			v.addf(at("instances", strconv.Itoa(index)), "vms[%d].instances: %d is not an instance index (they start at 1)", i, index)
+		}
+	}
+}
+
+// position returns " (file:line)" for node, or nothing when it is unknown.
+func (v *validator) position(node *yaml.Node) string {
+	if node == nil || v.sources.files[node] == "" {
+		return ""
+	}
+	return " (" + v.sources.position(node) + ")"
+}
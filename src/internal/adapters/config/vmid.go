@@ -0,0 +1,67 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// VMIDSpec is the value of a VM's vmid field: a fixed ID, "auto" (or omitted)
+// for the next free ID of the cluster, or a "min-max" range to allocate from.
+type VMIDSpec struct {
+	ID  int
+	Min int
+	Max int
+}
+
+func (v *VMIDSpec) UnmarshalYAML(node *yaml.Node) error {
+	value := strings.TrimSpace(node.Value)
+
+	if value == "" || value == "auto" {
+		*v = VMIDSpec{}
+		return nil
+	}
+
+	if id, err := strconv.Atoi(value); err == nil {
+		*v = VMIDSpec{ID: id}
+		return nil
+	}
+
+	if minStr, maxStr, ok := strings.Cut(value, "-"); ok {
+		min, minErr := strconv.Atoi(strings.TrimSpace(minStr))
+		max, maxErr := strconv.Atoi(strings.TrimSpace(maxStr))
+		if minErr == nil && maxErr == nil {
+			*v = VMIDSpec{Min: min, Max: max}
+			return nil
+		}
+	}
+
+	// A type error, so that decoding goes on and reports the other problems
+	return &yaml.TypeError{Errors: []string{fmt.Sprintf("line %d: invalid vmid '%s' (expected a number, 'auto' or a range like '200-299')", node.Line, value)}}
+}
+
+func (v VMIDSpec) MarshalYAML() (any, error) {
+	switch {
+	case v.ID != 0:
+		return v.ID, nil
+	case v.IsRange():
+		return fmt.Sprintf("%d-%d", v.Min, v.Max), nil
+	default:
+		return "auto", nil
+	}
+}
+
+func (v VMIDSpec) IsAuto() bool {
+	return v.ID == 0
+}
+
+func (v VMIDSpec) IsRange() bool {
+	return v.ID == 0 && (v.Min != 0 || v.Max != 0)
+}
+
+func (v VMIDSpec) String() string {
+	value, _ := v.MarshalYAML()
+	return fmt.Sprint(value)
+}
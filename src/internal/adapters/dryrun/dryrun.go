@@ -0,0 +1,323 @@
+package dryrun
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"proxima/internal/core/domain"
+	"proxima/internal/core/ports"
+)
+
+// Log collects the operations a dry run would have performed, in order.
+type Log struct {
+	entries []string
+	mu      sync.Mutex
+}
+
+func NewLog() *Log {
+	return &Log{}
+}
+
+func (l *Log) Record(entries ...string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.entries = append(l.entries, entries...)
+}
+
+func (l *Log) Entries() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]string(nil), l.entries...)
+}
+
+// RecordingVMRepository stands in for a VM repository during dry runs. Reads
+// are served by the wrapped repository, so selectors, templates and VMIDs are
+// resolved against the real cluster; mutations are recorded as the API calls
+// or qm commands they would run, and their effect is simulated so that the
+// reads following them (status polling, VMID allocation) stay consistent.
+type RecordingVMRepository struct {
+	repo     ports.VMRepository
+	planner  ports.CommandPlanner
+	log      *Log
+	created  map[int]*domain.VM
+	deleted  map[int]bool
+	statuses map[int]domain.VMStatus
+	mu       sync.Mutex
+}
+
+func NewRecordingVMRepository(repo ports.VMRepository, log *Log) (*RecordingVMRepository, error) {
+	planner, ok := repo.(ports.CommandPlanner)
+	if !ok {
+		return nil, domain.Errorf(domain.ErrorKindValidation, "dry run is not supported by this connection mode")
+	}
+
+	return &RecordingVMRepository{
+		repo:     repo,
+		planner:  planner,
+		log:      log,
+		created:  make(map[int]*domain.VM),
+		deleted:  make(map[int]bool),
+		statuses: make(map[int]domain.VMStatus),
+	}, nil
+}
+
+func (r *RecordingVMRepository) Create(vm *domain.VM, progress domain.ProgressFunc) error {
+	r.mu.Lock()
+	exists := r.created[vm.ID] != nil
+	r.mu.Unlock()
+	if exists {
+		return domain.Errorf(domain.ErrorKindConflict, "VM %d already exists", vm.ID)
+	}
+	if _, err := r.GetByID(vm.ID); err == nil {
+		return domain.Errorf(domain.ErrorKindConflict, "VM %d already exists", vm.ID)
+	}
+
+	calls, err := r.planner.PlanCreate(vm)
+	if err != nil {
+		return err
+	}
+	r.log.Record(calls...)
+
+	created := *vm
+	created.Status = domain.VMStatusStopped
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.created[vm.ID] = &created
+	delete(r.deleted, vm.ID)
+	return nil
+}
+
+func (r *RecordingVMRepository) GetByID(id int) (*domain.VM, error) {
+	r.mu.Lock()
+	deleted, created := r.deleted[id], r.created[id]
+	r.mu.Unlock()
+
+	if deleted {
+		return nil, domain.Errorf(domain.ErrorKindNotFound, "VM %d does not exist (deleted in this dry run)", id)
+	}
+	if created != nil {
+		return r.simulate(created), nil
+	}
+
+	vm, err := r.repo.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+	return r.simulate(vm), nil
+}
+
+func (r *RecordingVMRepository) GetByName(name string) (*domain.VM, error) {
+	vms, err := r.List()
+	if err != nil {
+		return nil, err
+	}
+	for _, vm := range vms {
+		if vm.Name == name {
+			return vm, nil
+		}
+	}
+	return nil, domain.Errorf(domain.ErrorKindNotFound, "VM with name %s not found", name)
+}
+
+func (r *RecordingVMRepository) Update(vm *domain.VM) error {
+	return domain.Errorf(domain.ErrorKindValidation, "update of VM %d cannot be simulated", vm.ID)
+}
+
+func (r *RecordingVMRepository) Delete(id int, purge bool) error {
+	calls, err := r.planner.PlanDelete(id, purge)
+	if err != nil {
+		return err
+	}
+	r.log.Record(calls...)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.deleted[id] = true
+	delete(r.created, id)
+	return nil
+}
+
+func (r *RecordingVMRepository) List() ([]*domain.VM, error) {
+	listed, err := r.repo.List()
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	var vms []*domain.VM
+	for _, vm := range listed {
+		if !r.deleted[vm.ID] && r.created[vm.ID] == nil {
+			vms = append(vms, vm)
+		}
+	}
+	for _, vm := range r.created {
+		vms = append(vms, vm)
+	}
+	r.mu.Unlock()
+
+	for i, vm := range vms {
+		vms[i] = r.simulate(vm)
+	}
+	sort.Slice(vms, func(i, j int) bool { return vms[i].ID < vms[j].ID })
+	return vms, nil
+}
+
+// NextID skips the IDs taken by VMs created earlier in the dry run, which the
+// cluster does not know about.
+func (r *RecordingVMRepository) NextID(idRange domain.VMIDRange) (int, error) {
+	for {
+		id, err := r.repo.NextID(idRange)
+		if err != nil {
+			return 0, err
+		}
+
+		r.mu.Lock()
+		taken := r.created[id] != nil
+		r.mu.Unlock()
+		if !taken {
+			return id, nil
+		}
+
+		max := idRange.Max
+		if idRange.IsZero() {
+			max = 999999999
+		}
+		if id >= max {
+			return 0, domain.Errorf(domain.ErrorKindConflict, "no free VMID in range %d-%d", idRange.Min, idRange.Max)
+		}
+		idRange = domain.VMIDRange{Min: id + 1, Max: max}
+	}
+}
+
+func (r *RecordingVMRepository) Start(id int) error {
+	return r.power(id, "start", domain.VMStatusRunning)
+}
+
+func (r *RecordingVMRepository) Stop(id int) error {
+	return r.power(id, "stop", domain.VMStatusStopped)
+}
+
+func (r *RecordingVMRepository) Shutdown(id int) error {
+	return r.power(id, "shutdown", domain.VMStatusStopped)
+}
+
+func (r *RecordingVMRepository) Reboot(id int) error {
+	return r.power(id, "reboot", domain.VMStatusRunning)
+}
+
+func (r *RecordingVMRepository) Reset(id int) error {
+	return r.power(id, "reset", domain.VMStatusRunning)
+}
+
+func (r *RecordingVMRepository) Suspend(id int) error {
+	return r.power(id, "suspend", domain.VMStatusPaused)
+}
+
+func (r *RecordingVMRepository) Resume(id int) error {
+	return r.power(id, "resume", domain.VMStatusRunning)
+}
+
+func (r *RecordingVMRepository) Hibernate(id int) error {
+	return r.power(id, "hibernate", domain.VMStatusSuspended)
+}
+
+func (r *RecordingVMRepository) power(id int, action string, status domain.VMStatus) error {
+	calls, err := r.planner.PlanPower(id, action)
+	if err != nil {
+		return err
+	}
+	r.log.Record(calls...)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.statuses[id] = status
+	return nil
+}
+
+func (r *RecordingVMRepository) GetStatus(id int) (domain.VMStatus, error) {
+	vm, err := r.GetByID(id)
+	if err != nil {
+		return "", err
+	}
+	return vm.Status, nil
+}
+
+func (r *RecordingVMRepository) GetVMIP(id int) (string, error) {
+	if r.isCreated(id) {
+		return "", fmt.Errorf("VM %d only exists in this dry run", id)
+	}
+	return r.repo.GetVMIP(id)
+}
+
+func (r *RecordingVMRepository) GetNetworkInterfaces(id int) ([]domain.NetworkInterface, error) {
+	if r.isCreated(id) {
+		return nil, fmt.Errorf("VM %d only exists in this dry run", id)
+	}
+	return r.repo.GetNetworkInterfaces(id)
+}
+
+func (r *RecordingVMRepository) PingAgent(id int) error {
+	if r.isCreated(id) {
+		return fmt.Errorf("VM %d only exists in this dry run", id)
+	}
+	return r.repo.PingAgent(id)
+}
+
+func (r *RecordingVMRepository) isCreated(id int) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.created[id] != nil
+}
+
+// simulate returns a copy of vm carrying the status set by recorded power actions.
+func (r *RecordingVMRepository) simulate(vm *domain.VM) *domain.VM {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	status, ok := r.statuses[vm.ID]
+	if !ok {
+		return vm
+	}
+	simulated := *vm
+	simulated.Status = status
+	return &simulated
+}
+
+// RecordingStateRepository keeps the VMIDs allocated during a dry run in
+// memory instead of writing them to the state file.
+type RecordingStateRepository struct {
+	state ports.StateRepository
+	log   *Log
+	vmids map[string]int
+	mu    sync.Mutex
+}
+
+func NewRecordingStateRepository(state ports.StateRepository, log *Log) *RecordingStateRepository {
+	return &RecordingStateRepository{state: state, log: log, vmids: make(map[string]int)}
+}
+
+func (r *RecordingStateRepository) GetVMID(name string) (int, bool) {
+	r.mu.Lock()
+	id, ok := r.vmids[name]
+	r.mu.Unlock()
+	if ok {
+		return id, true
+	}
+	return r.state.GetVMID(name)
+}
+
+func (r *RecordingStateRepository) SetVMID(name string, id int) error {
+	r.log.Record(fmt.Sprintf("record VMID %d for '%s' in the state file", id, name))
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.vmids[name] = id
+	return nil
+}
+
+var (
+	_ ports.VMRepository    = (*RecordingVMRepository)(nil)
+	_ ports.StateRepository = (*RecordingStateRepository)(nil)
+)
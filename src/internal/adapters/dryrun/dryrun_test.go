@@ -0,0 +1,187 @@
+package dryrun
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"proxima/internal/core/domain"
+)
+
+var errMutation = errors.New("mutation reached the repository")
+
+// plannedRepository serves a fixed set of VMs and fails on any mutation, so
+// tests notice when a dry run reaches the real repository.
+type plannedRepository struct {
+	vms    map[int]*domain.VM
+	nextID int
+}
+
+func newPlannedRepository(vms ...*domain.VM) *plannedRepository {
+	repo := &plannedRepository{vms: make(map[int]*domain.VM), nextID: 100}
+	for _, vm := range vms {
+		repo.vms[vm.ID] = vm
+	}
+	return repo
+}
+
+func (r *plannedRepository) GetByID(id int) (*domain.VM, error) {
+	if vm, ok := r.vms[id]; ok {
+		return vm, nil
+	}
+	return nil, domain.Errorf(domain.ErrorKindNotFound, "VM %d does not exist", id)
+}
+
+func (r *plannedRepository) List() ([]*domain.VM, error) {
+	var vms []*domain.VM
+	for _, vm := range r.vms {
+		vms = append(vms, vm)
+	}
+	return vms, nil
+}
+
+func (r *plannedRepository) NextID(idRange domain.VMIDRange) (int, error) {
+	id := r.nextID
+	if id < idRange.Min {
+		id = idRange.Min
+	}
+	for r.vms[id] != nil {
+		id++
+	}
+	return id, nil
+}
+
+func (r *plannedRepository) GetByName(name string) (*domain.VM, error) {
+	return nil, errors.New("not used")
+}
+
+func (r *plannedRepository) GetStatus(id int) (domain.VMStatus, error) {
+	vm, err := r.GetByID(id)
+	if err != nil {
+		return "", err
+	}
+	return vm.Status, nil
+}
+
+func (r *plannedRepository) Create(vm *domain.VM, progress domain.ProgressFunc) error {
+	return errMutation
+}
+
+func (r *plannedRepository) Update(vm *domain.VM) error      { return errMutation }
+func (r *plannedRepository) Delete(id int, purge bool) error { return errMutation }
+func (r *plannedRepository) Start(id int) error              { return errMutation }
+func (r *plannedRepository) Stop(id int) error               { return errMutation }
+func (r *plannedRepository) Shutdown(id int) error           { return errMutation }
+func (r *plannedRepository) Reboot(id int) error             { return errMutation }
+func (r *plannedRepository) Reset(id int) error              { return errMutation }
+func (r *plannedRepository) Suspend(id int) error            { return errMutation }
+func (r *plannedRepository) Resume(id int) error             { return errMutation }
+func (r *plannedRepository) Hibernate(id int) error          { return errMutation }
+
+func (r *plannedRepository) PingAgent(id int) error {
+	return errors.New("no agent")
+}
+
+func (r *plannedRepository) GetVMIP(id int) (string, error) {
+	return "", errors.New("no IP")
+}
+
+func (r *plannedRepository) GetNetworkInterfaces(id int) ([]domain.NetworkInterface, error) {
+	return nil, errors.New("no interfaces")
+}
+
+func (r *plannedRepository) PlanCreate(vm *domain.VM) ([]string, error) {
+	return []string{fmt.Sprintf("qm clone %s %d --name %s --full 1", vm.Template, vm.ID, vm.Name)}, nil
+}
+
+func (r *plannedRepository) PlanDelete(id int, purge bool) ([]string, error) {
+	if purge {
+		return []string{fmt.Sprintf("qm destroy %d --purge 1", id)}, nil
+	}
+	return []string{fmt.Sprintf("qm destroy %d", id)}, nil
+}
+
+func (r *plannedRepository) PlanPower(id int, action string) ([]string, error) {
+	return []string{fmt.Sprintf("qm %s %d", action, id)}, nil
+}
+
+func TestRecordingVMRepository(t *testing.T) {
+	running := domain.NewVM("web", 100)
+	running.Status = domain.VMStatusRunning
+	log := NewLog()
+	repo, err := NewRecordingVMRepository(newPlannedRepository(running), log)
+	if err != nil {
+		t.Fatalf("Failed to create recording repository: %v", err)
+	}
+
+	if err := repo.Shutdown(100); err != nil {
+		t.Fatalf("Expected shutdown to be recorded, got: %v", err)
+	}
+	if status, _ := repo.GetStatus(100); status != domain.VMStatusStopped {
+		t.Errorf("Expected simulated status stopped, got '%s'", status)
+	}
+
+	vm := domain.NewVM("db", 0)
+	vm.Template = "9000"
+	if vm.ID, err = repo.NextID(domain.VMIDRange{}); err != nil || vm.ID != 101 {
+		t.Fatalf("Expected VMID 101, got %d, %v", vm.ID, err)
+	}
+	if err := repo.Create(vm, nil); err != nil {
+		t.Fatalf("Expected create to be recorded, got: %v", err)
+	}
+	if id, _ := repo.NextID(domain.VMIDRange{}); id != 102 {
+		t.Errorf("Expected VMID 102 after simulated creation of 101, got %d", id)
+	}
+	if err := repo.Create(vm, nil); !errors.Is(err, domain.ErrConflict) {
+		t.Errorf("Expected conflict creating VM 101 twice, got %v", err)
+	}
+
+	if err := repo.Delete(100, true); err != nil {
+		t.Fatalf("Expected delete to be recorded, got: %v", err)
+	}
+	if _, err := repo.GetByID(100); !errors.Is(err, domain.ErrNotFound) {
+		t.Errorf("Expected deleted VM to be gone, got %v", err)
+	}
+
+	vms, _ := repo.List()
+	if len(vms) != 1 || vms[0].ID != 101 {
+		t.Errorf("Expected only the simulated VM 101 to be listed, got %v", vms)
+	}
+
+	want := []string{"qm shutdown 100", "qm clone 9000 101 --name db --full 1", "qm destroy 100 --purge 1"}
+	if got := log.Entries(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected recorded operations %v, got %v", want, got)
+	}
+}
+
+func TestRecordingStateRepository(t *testing.T) {
+	log := NewLog()
+	state := NewRecordingStateRepository(&memoryState{vmids: map[string]int{"web": 100}}, log)
+
+	if id, ok := state.GetVMID("web"); !ok || id != 100 {
+		t.Errorf("Expected recorded VMID 100, got %d", id)
+	}
+	if err := state.SetVMID("db", 101); err != nil {
+		t.Fatalf("Failed to set VMID: %v", err)
+	}
+	if id, ok := state.GetVMID("db"); !ok || id != 101 {
+		t.Errorf("Expected simulated VMID 101, got %d", id)
+	}
+	if len(log.Entries()) != 1 {
+		t.Errorf("Expected one recorded operation, got %v", log.Entries())
+	}
+}
+
+type memoryState struct {
+	vmids map[string]int
+}
+
+func (s *memoryState) GetVMID(name string) (int, bool) {
+	id, ok := s.vmids[name]
+	return id, ok
+}
+
+func (s *memoryState) SetVMID(name string, id int) error {
+	return errors.New("state file written during a dry run")
+}
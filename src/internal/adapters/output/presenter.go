@@ -0,0 +1,231 @@
+package output
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"text/template"
+
+	"proxima/internal/core/domain"
+
+	"gopkg.in/yaml.v3"
+)
+
+type Format string
+
+const (
+	FormatTable    Format = "table"
+	FormatWide     Format = "wide"
+	FormatJSON     Format = "json"
+	FormatYAML     Format = "yaml"
+	FormatCSV      Format = "csv"
+	FormatTemplate Format = "template"
+)
+
+// Presenter renders domain objects in the format selected with -o/--output.
+type Presenter struct {
+	format   Format
+	template *template.Template
+	w        io.Writer
+}
+
+// NewPresenter parses an output specification: table, wide, json, yaml, csv or
+// template=<go template>. An empty specification selects the table format.
+func NewPresenter(spec string, w io.Writer) (*Presenter, error) {
+	p := &Presenter{format: FormatTable, w: w}
+
+	name, tmpl, hasTemplate := strings.Cut(spec, "=")
+	switch Format(name) {
+	case "", FormatTable, FormatWide, FormatJSON, FormatYAML, FormatCSV:
+		if hasTemplate {
+			return nil, fmt.Errorf("output format '%s' does not take a template", name)
+		}
+		if name != "" {
+			p.format = Format(name)
+		}
+	case FormatTemplate:
+		if tmpl == "" {
+			return nil, fmt.Errorf("output format 'template' requires a template, e.g. -o template='{{.Name}}'")
+		}
+		parsed, err := template.New("output").Parse(tmpl)
+		if err != nil {
+			return nil, fmt.Errorf("invalid output template: %w", err)
+		}
+		p.format = FormatTemplate
+		p.template = parsed
+	default:
+		return nil, fmt.Errorf("unknown output format '%s' (expected table, wide, json, yaml, csv or template=...)", spec)
+	}
+
+	return p, nil
+}
+
+func (p *Presenter) Format() Format {
+	return p.format
+}
+
+// IsText reports whether the output is meant for humans. Progress messages are
+// only written to stdout in that case, so structured output stays parseable.
+func (p *Presenter) IsText() bool {
+	return p.format == FormatTable || p.format == FormatWide
+}
+
+func (p *Presenter) VMs(vms []*domain.VM) error {
+	if len(vms) == 0 && p.IsText() {
+		fmt.Fprintln(p.w, "No VMs found.")
+		return nil
+	}
+
+	views := make([]VMView, len(vms))
+	for i, vm := range vms {
+		views[i] = NewVMView(vm)
+	}
+	return render(p, views)
+}
+
+// Commands renders commands run on VMs. Text formats leave out their output,
+// which is printed as each command completes.
+func (p *Presenter) Commands(commands []*domain.Command) error {
+	views := make([]CommandView, len(commands))
+	for i, command := range commands {
+		views[i] = NewCommandView(command)
+	}
+	return render(p, views)
+}
+
+func (p *Presenter) Interfaces(ifaces []domain.NetworkInterface) error {
+	views := make([]InterfaceView, len(ifaces))
+	for i, iface := range ifaces {
+		views[i] = NewInterfaceView(iface)
+	}
+	return render(p, views)
+}
+
+// Operations renders the operations a dry run on target would have performed.
+// Text formats introduce them, or say that nothing would change.
+func (p *Presenter) Operations(operations []string, target string) error {
+	if p.IsText() {
+		fmt.Fprintln(p.w)
+		if len(operations) == 0 {
+			fmt.Fprintln(p.w, "Dry run: nothing would change")
+			return nil
+		}
+		fmt.Fprintf(p.w, "Dry run: nothing was changed. %d operation(s) would run on %s:\n", len(operations), target)
+	}
+
+	views := make([]OperationView, len(operations))
+	for i, operation := range operations {
+		views[i] = OperationView{Step: i + 1, Operation: operation}
+	}
+	return render(p, views)
+}
+
+// Plan renders what apply does to each VM. Text formats introduce it with the
+// number of VMs per action.
+func (p *Presenter) Plan(plan *domain.Plan) error {
+	if p.IsText() {
+		fmt.Fprintf(p.w, "\nPlan: %d to create, %d to keep, %d to delete\n",
+			len(plan.VMs(domain.PlanActionCreate)), len(plan.VMs(domain.PlanActionKeep)), len(plan.VMs(domain.PlanActionDelete)))
+	}
+
+	views := make([]PlanStepView, len(plan.Steps))
+	for i, step := range plan.Steps {
+		views[i] = NewPlanStepView(step)
+	}
+	return render(p, views)
+}
+
+func (p *Presenter) Templates(entries []domain.TemplateEntry) error {
+	if len(entries) == 0 && p.IsText() {
+		fmt.Fprintln(p.w, "No templates found.")
+		return nil
+	}
+
+	views := make([]TemplateView, len(entries))
+	for i, entry := range entries {
+		views[i] = NewTemplateView(entry)
+	}
+	return render(p, views)
+}
+
+// Settings renders the effective settings of a VM of the config.
+func (p *Presenter) Settings(settings []domain.Setting) error {
+	views := make([]SettingView, len(settings))
+	for i, setting := range settings {
+		views[i] = NewSettingView(setting)
+	}
+	return render(p, views)
+}
+
+// Results renders task results. Text formats already narrate every task while it
+// runs, so they only get a summary table when several tasks ran.
+func (p *Presenter) Results(results []*domain.TaskResult) error {
+	if p.IsText() && len(results) < 2 {
+		return nil
+	}
+	if p.IsText() {
+		fmt.Fprintln(p.w)
+	}
+
+	views := make([]TaskResultView, len(results))
+	for i, result := range results {
+		views[i] = NewTaskResultView(result)
+	}
+	return render(p, views)
+}
+
+// row is implemented by every view that can be printed as a table or CSV.
+type row interface {
+	Columns(wide bool) []string
+	Values(wide bool) []string
+}
+
+func render[T row](p *Presenter, items []T) error {
+	switch p.format {
+	case FormatJSON:
+		encoder := json.NewEncoder(p.w)
+		encoder.SetIndent("", "  ")
+		if items == nil {
+			items = []T{}
+		}
+		return encoder.Encode(items)
+	case FormatYAML:
+		encoder := yaml.NewEncoder(p.w)
+		encoder.SetIndent(2)
+		defer encoder.Close()
+		return encoder.Encode(items)
+	case FormatCSV:
+		var zero T
+		writer := csv.NewWriter(p.w)
+		if err := writer.Write(zero.Columns(true)); err != nil {
+			return err
+		}
+		for _, item := range items {
+			if err := writer.Write(item.Values(true)); err != nil {
+				return err
+			}
+		}
+		writer.Flush()
+		return writer.Error()
+	case FormatTemplate:
+		for _, item := range items {
+			if err := p.template.Execute(p.w, item); err != nil {
+				return fmt.Errorf("failed to render template: %w", err)
+			}
+			fmt.Fprintln(p.w)
+		}
+		return nil
+	default:
+		wide := p.format == FormatWide
+		var zero T
+		tw := tabwriter.NewWriter(p.w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, strings.Join(zero.Columns(wide), "\t"))
+		for _, item := range items {
+			fmt.Fprintln(tw, strings.Join(item.Values(wide), "\t"))
+		}
+		return tw.Flush()
+	}
+}
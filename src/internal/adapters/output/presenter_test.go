@@ -0,0 +1,247 @@
+package output
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"proxima/internal/core/domain"
+)
+
+func testVMs() []*domain.VM {
+	web := domain.NewVM("web", 100)
+	web.Status = domain.VMStatusRunning
+	web.Cores = 2
+	web.Memory = 2048
+	web.Node = "pve"
+	web.Uptime = 26 * time.Hour
+	web.Tags = []string{"prod", "frontend"}
+	web.IP = "192.168.1.50"
+
+	db := domain.NewVM("db", 101)
+	db.Cores = 4
+	db.Memory = 8192
+
+	return []*domain.VM{web, db}
+}
+
+func TestNewPresenter(t *testing.T) {
+	for _, spec := range []string{"", "table", "wide", "json", "yaml", "csv", "template={{.Name}}"} {
+		if _, err := NewPresenter(spec, &bytes.Buffer{}); err != nil {
+			t.Errorf("Expected spec '%s' to be valid, got: %v", spec, err)
+		}
+	}
+
+	for _, spec := range []string{"xml", "template=", "template={{.Name", "json=x"} {
+		if _, err := NewPresenter(spec, &bytes.Buffer{}); err == nil {
+			t.Errorf("Expected spec '%s' to be rejected", spec)
+		}
+	}
+}
+
+func TestPresenter_VMs(t *testing.T) {
+	tests := []struct {
+		spec     string
+		contains []string
+		excludes []string
+	}{
+		{spec: "table", contains: []string{"VMID", "web", "2048 MB"}, excludes: []string{"NODE", "192.168.1.50"}},
+		{spec: "wide", contains: []string{"NODE", "UPTIME", "1d2h", "prod;frontend", "192.168.1.50"}},
+		{spec: "csv", contains: []string{"VMID,NAME,STATUS,CPU,MEMORY,NODE,UPTIME,DISK,TAGS,IP", "100,web,running,2,2048 MB,pve,1d2h,-,prod;frontend,192.168.1.50"}},
+		{spec: "yaml", contains: []string{"- vmid: 100", "  name: web", "memory_mb: 8192"}},
+		{spec: "template={{.Name}}:{{.ID}}", contains: []string{"web:100\ndb:101\n"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			var buf bytes.Buffer
+			presenter, err := NewPresenter(tt.spec, &buf)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if err := presenter.VMs(testVMs()); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			for _, s := range tt.contains {
+				if !strings.Contains(buf.String(), s) {
+					t.Errorf("Expected output to contain %q, got:\n%s", s, buf.String())
+				}
+			}
+			for _, s := range tt.excludes {
+				if strings.Contains(buf.String(), s) {
+					t.Errorf("Expected output not to contain %q, got:\n%s", s, buf.String())
+				}
+			}
+		})
+	}
+}
+
+func TestPresenter_JSON(t *testing.T) {
+	var buf bytes.Buffer
+	presenter, _ := NewPresenter("json", &buf)
+
+	if err := presenter.VMs(testVMs()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var decoded []VMView
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatalf("Output is not valid JSON: %v", err)
+	}
+	if len(decoded) != 2 || decoded[0].ID != 100 || decoded[0].UptimeSeconds != 26*3600 {
+		t.Errorf("Unexpected decoded VMs: %+v", decoded)
+	}
+
+	// Empty lists must still be valid JSON arrays
+	buf.Reset()
+	if err := presenter.VMs(nil); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if strings.TrimSpace(buf.String()) != "[]" {
+		t.Errorf("Expected empty JSON array, got %q", buf.String())
+	}
+}
+
+func TestPresenter_Results(t *testing.T) {
+	vm := domain.NewVM("web", 100)
+	ok := domain.NewTaskResult(vm, "start")
+	ok.Finish(nil)
+
+	var buf bytes.Buffer
+	table, _ := NewPresenter("table", &buf)
+	if err := table.Results([]*domain.TaskResult{ok}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("Expected no results output for a single task in text formats, got %q", buf.String())
+	}
+
+	failed := domain.NewTaskResult(domain.NewVM("db", 101), "start")
+	failed.Finish(errors.New("VM is locked"))
+	if err := table.Results([]*domain.TaskResult{ok, failed}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !strings.Contains(buf.String(), "failed") || !strings.Contains(buf.String(), "VM is locked") {
+		t.Errorf("Expected a summary table for several tasks, got %q", buf.String())
+	}
+	buf.Reset()
+
+	jsonPresenter, _ := NewPresenter("json", &buf)
+	if err := jsonPresenter.Results([]*domain.TaskResult{ok}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !strings.Contains(buf.String(), `"status": "ok"`) || !strings.Contains(buf.String(), `"action": "start"`) {
+		t.Errorf("Unexpected JSON results: %s", buf.String())
+	}
+}
+
+func TestPresenter_Operations(t *testing.T) {
+	operations := []string{"POST /nodes/pve/qemu/9000/clone", "record VMID 103 for 'cache' in the state file"}
+
+	var buf bytes.Buffer
+	jsonPresenter, _ := NewPresenter("json", &buf)
+	if err := jsonPresenter.Operations(operations, "config.yaml"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var decoded []OperationView
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatalf("Output is not valid JSON: %v", err)
+	}
+	if len(decoded) != 2 || decoded[1].Step != 2 || decoded[1].Operation != operations[1] {
+		t.Errorf("Unexpected decoded operations: %+v", decoded)
+	}
+
+	buf.Reset()
+	table, _ := NewPresenter("table", &buf)
+	if err := table.Operations(nil, "config.yaml"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !strings.Contains(buf.String(), "Dry run: nothing would change") {
+		t.Errorf("Expected a text summary of an empty dry run, got %q", buf.String())
+	}
+}
+
+func TestPresenter_Plan(t *testing.T) {
+	cache := domain.NewVM("cache", 0)
+	cache.Template = "ubuntu"
+	plan := &domain.Plan{}
+	plan.Add(domain.PlanActionKeep, domain.NewVM("web", 100), "already exists")
+	plan.Add(domain.PlanActionCreate, cache, "")
+	plan.Add(domain.PlanActionDelete, domain.NewVM("web-09", 109), "beyond the count of web (8)")
+
+	var buf bytes.Buffer
+	table, _ := NewPresenter("table", &buf)
+	if err := table.Plan(plan); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for _, s := range []string{"Plan: 1 to create, 1 to keep, 1 to delete", "create  auto  cache   ubuntu", "delete  109   web-09  -"} {
+		if !strings.Contains(buf.String(), s) {
+			t.Errorf("Expected output to contain %q, got:\n%s", s, buf.String())
+		}
+	}
+
+	buf.Reset()
+	jsonPresenter, _ := NewPresenter("json", &buf)
+	if err := jsonPresenter.Plan(plan); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var decoded []PlanStepView
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatalf("Output is not valid JSON: %v", err)
+	}
+	if len(decoded) != 3 || decoded[2].Action != "delete" || decoded[2].VMID != 109 {
+		t.Errorf("Unexpected decoded plan: %+v", decoded)
+	}
+}
+
+func TestPresenter_Commands(t *testing.T) {
+	ok := domain.NewCommand(100, "uptime", nil, 0)
+	ok.Complete("up 3 days\n")
+	failed := domain.NewCommand(101, "systemctl", []string{"is-active", "nginx"}, 0)
+	failed.Output = "inactive\n"
+	failed.Fail("exit status 3")
+
+	var buf bytes.Buffer
+	csvPresenter, _ := NewPresenter("csv", &buf)
+	if err := csvPresenter.Commands([]*domain.Command{ok, failed}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for _, s := range []string{"VMID,COMMAND,STATUS,DURATION,ERROR", "101,systemctl is-active nginx,failed,"} {
+		if !strings.Contains(buf.String(), s) {
+			t.Errorf("Expected output to contain %q, got:\n%s", s, buf.String())
+		}
+	}
+
+	buf.Reset()
+	yamlPresenter, _ := NewPresenter("yaml", &buf)
+	if err := yamlPresenter.Commands([]*domain.Command{ok, failed}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for _, s := range []string{"output: |\n    up 3 days", "error: exit status 3"} {
+		if !strings.Contains(buf.String(), s) {
+			t.Errorf("Expected output to contain %q, got:\n%s", s, buf.String())
+		}
+	}
+}
+
+func TestPresenter_Templates(t *testing.T) {
+	entries := []domain.TemplateEntry{
+		{ID: 9000, Name: "ubuntu-24.04", Aliases: []string{"lts", "ubuntu"}},
+		{ID: 9001, Name: "debian-12"},
+		{Aliases: []string{"centos"}, Source: "9002"},
+	}
+
+	var buf bytes.Buffer
+	presenter, _ := NewPresenter("table", &buf)
+	if err := presenter.Templates(entries); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for _, s := range []string{"9000  ubuntu-24.04     lts,ubuntu", "9001  debian-12        -", "-     not found: 9002  centos"} {
+		if !strings.Contains(buf.String(), s) {
+			t.Errorf("Expected output to contain %q, got:\n%s", s, buf.String())
+		}
+	}
+}
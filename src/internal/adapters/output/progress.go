@@ -0,0 +1,189 @@
+package output
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"proxima/internal/core/domain"
+)
+
+// progressRefresh is how often a live display redraws, so elapsed times move.
+const progressRefresh = 500 * time.Millisecond
+
+// Progress shows the phase each VM of a batch of creations is at. A live
+// display, meant for terminals, redraws one line per VM in place; otherwise a
+// line is printed whenever a VM changes phase, which suits logs and pipes.
+type Progress struct {
+	w      io.Writer
+	live   bool
+	vms    []*domain.VM
+	states map[*domain.VM]*progressState
+	drawn  int
+	stop   chan struct{}
+	done   chan struct{}
+	mu     sync.Mutex
+}
+
+type progressState struct {
+	phase string
+	start time.Time
+	end   time.Time
+}
+
+func NewProgress(w io.Writer, live bool, vms []*domain.VM) *Progress {
+	p := &Progress{w: w, live: live, vms: vms, states: make(map[*domain.VM]*progressState)}
+	for _, vm := range vms {
+		p.states[vm] = &progressState{phase: string(domain.PhaseWaiting)}
+	}
+	return p
+}
+
+// Start draws a live display and keeps redrawing it until Stop.
+func (p *Progress) Start() {
+	if !p.live {
+		return
+	}
+	p.stop, p.done = make(chan struct{}), make(chan struct{})
+
+	p.mu.Lock()
+	p.draw()
+	p.mu.Unlock()
+
+	go func() {
+		defer close(p.done)
+		ticker := time.NewTicker(progressRefresh)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-p.stop:
+				return
+			case <-ticker.C:
+				p.mu.Lock()
+				p.draw()
+				p.mu.Unlock()
+			}
+		}
+	}()
+}
+
+// Report records the phase vm has entered. It is a domain.ProgressFunc.
+func (p *Progress) Report(vm *domain.VM, phase domain.CreatePhase) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	state := p.state(vm)
+	if state.start.IsZero() {
+		state.start = time.Now()
+	}
+	state.phase = string(phase)
+
+	if p.live {
+		p.draw()
+		return
+	}
+	fmt.Fprintf(p.w, "[%s] VM %s\n", strings.ToUpper(string(phase)), vm.Label())
+}
+
+// Done records the outcome of the creation of vm: err is nil once it is
+// created, or comes from domain.Skipped when there was nothing to do.
+func (p *Progress) Done(vm *domain.VM, err error) {
+	result := domain.NewTaskResult(vm, "create")
+	result.Finish(err)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	state := p.state(vm)
+	if state.start.IsZero() {
+		state.start = result.StartTime
+	}
+	state.end = result.EndTime
+
+	switch result.Status {
+	case domain.TaskStatusOK:
+		state.phase = "created"
+	case domain.TaskStatusSkipped:
+		state.phase = "skipped: " + result.Message
+	default:
+		state.phase = "failed"
+	}
+
+	if p.live {
+		p.draw()
+		return
+	}
+	switch result.Status {
+	case domain.TaskStatusOK:
+		fmt.Fprintf(p.w, "[OK] VM %s created\n", vm.Label())
+	case domain.TaskStatusSkipped:
+		fmt.Fprintf(p.w, "[SKIP] VM %s: %s\n", vm.Label(), result.Message)
+	default:
+		fmt.Fprintf(p.w, "[FAILED] VM %s: %s\n", vm.Label(), result.Message)
+	}
+}
+
+// Stop marks the VMs that never started as skipped and draws a live display
+// one last time.
+func (p *Progress) Stop() {
+	if p.stop != nil {
+		close(p.stop)
+		<-p.done
+		p.stop = nil
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, vm := range p.vms {
+		if state := p.states[vm]; state.phase == string(domain.PhaseWaiting) {
+			state.phase = "skipped"
+		}
+	}
+	if p.live {
+		p.draw()
+	}
+}
+
+func (p *Progress) state(vm *domain.VM) *progressState {
+	state, ok := p.states[vm]
+	if !ok {
+		state = &progressState{}
+		p.states[vm] = state
+		p.vms = append(p.vms, vm)
+	}
+	return state
+}
+
+// draw moves the cursor back over the lines drawn last time and rewrites
+// them. The caller holds p.mu.
+func (p *Progress) draw() {
+	width := 0
+	for _, vm := range p.vms {
+		width = max(width, len(vm.Label()))
+	}
+
+	var b strings.Builder
+	if p.drawn > 0 {
+		fmt.Fprintf(&b, "\x1b[%dA", p.drawn)
+	}
+	for _, vm := range p.vms {
+		state := p.states[vm]
+		fmt.Fprintf(&b, "\r\x1b[2K  %-*s  %-14s %s\n", width, vm.Label(), state.phase, state.elapsed())
+	}
+	p.drawn = len(p.vms)
+	io.WriteString(p.w, b.String())
+}
+
+// elapsed returns the time the VM has spent so far, or spent in total once done.
+func (s *progressState) elapsed() string {
+	if s.start.IsZero() {
+		return ""
+	}
+	end := s.end
+	if end.IsZero() {
+		end = time.Now()
+	}
+	return end.Sub(s.start).Round(time.Second).String()
+}
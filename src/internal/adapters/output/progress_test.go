@@ -0,0 +1,58 @@
+package output
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"proxima/internal/core/domain"
+)
+
+func TestProgress_Plain(t *testing.T) {
+	var buf bytes.Buffer
+	web, db, cache := domain.NewVM("web", 100), domain.NewVM("db", 101), domain.NewVM("cache", 102)
+	progress := NewProgress(&buf, false, []*domain.VM{web, db, cache})
+
+	progress.Start()
+	progress.Report(web, domain.PhaseCloning)
+	progress.Report(web, domain.PhaseStarting)
+	progress.Done(web, nil)
+	progress.Done(db, domain.Skipped("already exists"))
+	progress.Stop()
+
+	want := `[CLONING] VM web (100)
+[STARTING] VM web (100)
+[OK] VM web (100) created
+[SKIP] VM db (101): already exists
+`
+	if buf.String() != want {
+		t.Errorf("Expected:\n%s\ngot:\n%s", want, buf.String())
+	}
+}
+
+func TestProgress_Live(t *testing.T) {
+	var buf bytes.Buffer
+	web, db := domain.NewVM("web", 100), domain.NewVM("db", 101)
+	progress := NewProgress(&buf, true, []*domain.VM{web, db})
+
+	progress.Report(web, domain.PhaseResizing)
+	progress.Done(db, errors.New("clone failed"))
+	buf.Reset()
+	progress.Stop()
+
+	output := buf.String()
+	if !strings.HasPrefix(output, "\x1b[2A") {
+		t.Errorf("Expected the display to move back over its 2 lines, got %q", output)
+	}
+	lines := strings.Split(strings.TrimSuffix(output, "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected one line per VM, got %q", output)
+	}
+	if !strings.Contains(lines[0], "web (100)") || !strings.Contains(lines[0], "resizing") {
+		t.Errorf("Expected web to be resizing, got %q", lines[0])
+	}
+	if !strings.Contains(lines[1], "db (101)") || !strings.Contains(lines[1], "failed") {
+		t.Errorf("Expected db to have failed, got %q", lines[1])
+	}
+}
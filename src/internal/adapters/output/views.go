@@ -0,0 +1,267 @@
+package output
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"proxima/internal/core/domain"
+)
+
+type VMView struct {
+	ID            int      `json:"vmid" yaml:"vmid"`
+	Name          string   `json:"name" yaml:"name"`
+	Status        string   `json:"status" yaml:"status"`
+	Node          string   `json:"node,omitempty" yaml:"node,omitempty"`
+	Cores         int      `json:"cores" yaml:"cores"`
+	Memory        int      `json:"memory_mb" yaml:"memory_mb"`
+	Disk          string   `json:"disk,omitempty" yaml:"disk,omitempty"`
+	UptimeSeconds int64    `json:"uptime_seconds" yaml:"uptime_seconds"`
+	Tags          []string `json:"tags,omitempty" yaml:"tags,omitempty"`
+	IP            string   `json:"ip,omitempty" yaml:"ip,omitempty"`
+}
+
+func NewVMView(vm *domain.VM) VMView {
+	return VMView{
+		ID:            vm.ID,
+		Name:          vm.Name,
+		Status:        string(vm.Status),
+		Node:          vm.Node,
+		Cores:         vm.Cores,
+		Memory:        vm.Memory,
+		Disk:          vm.DiskSize,
+		UptimeSeconds: int64(vm.Uptime / time.Second),
+		Tags:          vm.Tags,
+		IP:            vm.IP,
+	}
+}
+
+func (VMView) Columns(wide bool) []string {
+	columns := []string{"VMID", "NAME", "STATUS", "CPU", "MEMORY"}
+	if wide {
+		columns = append(columns, "NODE", "UPTIME", "DISK", "TAGS", "IP")
+	}
+	return columns
+}
+
+func (v VMView) Values(wide bool) []string {
+	values := []string{strconv.Itoa(v.ID), v.Name, v.Status, strconv.Itoa(v.Cores), fmt.Sprintf("%d MB", v.Memory)}
+	if wide {
+		values = append(values,
+			dash(v.Node),
+			dash(formatUptime(time.Duration(v.UptimeSeconds)*time.Second)),
+			dash(v.Disk),
+			dash(strings.Join(v.Tags, ";")),
+			dash(v.IP),
+		)
+	}
+	return values
+}
+
+type CommandView struct {
+	VMID       int      `json:"vmid" yaml:"vmid"`
+	Command    string   `json:"command" yaml:"command"`
+	Args       []string `json:"args,omitempty" yaml:"args,omitempty"`
+	Status     string   `json:"status" yaml:"status"`
+	Output     string   `json:"output,omitempty" yaml:"output,omitempty"`
+	Error      string   `json:"error,omitempty" yaml:"error,omitempty"`
+	DurationMs int64    `json:"duration_ms" yaml:"duration_ms"`
+}
+
+func NewCommandView(command *domain.Command) CommandView {
+	return CommandView{
+		VMID:       command.VMID,
+		Command:    command.Command,
+		Args:       command.Args,
+		Status:     string(command.Status),
+		Output:     command.Output,
+		Error:      command.Error,
+		DurationMs: command.Duration().Milliseconds(),
+	}
+}
+
+func (CommandView) Columns(wide bool) []string {
+	return []string{"VMID", "COMMAND", "STATUS", "DURATION", "ERROR"}
+}
+
+func (v CommandView) Values(wide bool) []string {
+	command := strings.TrimSpace(v.Command + " " + strings.Join(v.Args, " "))
+	duration := (time.Duration(v.DurationMs) * time.Millisecond).String()
+	return []string{strconv.Itoa(v.VMID), command, v.Status, duration, dash(v.Error)}
+}
+
+type InterfaceView struct {
+	Name      string   `json:"name" yaml:"name"`
+	Source    string   `json:"source" yaml:"source"`
+	MAC       string   `json:"mac,omitempty" yaml:"mac,omitempty"`
+	Addresses []string `json:"addresses" yaml:"addresses"`
+}
+
+func NewInterfaceView(iface domain.NetworkInterface) InterfaceView {
+	addresses := make([]string, len(iface.Addresses))
+	for i, addr := range iface.Addresses {
+		addresses[i] = addr.String()
+	}
+	return InterfaceView{
+		Name:      iface.Name,
+		Source:    iface.Source,
+		MAC:       iface.MAC,
+		Addresses: addresses,
+	}
+}
+
+func (InterfaceView) Columns(wide bool) []string {
+	return []string{"INTERFACE", "SOURCE", "MAC", "ADDRESSES"}
+}
+
+func (v InterfaceView) Values(wide bool) []string {
+	return []string{v.Name, v.Source, dash(v.MAC), dash(strings.Join(v.Addresses, ","))}
+}
+
+// OperationView is an operation recorded by a dry run.
+type OperationView struct {
+	Step      int    `json:"step" yaml:"step"`
+	Operation string `json:"operation" yaml:"operation"`
+}
+
+func (OperationView) Columns(wide bool) []string {
+	return []string{"STEP", "OPERATION"}
+}
+
+func (v OperationView) Values(wide bool) []string {
+	return []string{strconv.Itoa(v.Step), v.Operation}
+}
+
+type PlanStepView struct {
+	Action   string `json:"action" yaml:"action"`
+	VMID     int    `json:"vmid" yaml:"vmid"`
+	Name     string `json:"name" yaml:"name"`
+	Template string `json:"template,omitempty" yaml:"template,omitempty"`
+	Reason   string `json:"reason,omitempty" yaml:"reason,omitempty"`
+}
+
+func NewPlanStepView(step domain.PlanStep) PlanStepView {
+	return PlanStepView{
+		Action:   string(step.Action),
+		VMID:     step.VM.ID,
+		Name:     step.VM.Name,
+		Template: step.VM.Template,
+		Reason:   step.Reason,
+	}
+}
+
+func (PlanStepView) Columns(wide bool) []string {
+	return []string{"ACTION", "VMID", "NAME", "TEMPLATE", "REASON"}
+}
+
+func (v PlanStepView) Values(wide bool) []string {
+	return []string{v.Action, vmidOrAuto(v.VMID), v.Name, dash(v.Template), dash(v.Reason)}
+}
+
+type TemplateView struct {
+	VMID    int      `json:"vmid,omitempty" yaml:"vmid,omitempty"`
+	Name    string   `json:"name,omitempty" yaml:"name,omitempty"`
+	Aliases []string `json:"aliases,omitempty" yaml:"aliases,omitempty"`
+	Source  string   `json:"source,omitempty" yaml:"source,omitempty"`
+	Found   bool     `json:"found" yaml:"found"`
+}
+
+func NewTemplateView(entry domain.TemplateEntry) TemplateView {
+	return TemplateView{
+		VMID:    entry.ID,
+		Name:    entry.Name,
+		Aliases: entry.Aliases,
+		Source:  entry.Source,
+		Found:   entry.Found(),
+	}
+}
+
+func (TemplateView) Columns(wide bool) []string {
+	return []string{"VMID", "NAME", "ALIASES"}
+}
+
+// Values shows an alias referring to no template with what it refers to.
+func (v TemplateView) Values(wide bool) []string {
+	if !v.Found {
+		return []string{"-", "not found: " + v.Source, strings.Join(v.Aliases, ",")}
+	}
+	return []string{strconv.Itoa(v.VMID), v.Name, dash(strings.Join(v.Aliases, ","))}
+}
+
+type SettingView struct {
+	Key    string `json:"key" yaml:"key"`
+	Value  string `json:"value" yaml:"value"`
+	Source string `json:"source" yaml:"source"`
+}
+
+func NewSettingView(setting domain.Setting) SettingView {
+	return SettingView{Key: setting.Key, Value: setting.Value, Source: setting.Source}
+}
+
+func (SettingView) Columns(wide bool) []string {
+	return []string{"KEY", "VALUE", "SOURCE"}
+}
+
+func (v SettingView) Values(wide bool) []string {
+	return []string{v.Key, v.Value, v.Source}
+}
+
+type TaskResultView struct {
+	VMID       int    `json:"vmid" yaml:"vmid"`
+	Name       string `json:"name,omitempty" yaml:"name,omitempty"`
+	Action     string `json:"action" yaml:"action"`
+	Status     string `json:"status" yaml:"status"`
+	Message    string `json:"message,omitempty" yaml:"message,omitempty"`
+	DurationMs int64  `json:"duration_ms" yaml:"duration_ms"`
+}
+
+func NewTaskResultView(result *domain.TaskResult) TaskResultView {
+	return TaskResultView{
+		VMID:       result.VMID,
+		Name:       result.Name,
+		Action:     result.Action,
+		Status:     string(result.Status),
+		Message:    result.Message,
+		DurationMs: result.Duration().Milliseconds(),
+	}
+}
+
+func (TaskResultView) Columns(wide bool) []string {
+	return []string{"VMID", "NAME", "ACTION", "STATUS", "DURATION", "MESSAGE"}
+}
+
+func (v TaskResultView) Values(wide bool) []string {
+	duration := (time.Duration(v.DurationMs) * time.Millisecond).Round(100 * time.Millisecond).String()
+	return []string{strconv.Itoa(v.VMID), dash(v.Name), v.Action, v.Status, duration, dash(v.Message)}
+}
+
+func formatUptime(uptime time.Duration) string {
+	if uptime <= 0 {
+		return ""
+	}
+	days := int(uptime.Hours()) / 24
+	hours := int(uptime.Hours()) % 24
+	minutes := int(uptime.Minutes()) % 60
+	if days > 0 {
+		return fmt.Sprintf("%dd%dh", days, hours)
+	}
+	if hours > 0 {
+		return fmt.Sprintf("%dh%dm", hours, minutes)
+	}
+	return fmt.Sprintf("%dm", minutes)
+}
+
+func vmidOrAuto(id int) string {
+	if id == 0 {
+		return "auto"
+	}
+	return strconv.Itoa(id)
+}
+
+func dash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,58 @@
+package proxmox
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+
+	"proxima/internal/core/domain"
+	"proxima/internal/core/ports"
+)
+
+// CreateToken creates an API token for its user and sets its secret.
+func (p *ProxmoxAdapter) CreateToken(token *domain.APIToken) error {
+	privSep := 0
+	if token.PrivSep {
+		privSep = 1
+	}
+	call := apiCall{
+		Method: "POST",
+		Path:   fmt.Sprintf("/access/users/%s/token/%s", url.PathEscape(token.User), url.PathEscape(token.Name)),
+		Params: map[string]any{"privsep": privSep},
+	}
+	if token.Comment != "" {
+		call.Params["comment"] = token.Comment
+	}
+
+	body, err := p.do(call, fmt.Sprintf("failed to create API token %s", token.ID()))
+	if err != nil {
+		return err
+	}
+
+	var tokenResp struct {
+		Data struct {
+			Value string `json:"value"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &tokenResp); err != nil {
+		return fmt.Errorf("failed to parse API token response: %w", err)
+	}
+	if tokenResp.Data.Value == "" {
+		return fmt.Errorf("no secret returned for API token %s", token.ID())
+	}
+	token.Secret = tokenResp.Data.Value
+	return nil
+}
+
+// GrantRole gives role on path to an API token.
+func (p *ProxmoxAdapter) GrantRole(path, role, tokenID string) error {
+	call := apiCall{
+		Method: "PUT",
+		Path:   "/access/acl",
+		Params: map[string]any{"path": path, "roles": role, "tokens": tokenID},
+	}
+	_, err := p.do(call, fmt.Sprintf("failed to grant role %s on %s to %s", role, path, tokenID))
+	return err
+}
+
+var _ ports.AccessRepository = (*ProxmoxAdapter)(nil)
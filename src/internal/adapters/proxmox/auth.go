@@ -0,0 +1,220 @@
+package proxmox
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"proxima/internal/core/domain"
+)
+
+// ticketRefresh is the age at which a ticket is renewed. Proxmox tickets are
+// valid for two hours, so long runs renew well before they expire.
+const ticketRefresh = 90 * time.Minute
+
+// SetTOTPProvider sets the function asked for a TOTP code when the user has
+// two-factor authentication enabled. Without one such logins fail.
+func (p *ProxmoxAdapter) SetTOTPProvider(provider func() (string, error)) {
+	p.totp = provider
+}
+
+// send authenticates req and sends it, logging in first when needed. A 401
+// under ticket authentication, e.g. once pveproxy restarted, is retried once
+// with a fresh ticket. Transport failures are returned as such; responses,
+// whatever their status, are left to the caller.
+func (p *ProxmoxAdapter) send(req *http.Request) (*http.Response, error) {
+	ticket, csrf, err := p.session()
+	if err != nil {
+		return nil, err
+	}
+	p.setAuthHeader(req, ticket, csrf)
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, domain.WrapError(domain.ErrorKindTransport, err)
+	}
+	if resp.StatusCode != http.StatusUnauthorized || p.apiToken != "" || (req.Body != nil && req.GetBody == nil) {
+		return resp, nil
+	}
+	resp.Body.Close()
+
+	log.Printf("Proxmox rejected the ticket for %s, logging in again", p.user)
+	if ticket, csrf, err = p.relogin(ticket); err != nil {
+		return nil, err
+	}
+	retry := req.Clone(req.Context())
+	if req.GetBody != nil {
+		if retry.Body, err = req.GetBody(); err != nil {
+			return nil, err
+		}
+	}
+	p.setAuthHeader(retry, ticket, csrf)
+
+	resp, err = p.client.Do(retry)
+	if err != nil {
+		return nil, domain.WrapError(domain.ErrorKindTransport, err)
+	}
+	return resp, nil
+}
+
+// session returns the ticket and CSRF token to send, logging in when there is
+// no ticket yet and renewing it once it gets old.
+func (p *ProxmoxAdapter) session() (string, string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	switch {
+	case p.token == "":
+		if err := p.login(); err != nil {
+			return "", "", err
+		}
+	case p.apiToken == "" && time.Since(p.ticketTime) > ticketRefresh:
+		if err := p.renew(); err != nil {
+			log.Printf("Failed to renew the Proxmox ticket, logging in again: %v", err)
+			if err := p.login(); err != nil {
+				return "", "", err
+			}
+		}
+	}
+	return p.token, p.csrfToken, nil
+}
+
+// relogin replaces the rejected ticket, unless another request replaced it
+// in the meantime.
+func (p *ProxmoxAdapter) relogin(rejected string) (string, string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.token == rejected {
+		if err := p.login(); err != nil {
+			return "", "", err
+		}
+	}
+	return p.token, p.csrfToken, nil
+}
+
+func (p *ProxmoxAdapter) setAuthHeader(req *http.Request, ticket, csrf string) {
+	// Use token authentication if API token is available
+	if p.apiToken != "" {
+		req.Header.Set("Authorization", fmt.Sprintf("PVEAPIToken=%s", p.apiToken))
+		return
+	}
+	req.Header.Set("Cookie", fmt.Sprintf("PVEAuthCookie=%s", ticket))
+	// Proxmox refuses writes made with a ticket but without its CSRF token
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		req.Header.Set("CSRFPreventionToken", csrf)
+	}
+}
+
+// login gets a new ticket, answering the TOTP challenge of users with
+// two-factor authentication. The caller holds p.mu.
+func (p *ProxmoxAdapter) login() error {
+	// If API token is provided, use token authentication
+	if p.apiToken != "" {
+		log.Printf("Using API token authentication for Proxmox at %s:%d", p.host, p.port)
+		p.token = p.apiToken
+		return nil
+	}
+
+	// Otherwise use password authentication
+	log.Printf("Logging into Proxmox at %s:%d as user %s", p.host, p.port, p.user)
+
+	login, err := p.requestTicket(map[string]string{
+		"username": p.user,
+		"password": p.password,
+	})
+	if err != nil {
+		return err
+	}
+
+	if login.NeedTFA == 1 {
+		if p.totp == nil {
+			return domain.Errorf(domain.ErrorKindAuth, "authentication failed - user %s requires a TOTP code", p.user)
+		}
+		code, err := p.totp()
+		if err != nil {
+			return domain.WrapError(domain.ErrorKindAuth, fmt.Errorf("failed to read TOTP code: %w", err))
+		}
+		login, err = p.requestTicket(map[string]string{
+			"username":      p.user,
+			"tfa-challenge": login.Ticket,
+			"password":      "totp:" + code,
+		})
+		if err != nil {
+			return err
+		}
+		if login.NeedTFA == 1 {
+			return domain.Errorf(domain.ErrorKindAuth, "authentication failed - TOTP code refused for user %s", p.user)
+		}
+	}
+
+	p.setTicket(login)
+	return nil
+}
+
+// renew exchanges the current ticket for a new one. Proxmox accepts a valid
+// ticket as the password, without asking for the second factor again. The
+// caller holds p.mu.
+func (p *ProxmoxAdapter) renew() error {
+	login, err := p.requestTicket(map[string]string{
+		"username": p.user,
+		"password": p.token,
+	})
+	if err != nil {
+		return err
+	}
+	if login.NeedTFA == 1 {
+		return domain.Errorf(domain.ErrorKindAuth, "ticket renewal asked for a second factor")
+	}
+	p.setTicket(login)
+	return nil
+}
+
+func (p *ProxmoxAdapter) setTicket(login ProxmoxLoginResponse) {
+	p.token = login.Ticket
+	p.csrfToken = login.CSRFPreventionToken
+	p.ticketTime = time.Now()
+}
+
+func (p *ProxmoxAdapter) requestTicket(data map[string]string) (ProxmoxLoginResponse, error) {
+	var none ProxmoxLoginResponse
+	url := fmt.Sprintf("https://%s:%d/api2/json/access/ticket", p.host, p.port)
+
+	jsonData, _ := json.Marshal(data)
+
+	resp, err := p.client.Post(url, "application/json", bytes.NewBuffer(jsonData))
+	if err != nil {
+		log.Printf("Failed to login to Proxmox: %v", err)
+		return none, domain.WrapError(domain.ErrorKindTransport, fmt.Errorf("failed to login to Proxmox: %w", err))
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return none, fmt.Errorf("failed to read login response: %w", err)
+	}
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		return none, domain.Errorf(domain.ErrorKindAuth, "authentication failed - check credentials in config.yaml (user: %s, host: %s)", p.user, p.host)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return none, statusError(resp.StatusCode, body, "failed to login to Proxmox")
+	}
+
+	var loginResp struct {
+		Data ProxmoxLoginResponse `json:"data"`
+	}
+
+	if err := json.Unmarshal(body, &loginResp); err != nil {
+		return none, fmt.Errorf("failed to parse login response: %w", err)
+	}
+
+	if loginResp.Data.Ticket == "" {
+		return none, domain.Errorf(domain.ErrorKindAuth, "authentication failed - no ticket returned for user %s", p.user)
+	}
+	return loginResp.Data, nil
+}
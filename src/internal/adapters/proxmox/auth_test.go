@@ -0,0 +1,147 @@
+package proxmox
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+// fakeCluster answers /access/ticket, asking for a TOTP code when tfa is set,
+// and a status endpoint that needs a current ticket and, for writes, its
+// CSRF token.
+type fakeCluster struct {
+	tfa     bool
+	mu      sync.Mutex
+	issued  int
+	current string
+	writes  int
+}
+
+func (c *fakeCluster) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if r.URL.Path == "/api2/json/access/ticket" {
+		var data map[string]string
+		json.NewDecoder(r.Body).Decode(&data)
+		if c.tfa && data["tfa-challenge"] == "" {
+			json.NewEncoder(w).Encode(map[string]any{"data": map[string]any{"ticket": "PVE:!tfa!challenge", "NeedTFA": 1}})
+			return
+		}
+		if c.tfa && data["password"] != "totp:123456" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		c.issued++
+		c.current = fmt.Sprintf("ticket%d", c.issued)
+		json.NewEncoder(w).Encode(map[string]any{"data": map[string]any{"ticket": c.current, "CSRFPreventionToken": "csrf-" + c.current}})
+		return
+	}
+
+	cookie, err := r.Cookie("PVEAuthCookie")
+	if err != nil || cookie.Value != c.current {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	if r.Method != http.MethodGet && r.Header.Get("CSRFPreventionToken") != "csrf-"+c.current {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	if r.Method != http.MethodGet {
+		c.writes++
+	}
+	w.Write([]byte(`{"data":null}`))
+}
+
+func newTestAdapter(t *testing.T, cluster *fakeCluster) *ProxmoxAdapter {
+	server := httptest.NewTLSServer(cluster)
+	t.Cleanup(server.Close)
+
+	u, _ := url.Parse(server.URL)
+	port, _ := strconv.Atoi(u.Port())
+	return NewProxmoxAdapter(u.Hostname(), port, "root@pam", "secret", "pve")
+}
+
+func TestSendWritesWithCSRFToken(t *testing.T) {
+	cluster := &fakeCluster{}
+	p := newTestAdapter(t, cluster)
+
+	if _, err := p.do(p.powerCall(100, "start"), "failed to start VM"); err != nil {
+		t.Fatalf("Expected write to succeed, got %v", err)
+	}
+	if cluster.writes != 1 {
+		t.Errorf("Expected 1 write, got %d", cluster.writes)
+	}
+}
+
+func TestSendRetriesOnceWithNewTicket(t *testing.T) {
+	cluster := &fakeCluster{}
+	p := newTestAdapter(t, cluster)
+
+	if _, err := p.do(p.powerCall(100, "start"), "failed to start VM"); err != nil {
+		t.Fatalf("Expected write to succeed, got %v", err)
+	}
+
+	// The cluster forgets the ticket, as after a restart of pveproxy
+	cluster.mu.Lock()
+	cluster.current = "revoked"
+	cluster.mu.Unlock()
+
+	if _, err := p.do(p.powerCall(100, "start"), "failed to start VM"); err != nil {
+		t.Fatalf("Expected write to succeed after a new login, got %v", err)
+	}
+	if cluster.issued != 2 {
+		t.Errorf("Expected 2 tickets issued, got %d", cluster.issued)
+	}
+	if cluster.writes != 2 {
+		t.Errorf("Expected 2 writes, got %d", cluster.writes)
+	}
+}
+
+func TestSessionRenewsOldTicket(t *testing.T) {
+	cluster := &fakeCluster{}
+	p := newTestAdapter(t, cluster)
+
+	if _, err := p.do(p.powerCall(100, "start"), "failed to start VM"); err != nil {
+		t.Fatalf("Expected write to succeed, got %v", err)
+	}
+	p.ticketTime = p.ticketTime.Add(-ticketRefresh)
+
+	if _, err := p.do(p.powerCall(100, "start"), "failed to start VM"); err != nil {
+		t.Fatalf("Expected write to succeed, got %v", err)
+	}
+	if cluster.issued != 2 || p.token != "ticket2" {
+		t.Errorf("Expected the ticket to be renewed, got %d tickets and %q", cluster.issued, p.token)
+	}
+}
+
+func TestLoginAnswersTOTPChallenge(t *testing.T) {
+	tests := []struct {
+		name     string
+		provider func() (string, error)
+		wantErr  bool
+	}{
+		{"valid code", func() (string, error) { return "123456", nil }, false},
+		{"wrong code", func() (string, error) { return "000000", nil }, true},
+		{"no provider", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newTestAdapter(t, &fakeCluster{tfa: true})
+			if tt.provider != nil {
+				p.SetTOTPProvider(tt.provider)
+			}
+
+			_, err := p.do(p.powerCall(100, "start"), "failed to start VM")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Expected error %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
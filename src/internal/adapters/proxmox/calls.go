@@ -0,0 +1,281 @@
+package proxmox
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"proxima/internal/core/domain"
+	"proxima/internal/core/ports"
+)
+
+// apiCall is a mutating request to the Proxmox API. Operations are built as
+// calls first so that dry runs can print exactly what would be sent.
+type apiCall struct {
+	Method string
+	Path   string
+	Params map[string]any
+}
+
+func (c apiCall) String() string {
+	if len(c.Params) == 0 {
+		return fmt.Sprintf("%s %s", c.Method, c.Path)
+	}
+	params, _ := json.Marshal(c.Params)
+	return fmt.Sprintf("%s %s %s", c.Method, c.Path, params)
+}
+
+// createStep is a call of a VM creation and the phase it starts.
+type createStep struct {
+	phase   domain.CreatePhase
+	call    apiCall
+	failure string
+}
+
+// createSteps resolves the template of vm and returns the calls cloning it,
+// applying the VM resources to the clone and growing its boot disk.
+func (p *ProxmoxAdapter) createSteps(vm *domain.VM) ([]createStep, error) {
+	templateID, err := strconv.Atoi(vm.Template)
+	if err != nil {
+		// Try to find by name
+		templateVM, err := p.GetByName(vm.Template)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve template '%s': %w", vm.Template, err)
+		}
+		templateID = templateVM.ID
+	}
+
+	clone := apiCall{
+		Method: "POST",
+		Path:   fmt.Sprintf("/nodes/%s/qemu/%d/clone", p.node, templateID),
+		Params: map[string]any{
+			"newid": vm.ID,
+			"name":  vm.Name,
+			"full":  1, // Full clone
+		},
+	}
+	if vm.Storage != "" {
+		clone.Params["storage"] = vm.Storage
+	}
+
+	netConfig := fmt.Sprintf("model=%s,bridge=%s", vm.Network.Model, vm.Network.Bridge)
+	if vm.Network.VLAN > 0 {
+		netConfig += fmt.Sprintf(",tag=%d", vm.Network.VLAN)
+	}
+
+	// Disk size is not set here: 'scsi0' would replace the cloned disk
+	// reference, so the disk is grown through the resize endpoint instead
+	config := apiCall{
+		Method: "POST",
+		Path:   fmt.Sprintf("/nodes/%s/qemu/%d/config", p.node, vm.ID),
+		Params: map[string]any{
+			"cores":  vm.Cores,
+			"memory": vm.Memory,
+			"net0":   netConfig,
+		},
+	}
+	if vm.Protected {
+		config.Params["protection"] = 1
+	}
+	if startup := vm.Startup(); startup != "" {
+		config.Params["startup"] = startup
+	}
+	if vm.OSType != "" {
+		config.Params["ostype"] = vm.OSType
+	}
+	if vm.CIUser != "" {
+		config.Params["ciuser"] = vm.CIUser
+	}
+
+	steps := []createStep{
+		{domain.PhaseCloning, clone, "failed to clone VM"},
+		{domain.PhaseConfiguring, config, "VM cloned but failed to update config"},
+	}
+
+	resize, err := p.resizeCall(templateID, vm)
+	if err != nil {
+		return nil, err
+	}
+	if resize != nil {
+		steps = append(steps, createStep{domain.PhaseResizing, *resize, "VM cloned but failed to resize its disk"})
+	}
+	return steps, nil
+}
+
+// resizeCall returns the call growing the boot disk of a clone of the template
+// to the disk size of vm, or nil when the template disk is at least that
+// large: Proxmox cannot shrink disks.
+func (p *ProxmoxAdapter) resizeCall(templateID int, vm *domain.VM) (*apiCall, error) {
+	if vm.DiskSize == "" {
+		return nil, nil
+	}
+	size, err := domain.ParseDiskSize(vm.DiskSize)
+	if err != nil {
+		return nil, err
+	}
+
+	var configResp struct {
+		Data map[string]any `json:"data"`
+	}
+	if err := p.getJSON(fmt.Sprintf("/nodes/%s/qemu/%d/config", p.node, templateID), &configResp); err != nil {
+		return nil, fmt.Errorf("failed to read the disks of template %d: %w", templateID, err)
+	}
+	config := make(map[string]string)
+	for key, value := range configResp.Data {
+		if text, ok := value.(string); ok {
+			config[key] = text
+		}
+	}
+
+	disk, current, ok := domain.BootDisk(config)
+	if !ok || size <= current {
+		return nil, nil
+	}
+	return &apiCall{
+		Method: "PUT",
+		Path:   fmt.Sprintf("/nodes/%s/qemu/%d/resize", p.node, vm.ID),
+		Params: map[string]any{"disk": disk, "size": vm.DiskSize},
+	}, nil
+}
+
+// deleteCall destroys a VM. DELETE takes its parameters in the query string.
+func (p *ProxmoxAdapter) deleteCall(id int, purge bool) apiCall {
+	path := fmt.Sprintf("/nodes/%s/qemu/%d", p.node, id)
+	if purge {
+		path += "?destroy-unreferenced-disks=1&purge=1"
+	}
+	return apiCall{Method: "DELETE", Path: path}
+}
+
+// powerCall returns the call of a power action. Hibernation is a suspend to disk.
+func (p *ProxmoxAdapter) powerCall(id int, action string) apiCall {
+	if action == "hibernate" {
+		return apiCall{
+			Method: "POST",
+			Path:   fmt.Sprintf("/nodes/%s/qemu/%d/status/suspend", p.node, id),
+			Params: map[string]any{"todisk": 1},
+		}
+	}
+	return apiCall{Method: "POST", Path: fmt.Sprintf("/nodes/%s/qemu/%d/status/%s", p.node, id, action)}
+}
+
+// do sends a call and returns the response body. failure prefixes the error.
+func (p *ProxmoxAdapter) do(call apiCall, failure string) ([]byte, error) {
+	var payload io.Reader
+	if len(call.Params) > 0 {
+		data, err := json.Marshal(call.Params)
+		if err != nil {
+			return nil, err
+		}
+		payload = bytes.NewBuffer(data)
+	}
+
+	url := fmt.Sprintf("https://%s:%d/api2/json%s", p.host, p.port, call.Path)
+	req, err := http.NewRequest(call.Method, url, payload)
+	if err != nil {
+		return nil, err
+	}
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := p.send(req)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", failure, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("%s: failed to read response: %w", failure, err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, statusError(resp.StatusCode, body, "%s", failure)
+	}
+	return body, nil
+}
+
+// DefaultTaskTimeout is how long a task may run unless SetTaskTimeout says
+// otherwise. Full clones of large disks take minutes.
+const DefaultTaskTimeout = 30 * time.Minute
+
+// waitTask waits for the end of the task whose UPID is the data of a response.
+// Clones and other long operations answer at once with such a UPID, and the VM
+// stays locked until the task ends. Responses without a UPID return at once,
+// and tasks still running after the task timeout are a timeout error.
+func (p *ProxmoxAdapter) waitTask(body []byte, failure string) error {
+	var taskResp struct {
+		Data any `json:"data"`
+	}
+	if err := json.Unmarshal(body, &taskResp); err != nil {
+		return fmt.Errorf("%s: invalid response: %w", failure, err)
+	}
+	upid, ok := taskResp.Data.(string)
+	if !ok || !strings.HasPrefix(upid, "UPID:") {
+		return nil
+	}
+
+	path := fmt.Sprintf("/nodes/%s/tasks/%s/status", p.node, upid)
+	opts := domain.DefaultWaitOptions().WithTimeout(p.taskTimeout)
+	deadline := time.Now().Add(opts.Timeout)
+	interval := opts.Interval
+	for {
+		var statusResp struct {
+			Data struct {
+				Status     string `json:"status"`
+				ExitStatus string `json:"exitstatus"`
+			} `json:"data"`
+		}
+		if err := p.getJSON(path, &statusResp); err != nil {
+			return fmt.Errorf("%s: failed to follow task %s: %w", failure, upid, err)
+		}
+
+		if statusResp.Data.Status == "stopped" {
+			exit := statusResp.Data.ExitStatus
+			if exit == "OK" || strings.HasPrefix(exit, "WARNINGS") {
+				return nil
+			}
+			return domain.WrapError(classifyStatus(0, exit), fmt.Errorf("%s: task failed: %s", failure, exit))
+		}
+
+		if time.Now().After(deadline) {
+			return domain.Errorf(domain.ErrorKindTimeout, "%s: task %s still running after %s", failure, upid, opts.Timeout)
+		}
+		if wait := time.Until(deadline); wait < interval {
+			interval = wait
+		}
+		time.Sleep(interval)
+		interval = opts.NextInterval(interval)
+	}
+}
+
+// PlanCreate returns the API calls Create would send for vm.
+func (p *ProxmoxAdapter) PlanCreate(vm *domain.VM) ([]string, error) {
+	steps, err := p.createSteps(vm)
+	if err != nil {
+		return nil, err
+	}
+	calls := make([]string, len(steps))
+	for i, step := range steps {
+		calls[i] = step.call.String()
+	}
+	return calls, nil
+}
+
+// PlanDelete returns the API call Delete would send.
+func (p *ProxmoxAdapter) PlanDelete(id int, purge bool) ([]string, error) {
+	return []string{p.deleteCall(id, purge).String()}, nil
+}
+
+// PlanPower returns the API call of a power action.
+func (p *ProxmoxAdapter) PlanPower(id int, action string) ([]string, error) {
+	return []string{p.powerCall(id, action).String()}, nil
+}
+
+var _ ports.CommandPlanner = (*ProxmoxAdapter)(nil)
@@ -0,0 +1,49 @@
+package proxmox
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"proxima/internal/core/domain"
+)
+
+func TestWaitTask(t *testing.T) {
+	// The task never ends
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"data":{"status":"running"}}`))
+	}))
+	t.Cleanup(server.Close)
+	u, _ := url.Parse(server.URL)
+	port, _ := strconv.Atoi(u.Port())
+	adapter := NewProxmoxAdapterWithToken(u.Hostname(), port, "", "", "root@pam!ci=secret", "pve", "")
+	adapter.SetTaskTimeout(50 * time.Millisecond)
+
+	tests := []struct {
+		name string
+		body string
+		kind error
+	}{
+		{"no task", `{"data":null}`, nil},
+		{"hanging task", `{"data":"UPID:pve:0001:clone"}`, domain.ErrTimeout},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := adapter.waitTask([]byte(tt.body), "clone failed")
+			if tt.kind == nil && err != nil {
+				t.Errorf("Expected no error, got %v", err)
+			}
+			if tt.kind != nil && !errors.Is(err, tt.kind) {
+				t.Errorf("Expected %v, got %v", tt.kind, err)
+			}
+		})
+	}
+
+	if err := adapter.waitTask([]byte("<html>"), "clone failed"); err == nil {
+		t.Error("Expected an error for a malformed response")
+	}
+}
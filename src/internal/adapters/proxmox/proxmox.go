@@ -1,17 +1,16 @@
 package proxmox
 
 import (
-	"bytes"
 	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"io"
-	"log"
 	"net/http"
 	"proxima/internal/core/domain"
 	"proxima/internal/core/ports"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -25,23 +24,37 @@ type ProxmoxAdapter struct {
 	token    string
 	apiToken string
 	vmIPBase string
+	ipPrefs  domain.IPPreferences
+
+	// taskTimeout bounds the wait for the end of a task, see waitTask
+	taskTimeout time.Duration
+
+	csrfToken  string
+	ticketTime time.Time
+	totp       func() (string, error)
+	mu         sync.Mutex
 }
 
 type ProxmoxVM struct {
-	VMID    int     `json:"vmid"`
-	Name    string  `json:"name"`
-	Status  string  `json:"status"`
-	CPU     float64 `json:"cpu"`
-	Memory  int     `json:"mem"`
-	MaxMem  int     `json:"maxmem"`
-	Disk    int     `json:"disk"`
-	MaxDisk int     `json:"maxdisk"`
-	Uptime  int     `json:"uptime"`
+	VMID      int     `json:"vmid"`
+	Name      string  `json:"name"`
+	Status    string  `json:"status"`
+	CPU       float64 `json:"cpu"`
+	Memory    int     `json:"mem"`
+	MaxMem    int     `json:"maxmem"`
+	Disk      int     `json:"disk"`
+	MaxDisk   int     `json:"maxdisk"`
+	Uptime    int     `json:"uptime"`
+	Tags      string  `json:"tags"`
+	QMPStatus string  `json:"qmpstatus"`
+	Lock      string  `json:"lock"`
+	Template  int     `json:"template"`
 }
 
 type ProxmoxLoginResponse struct {
 	Ticket              string `json:"ticket"`
 	CSRFPreventionToken string `json:"CSRFPreventionToken"`
+	NeedTFA             int    `json:"NeedTFA"`
 }
 
 func NewProxmoxAdapter(host string, port int, user, password, node string) *ProxmoxAdapter {
@@ -77,176 +90,72 @@ func NewProxmoxAdapterWithToken(host string, port int, user, password, apiToken,
 		node:     node,
 		apiToken: apiToken,
 		vmIPBase: vmIPBase,
-	}
-}
-
-func (p *ProxmoxAdapter) login() error {
-	// If API token is provided, use token authentication
-	if p.apiToken != "" {
-		log.Printf("Using API token authentication for Proxmox at %s:%d", p.host, p.port)
-		p.token = p.apiToken
-		return nil
-	}
-
-	// Otherwise use password authentication
-	log.Printf("Logging into Proxmox at %s:%d as user %s", p.host, p.port, p.user)
-
-	url := fmt.Sprintf("https://%s:%d/api2/json/access/ticket", p.host, p.port)
-
-	data := map[string]string{
-		"username": p.user,
-		"password": p.password,
-	}
-
-	jsonData, _ := json.Marshal(data)
-
-	resp, err := p.client.Post(url, "application/json", bytes.NewBuffer(jsonData))
-	if err != nil {
-		log.Printf("Failed to login to Proxmox: %v", err)
-		return fmt.Errorf("failed to login to Proxmox: %w", err)
-	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return fmt.Errorf("failed to read login response: %w", err)
-	}
-
-	var loginResp struct {
-		Data ProxmoxLoginResponse `json:"data"`
-	}
 
-	if err := json.Unmarshal(body, &loginResp); err != nil {
-		return fmt.Errorf("failed to parse login response: %w", err)
+		taskTimeout: DefaultTaskTimeout,
 	}
-
-	p.token = loginResp.Data.Ticket
-	return nil
 }
 
-func (p *ProxmoxAdapter) setAuthHeader(req *http.Request) {
-	// Use token authentication if API token is available
-	if p.apiToken != "" {
-		req.Header.Set("Authorization", fmt.Sprintf("PVEAPIToken=%s", p.apiToken))
-	} else {
-		req.Header.Set("Cookie", fmt.Sprintf("PVEAuthCookie=%s", p.token))
-	}
+// statusError builds the error for a non-OK API response, classified by status
+// code and by the messages Proxmox uses for missing or locked VMs.
+func statusError(status int, body []byte, format string, args ...any) error {
+	response := strings.TrimSpace(string(body))
+	err := fmt.Errorf("%s, status: %d, response: %s", fmt.Sprintf(format, args...), status, response)
+	return domain.WrapError(classifyStatus(status, response), err)
 }
 
-func (p *ProxmoxAdapter) Create(vm *domain.VM) error {
-	log.Printf("Creating VM %s (ID: %d) from template '%s'", vm.Name, vm.ID, vm.Template)
-
-	if p.token == "" {
-		if err := p.login(); err != nil {
-			return err
-		}
-	}
-
-	// 1. Resolve Template ID
-	var templateID int
-	if id, err := strconv.Atoi(vm.Template); err == nil {
-		templateID = id
-	} else {
-		// Try to find by name
-		templateVM, err := p.GetByName(vm.Template)
-		if err != nil {
-			return fmt.Errorf("failed to resolve template '%s': %w", vm.Template, err)
-		}
-		templateID = templateVM.ID
-	}
-
-	// 2. Clone VM
-	log.Printf("Cloning from Template ID: %d", templateID)
-	url := fmt.Sprintf("https://%s:%d/api2/json/nodes/%s/qemu/%d/clone", p.host, p.port, p.node, templateID)
-
-	cloneData := map[string]any{
-		"newid": vm.ID,
-		"name":  vm.Name,
-		"full":  1, // Full clone
-	}
-
-	jsonData, _ := json.Marshal(cloneData)
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
-	if err != nil {
-		return err
-	}
-	p.setAuthHeader(req)
-	req.Header.Set("Content-Type", "application/json")
-
-	resp, err := p.client.Do(req)
-	if err != nil {
-		return fmt.Errorf("failed to clone VM: %w", err)
-	}
-	defer resp.Body.Close()
+func classifyStatus(status int, response string) domain.ErrorKind {
+	switch {
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		return domain.ErrorKindAuth
+	case status == http.StatusNotFound || strings.Contains(response, "does not exist"):
+		return domain.ErrorKindNotFound
+	case strings.Contains(response, "locked") || strings.Contains(response, "can't lock") || strings.Contains(response, "already exists"):
+		return domain.ErrorKindConflict
+	case status == http.StatusBadRequest:
+		return domain.ErrorKindValidation
+	case status == 595 || status == http.StatusBadGateway || status == http.StatusServiceUnavailable || status == http.StatusGatewayTimeout:
+		// 595 is what pveproxy returns when it cannot reach another node
+		return domain.ErrorKindTransport
+	}
+	return ""
+}
 
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("failed to clone VM (status %d): %s", resp.StatusCode, string(body))
-	}
-
-	// Wait for task? The clone might take time. For now, we assume it queues.
-	// Ideally we should wait for the task to finish before updating config.
-	// But without a robust task waiter, we might hit a race.
-	// Let's add a small sleep or rely on Proxmox locking.
-	// Actually, for immediate update, we usually need to wait.
-	// Let's rely on 'Update' logic if we want to be safe, but for this simplified version:
-
-	time.Sleep(2 * time.Second) // Naive wait for lock release or task start
-
-	// 3. Update VM Configuration (Resources)
-	// Build network configuration
-	netConfig := fmt.Sprintf("model=%s,bridge=%s", vm.Network.Model, vm.Network.Bridge)
-	if vm.Network.VLAN > 0 {
-		netConfig += fmt.Sprintf(",tag=%d", vm.Network.VLAN)
-	}
-
-	configData := map[string]any{
-		"cores":  vm.Cores,
-		"memory": vm.Memory,
-		"scsi0":  vm.DiskSize, // Resizing? Or replacing?
-		// Note: 'scsi0' in update might replace the disk reference.
-		// For resize we need 'disk resize'. For cloning, we usually accept the disk size of the template
-		// OR we need to resize it afterwards.
-		// If the user specifies a disk size, they likely want that size.
-		// Handling disk resize via API is different (POST /resize).
-		// For now, let's omit disk size update to avoid detaching the cloned disk,
-		// or investigate if we should resize.
-		// The original plan said "UPDATE ... Apply CPU, Memory, Network".
-		// I will omit DiskSize for now to be safe, as 'scsi0' might overwrite the drive definition.
-		"net0": netConfig,
-	}
-
-	configUrl := fmt.Sprintf("https://%s:%d/api2/json/nodes/%s/qemu/%d/config", p.host, p.port, p.node, vm.ID)
-	configJson, _ := json.Marshal(configData)
-	reqConfig, err := http.NewRequest("POST", configUrl, bytes.NewBuffer(configJson))
+// Create clones the template of vm, applies the VM resources to the clone and
+// grows its disk, reporting each phase to progress. Each step waits for the
+// task it starts, and steps refused because another task holds a lock, e.g. a
+// clone of the same template, are retried.
+func (p *ProxmoxAdapter) Create(vm *domain.VM, progress domain.ProgressFunc) error {
+	steps, err := p.createSteps(vm)
 	if err != nil {
 		return err
 	}
-	p.setAuthHeader(reqConfig)
-	reqConfig.Header.Set("Content-Type", "application/json")
-
-	respConfig, err := p.client.Do(reqConfig)
-	if err != nil {
-		return fmt.Errorf("failed to update VM config: %w", err)
-	}
-	defer respConfig.Body.Close()
 
-	if respConfig.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(respConfig.Body)
-		// Don't fail the whole creation if update fails, but log it? Or fail?
-		return fmt.Errorf("VM cloned but failed to update config (status %d): %s", respConfig.StatusCode, string(body))
+	for _, step := range steps {
+		progress.Report(vm, step.phase)
+		err := domain.RetryLocked(lockRetry, func() error {
+			body, err := p.do(step.call, step.failure)
+			if err != nil {
+				return err
+			}
+			return p.waitTask(body, step.failure)
+		})
+		if err != nil {
+			return err
+		}
 	}
 
 	return nil
 }
 
-func (p *ProxmoxAdapter) GetByID(id int) (*domain.VM, error) {
-	if p.token == "" {
-		if err := p.login(); err != nil {
-			return nil, err
-		}
-	}
+// lockRetry bounds the retries of a creation step refused because of a lock.
+var lockRetry = domain.WaitOptions{
+	Timeout:     10 * time.Minute,
+	Interval:    2 * time.Second,
+	MaxInterval: 30 * time.Second,
+	Backoff:     2,
+}
 
+func (p *ProxmoxAdapter) GetByID(id int) (*domain.VM, error) {
 	url := fmt.Sprintf("https://%s:%d/api2/json/nodes/%s/qemu/%d/status/current", p.host, p.port, p.node, id)
 
 	req, err := http.NewRequest("GET", url, nil)
@@ -254,9 +163,7 @@ func (p *ProxmoxAdapter) GetByID(id int) (*domain.VM, error) {
 		return nil, err
 	}
 
-	p.setAuthHeader(req)
-
-	resp, err := p.client.Do(req)
+	resp, err := p.send(req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get VM: %w", err)
 	}
@@ -267,6 +174,10 @@ func (p *ProxmoxAdapter) GetByID(id int) (*domain.VM, error) {
 		return nil, fmt.Errorf("failed to read VM response: %w", err)
 	}
 
+	if resp.StatusCode != http.StatusOK {
+		return nil, statusError(resp.StatusCode, body, "failed to get VM %d", id)
+	}
+
 	var vmResp struct {
 		Data ProxmoxVM `json:"data"`
 	}
@@ -276,9 +187,26 @@ func (p *ProxmoxAdapter) GetByID(id int) (*domain.VM, error) {
 	}
 
 	vm := domain.NewVM(vmResp.Data.Name, vmResp.Data.VMID)
-	vm.Status = domain.VMStatus(vmResp.Data.Status)
+	vm.Status = domain.ParseVMStatus(vmResp.Data.Status, vmResp.Data.QMPStatus, vmResp.Data.Lock)
 	vm.Memory = vmResp.Data.Memory
 	vm.Cores = int(vmResp.Data.CPU)
+	vm.Tags = domain.ParseTags(vmResp.Data.Tags)
+	vm.Node = p.node
+	vm.Uptime = time.Duration(vmResp.Data.Uptime) * time.Second
+	if vmResp.Data.MaxDisk > 0 {
+		vm.DiskSize = domain.FormatDiskSize(int64(vmResp.Data.MaxDisk))
+	}
+
+	// Protection is part of the VM config, not of its status. Proxmox refuses to
+	// destroy a protected VM anyway, so an unreadable config is not fatal here.
+	var configResp struct {
+		Data struct {
+			Protection int `json:"protection"`
+		} `json:"data"`
+	}
+	if err := p.getJSON(fmt.Sprintf("/nodes/%s/qemu/%d/config", p.node, id), &configResp); err == nil {
+		vm.Protected = configResp.Data.Protection == 1
+	}
 
 	return vm, nil
 }
@@ -295,72 +223,42 @@ func (p *ProxmoxAdapter) GetByName(name string) (*domain.VM, error) {
 		}
 	}
 
-	return nil, fmt.Errorf("VM with name %s not found", name)
+	return nil, domain.Errorf(domain.ErrorKindNotFound, "VM with name %s not found", name)
 }
 
 func (p *ProxmoxAdapter) Update(vm *domain.VM) error {
 	return fmt.Errorf("update operation not implemented for Proxmox adapter")
 }
 
-func (p *ProxmoxAdapter) Delete(id int) error {
-	if p.token == "" {
-		if err := p.login(); err != nil {
-			return err
-		}
-	}
-
-	url := fmt.Sprintf("https://%s:%d/api2/json/nodes/%s/qemu/%d", p.host, p.port, p.node, id)
-
-	req, err := http.NewRequest("DELETE", url, nil)
-	if err != nil {
-		return err
-	}
-
-	p.setAuthHeader(req)
-
-	resp, err := p.client.Do(req)
-	if err != nil {
-		return fmt.Errorf("failed to delete VM: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("failed to delete VM %d, status: %d, response: %s", id, resp.StatusCode, string(body))
-	}
-
-	return nil
+// Delete destroys a VM. With purge, it is also removed from backup jobs, HA
+// and replication, and disks it no longer references are destroyed.
+func (p *ProxmoxAdapter) Delete(id int, purge bool) error {
+	_, err := p.do(p.deleteCall(id, purge), fmt.Sprintf("failed to delete VM %d", id))
+	return err
 }
 
 func (p *ProxmoxAdapter) List() ([]*domain.VM, error) {
-	if p.token == "" {
-		if err := p.login(); err != nil {
-			return nil, err
-		}
-	}
-
-	url := fmt.Sprintf("https://%s:%d/api2/json/nodes/%s/qemu", p.host, p.port, p.node)
+	// full=1 adds qmpstatus, which tells paused VMs from running ones
+	url := fmt.Sprintf("https://%s:%d/api2/json/nodes/%s/qemu?full=1", p.host, p.port, p.node)
 
 	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
 		return nil, err
 	}
 
-	p.setAuthHeader(req)
-
-	resp, err := p.client.Do(req)
+	resp, err := p.send(req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to list VMs: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode == 401 {
-		return nil, fmt.Errorf("authentication failed - check credentials in config.yaml (user: %s, host: %s)", p.user, p.host)
+		return nil, domain.Errorf(domain.ErrorKindAuth, "authentication failed - check credentials in config.yaml (user: %s, host: %s)", p.user, p.host)
 	}
 
 	if resp.StatusCode != 200 {
 		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("API error - status: %d, response: %s", resp.StatusCode, string(body))
+		return nil, statusError(resp.StatusCode, body, "API error")
 	}
 
 	body, err := io.ReadAll(resp.Body)
@@ -379,167 +277,252 @@ func (p *ProxmoxAdapter) List() ([]*domain.VM, error) {
 	var vms []*domain.VM
 	for _, vmData := range vmsResp.Data {
 		vm := domain.NewVM(vmData.Name, vmData.VMID)
-		vm.Status = domain.VMStatus(vmData.Status)
+		vm.Status = domain.ParseVMStatus(vmData.Status, vmData.QMPStatus, vmData.Lock)
 		vm.Memory = vmData.Memory
 		vm.Cores = int(vmData.CPU)
+		vm.Tags = domain.ParseTags(vmData.Tags)
+		vm.IsTemplate = vmData.Template == 1
+		vm.Node = p.node
+		vm.Uptime = time.Duration(vmData.Uptime) * time.Second
+		if vmData.MaxDisk > 0 {
+			vm.DiskSize = domain.FormatDiskSize(int64(vmData.MaxDisk))
+		}
 		vms = append(vms, vm)
 	}
 
 	return vms, nil
 }
 
-func (p *ProxmoxAdapter) Start(id int) error {
-	if p.token == "" {
-		if err := p.login(); err != nil {
-			return err
-		}
+// NextID asks the cluster for a free VMID. For a bounded range, IDs already
+// listed on this node are skipped and each candidate is checked against the
+// whole cluster with /cluster/nextid?vmid=N.
+func (p *ProxmoxAdapter) NextID(idRange domain.VMIDRange) (int, error) {
+	var resp struct {
+		Data json.RawMessage `json:"data"`
 	}
 
-	url := fmt.Sprintf("https://%s:%d/api2/json/nodes/%s/qemu/%d/status/start", p.host, p.port, p.node, id)
-
-	req, err := http.NewRequest("POST", url, nil)
-	if err != nil {
-		return err
+	if idRange.IsZero() {
+		if err := p.getJSON("/cluster/nextid", &resp); err != nil {
+			return 0, fmt.Errorf("failed to get next VMID: %w", err)
+		}
+		return strconv.Atoi(strings.Trim(string(resp.Data), `"`))
 	}
 
-	p.setAuthHeader(req)
-
-	resp, err := p.client.Do(req)
-	if err != nil {
-		return fmt.Errorf("failed to start VM: %w", err)
+	used := make(map[int]bool)
+	if vms, err := p.List(); err == nil {
+		for _, vm := range vms {
+			used[vm.ID] = true
+		}
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("failed to start VM %d, status: %d, response: %s", id, resp.StatusCode, string(body))
+	for id := idRange.Min; id <= idRange.Max; id++ {
+		if used[id] {
+			continue
+		}
+		if err := p.getJSON(fmt.Sprintf("/cluster/nextid?vmid=%d", id), &resp); err == nil {
+			return id, nil
+		}
 	}
 
-	return nil
+	return 0, domain.Errorf(domain.ErrorKindConflict, "no free VMID in range %d-%d", idRange.Min, idRange.Max)
+}
+
+func (p *ProxmoxAdapter) Start(id int) error {
+	return p.power(id, "start")
 }
 
 func (p *ProxmoxAdapter) Stop(id int) error {
-	if p.token == "" {
-		if err := p.login(); err != nil {
-			return err
-		}
-	}
+	return p.power(id, "stop")
+}
 
-	url := fmt.Sprintf("https://%s:%d/api2/json/nodes/%s/qemu/%d/status/stop", p.host, p.port, p.node, id)
+func (p *ProxmoxAdapter) Shutdown(id int) error {
+	return p.power(id, "shutdown")
+}
 
-	req, err := http.NewRequest("POST", url, nil)
-	if err != nil {
-		return err
-	}
+func (p *ProxmoxAdapter) Reboot(id int) error {
+	return p.power(id, "reboot")
+}
 
-	p.setAuthHeader(req)
+func (p *ProxmoxAdapter) Reset(id int) error {
+	return p.power(id, "reset")
+}
 
-	resp, err := p.client.Do(req)
-	if err != nil {
-		return fmt.Errorf("failed to stop VM: %w", err)
-	}
-	defer resp.Body.Close()
+func (p *ProxmoxAdapter) Suspend(id int) error {
+	return p.power(id, "suspend")
+}
 
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("failed to stop VM %d, status: %d, response: %s", id, resp.StatusCode, string(body))
-	}
+func (p *ProxmoxAdapter) Resume(id int) error {
+	return p.power(id, "resume")
+}
 
-	return nil
+func (p *ProxmoxAdapter) Hibernate(id int) error {
+	return p.power(id, "hibernate")
 }
 
-func (p *ProxmoxAdapter) Shutdown(id int) error {
-	if p.token == "" {
-		if err := p.login(); err != nil {
-			return err
-		}
+func (p *ProxmoxAdapter) power(id int, action string) error {
+	_, err := p.do(p.powerCall(id, action), fmt.Sprintf("failed to %s VM %d", action, id))
+	return err
+}
+
+func (p *ProxmoxAdapter) GetStatus(id int) (domain.VMStatus, error) {
+	vm, err := p.GetByID(id)
+	if err != nil {
+		return "", err
 	}
+	return vm.Status, nil
+}
 
-	url := fmt.Sprintf("https://%s:%d/api2/json/nodes/%s/qemu/%d/status/shutdown", p.host, p.port, p.node, id)
+func (p *ProxmoxAdapter) PingAgent(id int) error {
+	url := fmt.Sprintf("https://%s:%d/api2/json/nodes/%s/qemu/%d/agent/ping", p.host, p.port, p.node, id)
 
 	req, err := http.NewRequest("POST", url, nil)
 	if err != nil {
 		return err
 	}
 
-	p.setAuthHeader(req)
-
-	resp, err := p.client.Do(req)
+	resp, err := p.send(req)
 	if err != nil {
-		return fmt.Errorf("failed to shutdown VM: %w", err)
+		return fmt.Errorf("failed to ping guest agent: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("failed to shutdown VM %d, status: %d, response: %s", id, resp.StatusCode, string(body))
+		return statusError(resp.StatusCode, body, "guest agent of VM %d not responding", id)
 	}
 
 	return nil
 }
 
-func (p *ProxmoxAdapter) GetStatus(id int) (domain.VMStatus, error) {
-	vm, err := p.GetByID(id)
+// agentInterface mirrors an entry of the guest agent network-get-interfaces result.
+type agentInterface struct {
+	Name            string `json:"name"`
+	HardwareAddress string `json:"hardware-address"`
+	IPAddresses     []struct {
+		IPAddress     string `json:"ip-address"`
+		IPAddressType string `json:"ip-address-type"`
+		Prefix        int    `json:"prefix"`
+	} `json:"ip-addresses"`
+}
+
+// SetTaskTimeout sets how long a task, such as a clone, may run before the
+// operation waiting for it gives up.
+func (p *ProxmoxAdapter) SetTaskTimeout(timeout time.Duration) {
+	p.taskTimeout = timeout
+}
+
+// SetIPPreferences configures how GetVMIP picks an address among those reported by the VM.
+func (p *ProxmoxAdapter) SetIPPreferences(prefs domain.IPPreferences) {
+	p.ipPrefs = prefs
+}
+
+func (p *ProxmoxAdapter) GetVMIP(id int) (string, error) {
+	ifaces, err := p.GetNetworkInterfaces(id)
+
+	// Guest agent addresses win over the static cloud-init configuration
+	for _, source := range []string{"agent", "cloud-init"} {
+		var candidates []domain.NetworkInterface
+		for _, iface := range ifaces {
+			if iface.Source == source {
+				candidates = append(candidates, iface)
+			}
+		}
+		if ip, ok := p.ipPrefs.SelectIP(candidates); ok {
+			return ip, nil
+		}
+	}
+
+	if p.ipPrefs.SyntheticFallback {
+		// Generate fallback IP based on VMID using configurable base
+		return fmt.Sprintf("%s.%d", p.vmIPBase, id+100), nil
+	}
+
 	if err != nil {
-		return "", err
+		return "", fmt.Errorf("no IP address found for VM %d: %w", id, err)
 	}
-	return vm.Status, nil
+	return "", fmt.Errorf("no IP address matching the preferences found for VM %d. Please ensure QEMU Guest Agent is running or set a static ipconfig0", id)
 }
 
-func (p *ProxmoxAdapter) GetVMIP(id int) (string, error) {
-	if p.token == "" {
-		if err := p.login(); err != nil {
-			return "", err
+// GetNetworkInterfaces returns the interfaces reported by the guest agent followed
+// by the static addresses of the cloud-init ipconfig0 setting. An error is only
+// returned when neither source is available.
+func (p *ProxmoxAdapter) GetNetworkInterfaces(id int) ([]domain.NetworkInterface, error) {
+	var ifaces []domain.NetworkInterface
+
+	var agentResp struct {
+		Data struct {
+			Result []agentInterface `json:"result"`
+		} `json:"data"`
+	}
+	agentErr := p.getJSON(fmt.Sprintf("/nodes/%s/qemu/%d/agent/network-get-interfaces", p.node, id), &agentResp)
+	if agentErr == nil {
+		for _, iface := range agentResp.Data.Result {
+			netIface := domain.NetworkInterface{
+				Name:   iface.Name,
+				MAC:    iface.HardwareAddress,
+				Source: "agent",
+			}
+			for _, addr := range iface.IPAddresses {
+				netIface.Addresses = append(netIface.Addresses, domain.NewIPAddress(addr.IPAddress, addr.Prefix))
+			}
+			ifaces = append(ifaces, netIface)
 		}
 	}
 
-	// Try to get IP from QEMU Agent first
-	url := fmt.Sprintf("https://%s:%d/api2/json/nodes/%s/qemu/%d/agent/network-get-interfaces", p.host, p.port, p.node, id)
+	var configResp struct {
+		Data struct {
+			IPConfig0 string `json:"ipconfig0"`
+		} `json:"data"`
+	}
+	configErr := p.getJSON(fmt.Sprintf("/nodes/%s/qemu/%d/config", p.node, id), &configResp)
+	if configErr == nil {
+		if addresses := domain.ParseIPConfig(configResp.Data.IPConfig0); len(addresses) > 0 {
+			ifaces = append(ifaces, domain.NetworkInterface{
+				Name:      "ipconfig0",
+				Addresses: addresses,
+				Source:    "cloud-init",
+			})
+		}
+	}
+
+	if agentErr != nil && configErr != nil {
+		return nil, fmt.Errorf("guest agent unavailable (%v) and VM config unreadable (%v)", agentErr, configErr)
+	}
+	if agentErr != nil && len(ifaces) == 0 {
+		return nil, fmt.Errorf("guest agent unavailable and no static ipconfig0: %w", agentErr)
+	}
+
+	return ifaces, nil
+}
+
+// getJSON performs an authenticated GET on an API path and decodes the response into out.
+func (p *ProxmoxAdapter) getJSON(path string, out any) error {
+	url := fmt.Sprintf("https://%s:%d/api2/json%s", p.host, p.port, path)
 
 	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
-		return "", err
+		return err
 	}
 
-	p.setAuthHeader(req)
-
-	resp, err := p.client.Do(req)
+	resp, err := p.send(req)
 	if err != nil {
-		return "", fmt.Errorf("failed to get network interfaces: %w", err)
+		return fmt.Errorf("request to %s failed: %w", path, err)
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode == http.StatusOK {
-		body, err := io.ReadAll(resp.Body)
-		if err != nil {
-			return "", fmt.Errorf("failed to read network response: %w", err)
-		}
-
-		var ifacesResp struct {
-			Data []struct {
-				Name        string `json:"name"`
-				IPAddresses []struct {
-					IPAddress string `json:"ip-address"`
-					Type      string `json:"type"`
-				} `json:"ip-addresses"`
-			} `json:"result"`
-		}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response from %s: %w", path, err)
+	}
 
-		if err := json.Unmarshal(body, &ifacesResp); err == nil {
-			for _, iface := range ifacesResp.Data {
-				if iface.Name == "eth0" || iface.Name == "ens18" {
-					for _, ip := range iface.IPAddresses {
-						if ip.Type == "ipv4" && ip.IPAddress != "" {
-							return ip.IPAddress, nil
-						}
-					}
-				}
-			}
-		}
+	if resp.StatusCode != http.StatusOK {
+		return statusError(resp.StatusCode, body, "API error on %s", path)
 	}
 
-	// Generate fallback IP based on VMID using configurable base
-	return fmt.Sprintf("%s.%d", p.vmIPBase, id+100), nil
+	if err := json.Unmarshal(body, out); err != nil {
+		return fmt.Errorf("failed to parse response from %s: %w", path, err)
+	}
+	return nil
 }
 
 var _ ports.VMRepository = (*ProxmoxAdapter)(nil)
@@ -2,12 +2,14 @@ package proxmox_ssh
 
 import (
 	"bufio"
+	"encoding/json"
 	"fmt"
 	"os/exec"
 	"proxima/internal/core/domain"
 	"proxima/internal/core/ports"
 	"strconv"
 	"strings"
+	"time"
 )
 
 type ProxmoxSSHAdapter struct {
@@ -15,12 +17,17 @@ type ProxmoxSSHAdapter struct {
 	user     string
 	password string
 	port     int
+	keyPath  string
 	vmIPBase string
+	ipPrefs  domain.IPPreferences
 }
 
 func NewProxmoxSSHAdapter(host, user, password string, port int) *ProxmoxSSHAdapter {
-	// Extract VM IP base from host
-	vmIPBase := strings.Join(strings.Split(host, ".")[:3], ".")
+	// Extract VM IP base from host (remove last octet)
+	vmIPBase := "192.168.1" // fallback
+	if parts := strings.Split(host, "."); len(parts) == 4 {
+		vmIPBase = strings.Join(parts[:3], ".")
+	}
 
 	return &ProxmoxSSHAdapter{
 		host:     host,
@@ -31,6 +38,12 @@ func NewProxmoxSSHAdapter(host, user, password string, port int) *ProxmoxSSHAdap
 	}
 }
 
+// SetKeyPath sets the private key used to log in to the host instead of the
+// default keys of ssh.
+func (p *ProxmoxSSHAdapter) SetKeyPath(path string) {
+	p.keyPath = path
+}
+
 func (p *ProxmoxSSHAdapter) executeSSHCommand(command string) (string, error) {
 	var cmd *exec.Cmd
 
@@ -39,63 +52,206 @@ func (p *ProxmoxSSHAdapter) executeSSHCommand(command string) (string, error) {
 		cmd = exec.Command("sshpass", "-p", p.password, "ssh", "-o", "StrictHostKeyChecking=no", "-p", strconv.Itoa(p.port), fmt.Sprintf("%s@%s", p.user, p.host), command)
 	} else {
 		// Use SSH key authentication
-		cmd = exec.Command("ssh", "-o", "StrictHostKeyChecking=no", "-p", strconv.Itoa(p.port), fmt.Sprintf("%s@%s", p.user, p.host), command)
+		args := []string{"-o", "StrictHostKeyChecking=no", "-p", strconv.Itoa(p.port)}
+		if p.keyPath != "" {
+			args = append(args, "-i", p.keyPath)
+		}
+		cmd = exec.Command("ssh", append(args, fmt.Sprintf("%s@%s", p.user, p.host), command)...)
 	}
 
 	output, err := cmd.CombinedOutput()
 	if err != nil {
-		return "", fmt.Errorf("SSH command failed: %w, output: %s", err, string(output))
+		failure := fmt.Errorf("SSH command failed: %w, output: %s", err, string(output))
+		return "", domain.WrapError(classifyOutput(string(output)), failure)
 	}
 
 	return string(output), nil
 }
 
-func (p *ProxmoxSSHAdapter) Create(vm *domain.VM) error {
-	// 1. Resolve Template ID
-	var templateID int
-	if id, err := strconv.Atoi(vm.Template); err == nil {
-		templateID = id
-	} else {
-		// Try to find by name
+// classifyOutput maps the stderr of a failed ssh/qm invocation to an error kind.
+func classifyOutput(output string) domain.ErrorKind {
+	lower := strings.ToLower(output)
+	switch {
+	case strings.Contains(lower, "permission denied"):
+		return domain.ErrorKindAuth
+	case strings.Contains(lower, "does not exist"):
+		return domain.ErrorKindNotFound
+	case strings.Contains(lower, "locked") || strings.Contains(lower, "can't lock") || strings.Contains(lower, "already exists"):
+		return domain.ErrorKindConflict
+	case strings.Contains(lower, "connection refused"),
+		strings.Contains(lower, "connection timed out"),
+		strings.Contains(lower, "could not resolve hostname"),
+		strings.Contains(lower, "no route to host"):
+		return domain.ErrorKindTransport
+	}
+	return ""
+}
+
+// Create clones the template of vm and applies the VM resources to the clone,
+// reporting each phase to progress. Steps refused because another task holds
+// a lock, e.g. a clone of the same template, are retried.
+func (p *ProxmoxSSHAdapter) Create(vm *domain.VM, progress domain.ProgressFunc) error {
+	steps, err := p.createSteps(vm)
+	if err != nil {
+		return err
+	}
+
+	for _, step := range steps {
+		progress.Report(vm, step.phase)
+		err := domain.RetryLocked(lockRetry, func() error {
+			_, err := p.executeSSHCommand(step.command)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("%s: %w", step.failure, err)
+		}
+	}
+
+	if len(vm.SSH.AuthorizedKeys) > 0 {
+		fmt.Printf("[WARNING] SSH keys defined. Ensure Cloud-Init is configured or use 'proxima <host> copy-key %d' after boot.\n", vm.ID)
+	}
+
+	return nil
+}
+
+// lockRetry bounds the retries of a creation step refused because of a lock.
+var lockRetry = domain.WaitOptions{
+	Timeout:     10 * time.Minute,
+	Interval:    2 * time.Second,
+	MaxInterval: 30 * time.Second,
+	Backoff:     2,
+}
+
+// createStep is a qm command of a VM creation and the phase it starts.
+type createStep struct {
+	phase   domain.CreatePhase
+	command string
+	failure string
+}
+
+// createSteps resolves the template of vm and returns the qm commands cloning
+// it, applying the VM resources to the clone and growing its boot disk.
+func (p *ProxmoxSSHAdapter) createSteps(vm *domain.VM) ([]createStep, error) {
+	templateID, err := strconv.Atoi(vm.Template)
+	if err != nil {
 		// For SSH, GetByName calls p.List() which calls 'qm list' via SSH. This is fine.
 		templateVM, err := p.GetByName(vm.Template)
 		if err != nil {
-			return fmt.Errorf("failed to resolve template '%s': %w", vm.Template, err)
+			return nil, fmt.Errorf("failed to resolve template '%s': %w", vm.Template, err)
 		}
 		templateID = templateVM.ID
 	}
 
-	// 2. Clone VM
-	// Command: qm clone <vmid> <newid> -name <name> -full 1
-	cloneCmd := fmt.Sprintf("qm clone %d %d --name %s --full 1", templateID, vm.ID, vm.Name)
-	fmt.Printf("Cloning VM with command: %s\n", cloneCmd)
-	if _, err := p.executeSSHCommand(cloneCmd); err != nil {
-		return fmt.Errorf("failed to clone VM: %w", err)
+	// Values from the config are quoted, as the remote shell parses the commands
+	cloneCmd := fmt.Sprintf("qm clone %d %d --name %s --full 1", templateID, vm.ID, shellQuote(vm.Name))
+	if vm.Storage != "" {
+		cloneCmd += " --storage " + shellQuote(vm.Storage)
 	}
 
-	// 3. Update VM Config (Resources)
-	// Command: qm set <vmid> --cores <cores> --memory <memory> --net0 ...
-	updateCmd := fmt.Sprintf("qm set %d --cores %d --memory %d --net0 virtio,bridge=%s",
-		vm.ID, vm.Cores, vm.Memory, vm.Network.Bridge)
-
+	model := vm.Network.Model
+	if model == "" {
+		model = "virtio"
+	}
+	net0 := fmt.Sprintf("%s,bridge=%s", model, vm.Network.Bridge)
 	if vm.Network.VLAN > 0 {
-		updateCmd += fmt.Sprintf(",tag=%d", vm.Network.VLAN)
+		net0 += fmt.Sprintf(",tag=%d", vm.Network.VLAN)
+	}
+	updateCmd := fmt.Sprintf("qm set %d --cores %d --memory %d --net0 %s", vm.ID, vm.Cores, vm.Memory, shellQuote(net0))
+	if vm.Protected {
+		updateCmd += " --protection 1"
+	}
+	if startup := vm.Startup(); startup != "" {
+		updateCmd += " --startup " + startup
+	}
+	if vm.OSType != "" {
+		updateCmd += " --ostype " + shellQuote(vm.OSType)
+	}
+	if vm.CIUser != "" {
+		updateCmd += " --ciuser " + shellQuote(vm.CIUser)
+	}
+
+	steps := []createStep{
+		{domain.PhaseCloning, cloneCmd, "failed to clone VM"},
+		{domain.PhaseConfiguring, updateCmd, "VM cloned but failed to update resources"},
 	}
 
-	// We omit --scsi0 resizing for now to be consistent with API adapter
+	resizeCmd, err := p.resizeCommand(templateID, vm)
+	if err != nil {
+		return nil, err
+	}
+	if resizeCmd != "" {
+		steps = append(steps, createStep{domain.PhaseResizing, resizeCmd, "VM cloned but failed to resize its disk"})
+	}
+	return steps, nil
+}
 
-	fmt.Printf("Updating VM config with command: %s\n", updateCmd)
-	if _, err := p.executeSSHCommand(updateCmd); err != nil {
-		// Try to warn but allow continuation or fail?
-		// If resource update fails, the VM is still usable but with template specs.
-		return fmt.Errorf("VM cloned but failed to update resources: %w", err)
+// resizeCommand returns the qm command growing the boot disk of a clone of the
+// template to the disk size of vm, or "" when the template disk is at least
+// that large: Proxmox cannot shrink disks.
+func (p *ProxmoxSSHAdapter) resizeCommand(templateID int, vm *domain.VM) (string, error) {
+	if vm.DiskSize == "" {
+		return "", nil
+	}
+	size, err := domain.ParseDiskSize(vm.DiskSize)
+	if err != nil {
+		return "", err
 	}
 
-	if len(vm.SSH.AuthorizedKeys) > 0 {
-		fmt.Printf("[WARNING] SSH keys defined. Ensure Cloud-Init is configured or use 'proxima copy-key' after boot.\n")
+	output, err := p.executeSSHCommand(fmt.Sprintf("qm config %d", templateID))
+	if err != nil {
+		return "", fmt.Errorf("failed to read the disks of template %d: %w", templateID, err)
 	}
+	disk, current, ok := domain.BootDisk(parseConfig(output))
+	if !ok || size <= current {
+		return "", nil
+	}
+	return fmt.Sprintf("qm resize %d %s %s", vm.ID, disk, vm.DiskSize), nil
+}
 
-	return nil
+// parseConfig reads the "key: value" lines of qm config, up to the first
+// snapshot section.
+func parseConfig(output string) map[string]string {
+	config := make(map[string]string)
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if strings.HasPrefix(line, "[") {
+			break
+		}
+		if key, value, ok := strings.Cut(line, ": "); ok {
+			config[key] = strings.TrimSpace(value)
+		}
+	}
+	return config
+}
+
+// PlanCreate returns the qm commands Create would run for vm.
+func (p *ProxmoxSSHAdapter) PlanCreate(vm *domain.VM) ([]string, error) {
+	steps, err := p.createSteps(vm)
+	if err != nil {
+		return nil, err
+	}
+	commands := make([]string, len(steps))
+	for i, step := range steps {
+		commands[i] = step.command
+	}
+	return commands, nil
+}
+
+// PlanDelete returns the qm command Delete would run.
+func (p *ProxmoxSSHAdapter) PlanDelete(id int, purge bool) ([]string, error) {
+	if purge {
+		return []string{fmt.Sprintf("qm destroy %d --purge 1 --destroy-unreferenced-disks 1", id)}, nil
+	}
+	return []string{fmt.Sprintf("qm destroy %d", id)}, nil
+}
+
+// PlanPower returns the qm command of a power action. Hibernation is a
+// suspend to disk.
+func (p *ProxmoxSSHAdapter) PlanPower(id int, action string) ([]string, error) {
+	if action == "hibernate" {
+		return []string{fmt.Sprintf("qm suspend %d --todisk 1", id)}, nil
+	}
+	return []string{fmt.Sprintf("qm %s %d", action, id)}, nil
 }
 
 func (p *ProxmoxSSHAdapter) GetByID(id int) (*domain.VM, error) {
@@ -116,17 +272,15 @@ func (p *ProxmoxSSHAdapter) GetByID(id int) (*domain.VM, error) {
 			fmt.Sscanf(strings.TrimPrefix(line, "cores: "), "%d", &vm.Cores)
 		} else if strings.HasPrefix(line, "memory: ") {
 			fmt.Sscanf(strings.TrimPrefix(line, "memory: "), "%d", &vm.Memory)
+		} else if strings.HasPrefix(line, "tags: ") {
+			vm.Tags = domain.ParseTags(strings.TrimPrefix(line, "tags: "))
+		} else if strings.HasPrefix(line, "protection: ") {
+			vm.Protected = strings.TrimPrefix(line, "protection: ") == "1"
 		}
 	}
 
-	// Get status
-	statusOutput, err := p.executeSSHCommand(fmt.Sprintf("qm status %d", id))
-	if err == nil {
-		if strings.Contains(statusOutput, "running") {
-			vm.Status = domain.VMStatusRunning
-		} else if strings.Contains(statusOutput, "stopped") {
-			vm.Status = domain.VMStatusStopped
-		}
+	if status, err := p.GetStatus(id); err == nil {
+		vm.Status = status
 	}
 
 	return vm, nil
@@ -144,16 +298,17 @@ func (p *ProxmoxSSHAdapter) GetByName(name string) (*domain.VM, error) {
 		}
 	}
 
-	return nil, fmt.Errorf("VM with name %s not found", name)
+	return nil, domain.Errorf(domain.ErrorKindNotFound, "VM with name %s not found", name)
 }
 
 func (p *ProxmoxSSHAdapter) Update(vm *domain.VM) error {
 	return fmt.Errorf("update operation not implemented for SSH adapter")
 }
 
-func (p *ProxmoxSSHAdapter) Delete(id int) error {
-	_, err := p.executeSSHCommand(fmt.Sprintf("qm destroy %d", id))
-	return err
+// Delete destroys a VM. With purge, it is also removed from backup jobs, HA
+// and replication, and disks it no longer references are destroyed.
+func (p *ProxmoxSSHAdapter) Delete(id int, purge bool) error {
+	return p.run(p.PlanDelete(id, purge))
 }
 
 func (p *ProxmoxSSHAdapter) List() ([]*domain.VM, error) {
@@ -162,6 +317,12 @@ func (p *ProxmoxSSHAdapter) List() ([]*domain.VM, error) {
 		return nil, err
 	}
 
+	// qm list only covers the local node, so its hostname is the node name
+	node := ""
+	if hostname, err := p.executeSSHCommand("hostname"); err == nil {
+		node = strings.TrimSpace(hostname)
+	}
+
 	var vms []*domain.VM
 	scanner := bufio.NewScanner(strings.NewReader(output))
 
@@ -183,16 +344,18 @@ func (p *ProxmoxSSHAdapter) List() ([]*domain.VM, error) {
 			status := fields[2]
 
 			vm := domain.NewVM(name, vmid)
+			vm.Node = node
 
-			switch status {
-			case "running":
-				vm.Status = domain.VMStatusRunning
-			case "stopped":
-				vm.Status = domain.VMStatusStopped
-			default:
-				vm.Status = domain.VMStatus(status)
+			// Columns: VMID NAME STATUS MEM(MB) BOOTDISK(GB) PID
+			if len(fields) >= 5 {
+				if diskGB, err := strconv.ParseFloat(fields[4], 64); err == nil && diskGB > 0 {
+					vm.DiskSize = domain.FormatDiskSize(int64(diskGB * (1 << 30)))
+				}
 			}
 
+			// qm list does not report qmpstatus, so paused VMs are listed as running
+			vm.Status = domain.ParseVMStatus(status, "", "")
+
 			// Get detailed info (CPU, memory) using qm config
 			if err := p.getVMDetails(vm); err != nil {
 				// Continue even if we can't get details
@@ -225,69 +388,229 @@ func (p *ProxmoxSSHAdapter) getVMDetails(vm *domain.VM) error {
 			var memory int
 			fmt.Sscanf(strings.TrimPrefix(line, "memory: "), "%d", &memory)
 			vm.Memory = memory
+		} else if strings.HasPrefix(line, "tags: ") {
+			vm.Tags = domain.ParseTags(strings.TrimPrefix(line, "tags: "))
+		} else if strings.HasPrefix(line, "protection: ") {
+			vm.Protected = strings.TrimPrefix(line, "protection: ") == "1"
+		} else if line == "template: 1" {
+			vm.IsTemplate = true
+		} else if line == "lock: suspended" {
+			// Hibernated VMs are stopped, with their state saved to disk
+			vm.Status = domain.VMStatusSuspended
 		}
 	}
 
 	return nil
 }
 
+// NextID asks the cluster for a free VMID. For a bounded range, IDs already
+// listed on this node are skipped and each candidate is checked against the
+// whole cluster with pvesh get /cluster/nextid --vmid N.
+func (p *ProxmoxSSHAdapter) NextID(idRange domain.VMIDRange) (int, error) {
+	if idRange.IsZero() {
+		output, err := p.executeSSHCommand("pvesh get /cluster/nextid")
+		if err != nil {
+			return 0, fmt.Errorf("failed to get next VMID: %w", err)
+		}
+		return strconv.Atoi(strings.Trim(strings.TrimSpace(output), `"`))
+	}
+
+	used := make(map[int]bool)
+	if output, err := p.executeSSHCommand("qm list"); err == nil {
+		for _, line := range strings.Split(output, "\n") {
+			if fields := strings.Fields(line); len(fields) > 0 {
+				if id, err := strconv.Atoi(fields[0]); err == nil {
+					used[id] = true
+				}
+			}
+		}
+	}
+
+	for id := idRange.Min; id <= idRange.Max; id++ {
+		if used[id] {
+			continue
+		}
+		if _, err := p.executeSSHCommand(fmt.Sprintf("pvesh get /cluster/nextid --vmid %d", id)); err == nil {
+			return id, nil
+		}
+	}
+
+	return 0, domain.Errorf(domain.ErrorKindConflict, "no free VMID in range %d-%d", idRange.Min, idRange.Max)
+}
+
 func (p *ProxmoxSSHAdapter) Start(id int) error {
-	_, err := p.executeSSHCommand(fmt.Sprintf("qm start %d", id))
-	return err
+	return p.run(p.PlanPower(id, "start"))
 }
 
 func (p *ProxmoxSSHAdapter) Stop(id int) error {
-	_, err := p.executeSSHCommand(fmt.Sprintf("qm stop %d", id))
-	return err
+	return p.run(p.PlanPower(id, "stop"))
 }
 
 func (p *ProxmoxSSHAdapter) Shutdown(id int) error {
-	_, err := p.executeSSHCommand(fmt.Sprintf("qm shutdown %d", id))
-	return err
+	return p.run(p.PlanPower(id, "shutdown"))
+}
+
+func (p *ProxmoxSSHAdapter) Reboot(id int) error {
+	return p.run(p.PlanPower(id, "reboot"))
+}
+
+func (p *ProxmoxSSHAdapter) Reset(id int) error {
+	return p.run(p.PlanPower(id, "reset"))
+}
+
+func (p *ProxmoxSSHAdapter) Suspend(id int) error {
+	return p.run(p.PlanPower(id, "suspend"))
+}
+
+func (p *ProxmoxSSHAdapter) Resume(id int) error {
+	return p.run(p.PlanPower(id, "resume"))
+}
+
+func (p *ProxmoxSSHAdapter) Hibernate(id int) error {
+	return p.run(p.PlanPower(id, "hibernate"))
+}
+
+// run executes planned qm commands in order.
+func (p *ProxmoxSSHAdapter) run(commands []string, err error) error {
+	if err != nil {
+		return err
+	}
+	for _, command := range commands {
+		if _, err := p.executeSSHCommand(command); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func (p *ProxmoxSSHAdapter) GetStatus(id int) (domain.VMStatus, error) {
-	output, err := p.executeSSHCommand(fmt.Sprintf("qm status %d", id))
+	output, err := p.executeSSHCommand(fmt.Sprintf("qm status %d --verbose", id))
 	if err != nil {
 		return "", err
 	}
+	return parseStatus(output), nil
+}
+
+// parseStatus reads the top-level "key: value" lines of qm status --verbose;
+// nested entries (blockstat, nics, ha) are indented.
+func parseStatus(output string) domain.VMStatus {
+	fields := make(map[string]string)
+	for _, line := range strings.Split(output, "\n") {
+		if key, value, ok := strings.Cut(strings.TrimRight(line, "\r"), ": "); ok && !strings.HasPrefix(line, " ") && !strings.HasPrefix(line, "\t") {
+			fields[key] = strings.TrimSpace(value)
+		}
+	}
+	return domain.ParseVMStatus(fields["status"], fields["qmpstatus"], fields["lock"])
+}
 
-	if strings.Contains(output, "running") {
-		return domain.VMStatusRunning, nil
-	} else if strings.Contains(output, "stopped") {
-		return domain.VMStatusStopped, nil
-	} else if strings.Contains(output, "starting") {
-		return domain.VMStatusStarting, nil
+func (p *ProxmoxSSHAdapter) PingAgent(id int) error {
+	if _, err := p.executeSSHCommand(fmt.Sprintf("qm agent %d ping", id)); err != nil {
+		return fmt.Errorf("guest agent of VM %d not responding: %w", id, err)
 	}
+	return nil
+}
+
+// agentInterface mirrors an entry of the guest agent network-get-interfaces result.
+type agentInterface struct {
+	Name            string `json:"name"`
+	HardwareAddress string `json:"hardware-address"`
+	IPAddresses     []struct {
+		IPAddress     string `json:"ip-address"`
+		IPAddressType string `json:"ip-address-type"`
+		Prefix        int    `json:"prefix"`
+	} `json:"ip-addresses"`
+}
 
-	return domain.VMStatus(output), nil
+// SetIPPreferences configures how GetVMIP picks an address among those reported by the VM.
+func (p *ProxmoxSSHAdapter) SetIPPreferences(prefs domain.IPPreferences) {
+	p.ipPrefs = prefs
 }
 
 func (p *ProxmoxSSHAdapter) GetVMIP(id int) (string, error) {
-	// Get IP from QEMU Agent - this is the only supported method
-	output, err := p.executeSSHCommand(fmt.Sprintf("qm agent %d network-get-interfaces", id))
+	ifaces, err := p.GetNetworkInterfaces(id)
+
+	// Guest agent addresses win over the static cloud-init configuration
+	for _, source := range []string{"agent", "cloud-init"} {
+		var candidates []domain.NetworkInterface
+		for _, iface := range ifaces {
+			if iface.Source == source {
+				candidates = append(candidates, iface)
+			}
+		}
+		if ip, ok := p.ipPrefs.SelectIP(candidates); ok {
+			return ip, nil
+		}
+	}
+
+	if p.ipPrefs.SyntheticFallback {
+		// Generate fallback IP based on VMID using the Proxmox host network
+		return fmt.Sprintf("%s.%d", p.vmIPBase, id+100), nil
+	}
+
 	if err != nil {
-		return "", fmt.Errorf("QEMU Agent not available or failed to get IP for VM %d: %w. Please ensure QEMU Guest Agent is installed and running on the VM", id, err)
+		return "", fmt.Errorf("no IP address found for VM %d: %w. Please ensure QEMU Guest Agent is installed and running on the VM", id, err)
 	}
+	return "", fmt.Errorf("no IP address matching the preferences found for VM %d via QEMU Agent or cloud-init ipconfig0", id)
+}
 
-	scanner := bufio.NewScanner(strings.NewReader(output))
-	for scanner.Scan() {
-		line := scanner.Text()
-		if strings.Contains(line, "ip-address:") && strings.Contains(line, "ipv4") {
-			fields := strings.Fields(line)
-			for i, field := range fields {
-				if field == "ip-address:" && i+1 < len(fields) {
-					ip := fields[i+1]
-					// Validate IP format (basic check)
-					if strings.Count(ip, ".") == 3 && !strings.HasPrefix(ip, "127.") && !strings.HasPrefix(ip, "169.254.") {
-						return ip, nil
-					}
-				}
+// GetNetworkInterfaces returns the interfaces reported by the guest agent followed
+// by the static addresses of the cloud-init ipconfig0 setting. An error is only
+// returned when neither source is available.
+func (p *ProxmoxSSHAdapter) GetNetworkInterfaces(id int) ([]domain.NetworkInterface, error) {
+	var ifaces []domain.NetworkInterface
+
+	output, agentErr := p.executeSSHCommand(fmt.Sprintf("qm agent %d network-get-interfaces", id))
+	if agentErr == nil {
+		var result []agentInterface
+		if err := json.Unmarshal([]byte(output), &result); err != nil {
+			agentErr = fmt.Errorf("failed to parse guest agent response: %w", err)
+		}
+		for _, iface := range result {
+			netIface := domain.NetworkInterface{
+				Name:   iface.Name,
+				MAC:    iface.HardwareAddress,
+				Source: "agent",
+			}
+			for _, addr := range iface.IPAddresses {
+				netIface.Addresses = append(netIface.Addresses, domain.NewIPAddress(addr.IPAddress, addr.Prefix))
 			}
+			ifaces = append(ifaces, netIface)
 		}
 	}
 
-	return "", fmt.Errorf("no valid IPv4 address found for VM %d via QEMU Agent. Please ensure QEMU Guest Agent is installed and running, and the VM has a valid network configuration", id)
+	configOutput, configErr := p.executeSSHCommand(fmt.Sprintf("qm config %d", id))
+	if configErr == nil {
+		scanner := bufio.NewScanner(strings.NewReader(configOutput))
+		for scanner.Scan() {
+			line := scanner.Text()
+			if !strings.HasPrefix(line, "ipconfig0: ") {
+				continue
+			}
+			if addresses := domain.ParseIPConfig(strings.TrimPrefix(line, "ipconfig0: ")); len(addresses) > 0 {
+				ifaces = append(ifaces, domain.NetworkInterface{
+					Name:      "ipconfig0",
+					Addresses: addresses,
+					Source:    "cloud-init",
+				})
+			}
+		}
+	}
+
+	if agentErr != nil && configErr != nil {
+		return nil, fmt.Errorf("guest agent unavailable (%v) and VM config unreadable (%v)", agentErr, configErr)
+	}
+	if agentErr != nil && len(ifaces) == 0 {
+		return nil, fmt.Errorf("guest agent unavailable and no static ipconfig0: %w", agentErr)
+	}
+
+	return ifaces, nil
 }
 
 var _ ports.VMRepository = (*ProxmoxSSHAdapter)(nil)
+
+var _ ports.CommandPlanner = (*ProxmoxSSHAdapter)(nil)
+
+// shellQuote quotes s for the shell of the Proxmox host.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
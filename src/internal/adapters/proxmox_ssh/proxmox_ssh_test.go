@@ -0,0 +1,33 @@
+package proxmox_ssh
+
+import (
+	"testing"
+
+	"proxima/internal/core/domain"
+)
+
+func TestCreateSteps_Quoting(t *testing.T) {
+	vm := domain.NewVM("web; reboot", 101)
+	vm.Template = "9000"
+	vm.Cores = 2
+	vm.Memory = 2048
+	vm.Storage = "local lvm"
+	vm.OSType = "l26"
+	vm.CIUser = "o'brien"
+	vm.Network = domain.Network{Bridge: "vmbr0", VLAN: 10, Model: "e1000"}
+
+	steps, err := NewProxmoxSSHAdapter("10.0.0.1", "root", "", 22).createSteps(vm)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(steps) != 2 {
+		t.Fatalf("Expected clone and configure steps, got %v", steps)
+	}
+
+	if want := `qm clone 9000 101 --name 'web; reboot' --full 1 --storage 'local lvm'`; steps[0].command != want {
+		t.Errorf("Expected clone command %q, got %q", want, steps[0].command)
+	}
+	if want := `qm set 101 --cores 2 --memory 2048 --net0 'e1000,bridge=vmbr0,tag=10' --ostype 'l26' --ciuser 'o'\''brien'`; steps[1].command != want {
+		t.Errorf("Expected update command %q, got %q", want, steps[1].command)
+	}
+}
@@ -1,12 +1,14 @@
 package ssh
 
 import (
+	"bytes"
 	"fmt"
 	"os"
 	"os/user"
 	"path/filepath"
 	"proxima/internal/core/domain"
 	"proxima/internal/core/ports"
+	"strings"
 	"time"
 
 	"golang.org/x/crypto/ssh"
@@ -17,6 +19,14 @@ type SSHAdapter struct {
 	proxmoxRepo ports.VMRepository
 }
 
+// Priority order of default keys
+var defaultKeyNames = []string{
+	"id_ed25519",
+	"id_rsa",
+	"id_ecdsa",
+	"id_dsa",
+}
+
 type SSHConfig struct {
 	User         string
 	Password     string
@@ -90,7 +100,7 @@ func (s *SSHAdapter) getSSHClient(host string) (*ssh.Client, error) {
 	}
 
 	if len(authMethods) == 0 {
-		return nil, fmt.Errorf("no SSH authentication method available - please configure password, key_path, or ensure default SSH keys exist in ~/.ssh/")
+		return nil, domain.Errorf(domain.ErrorKindAuth, "no SSH authentication method available - please configure password, key_path, or ensure default SSH keys exist in ~/.ssh/")
 	}
 
 	sshConfig := &ssh.ClientConfig{
@@ -102,12 +112,35 @@ func (s *SSHAdapter) getSSHClient(host string) (*ssh.Client, error) {
 
 	client, err := ssh.Dial("tcp", fmt.Sprintf("%s:%d", host, s.config.Port), sshConfig)
 	if err != nil {
-		return nil, fmt.Errorf("failed to connect to SSH at %s:%d with user %s: %w", host, s.config.Port, s.config.User, err)
+		kind := domain.ErrorKindTransport
+		if strings.Contains(err.Error(), "unable to authenticate") {
+			kind = domain.ErrorKindAuth
+		}
+		return nil, domain.WrapError(kind, fmt.Errorf("failed to connect to SSH at %s:%d with user %s: %w", host, s.config.Port, s.config.User, err))
 	}
 
 	return client, nil
 }
 
+// CheckConnection verifies that the VM accepts an authenticated SSH session.
+func (s *SSHAdapter) CheckConnection(vmid int) error {
+	host, err := s.getVMHost(vmid)
+	if err != nil {
+		return fmt.Errorf("failed to get VM host: %w", err)
+	}
+
+	client, err := s.getSSHClient(host)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if _, err := s.runRemote(client, "true", nil); err != nil {
+		return fmt.Errorf("SSH session on VM %d failed: %w", vmid, err)
+	}
+	return nil
+}
+
 func (s *SSHAdapter) ExecuteCommand(vmid int, command string, args []string, timeout int) (*domain.Command, error) {
 	host, err := s.getVMHost(vmid)
 	if err != nil {
@@ -139,7 +172,8 @@ func (s *SSHAdapter) ExecuteCommand(vmid int, command string, args []string, tim
 	output, err := session.CombinedOutput(fullCommand)
 	if err != nil {
 		outputStr := string(output)
-		cmd.Fail(outputStr + " - " + err.Error())
+		cmd.Output = outputStr
+		cmd.Fail(err.Error())
 		return cmd, fmt.Errorf("command '%s' failed on VM %d: output: %s, error: %w", fullCommand, vmid, outputStr, err)
 	}
 
@@ -193,7 +227,8 @@ func (s *SSHAdapter) ExecuteScript(vmid int, scriptPath string, args []string, t
 	output, err := session.CombinedOutput(fullCommand)
 	if err != nil {
 		outputStr := string(output)
-		cmd.Fail(outputStr + " - " + err.Error())
+		cmd.Output = outputStr
+		cmd.Fail(err.Error())
 		return cmd, fmt.Errorf("script '%s' execution failed on VM %d: output: %s, error: %w", scriptName, vmid, outputStr, err)
 	}
 
@@ -244,15 +279,7 @@ func (s *SSHAdapter) tryDefaultSSHKeys(authMethods *[]ssh.AuthMethod) error {
 
 	sshDir := filepath.Join(currentUser.HomeDir, ".ssh")
 
-	// Priority order of default keys
-	defaultKeys := []string{
-		"id_ed25519",
-		"id_rsa",
-		"id_ecdsa",
-		"id_dsa",
-	}
-
-	for _, keyName := range defaultKeys {
+	for _, keyName := range defaultKeyNames {
 		keyPath := filepath.Join(sshDir, keyName)
 		if _, err := os.Stat(keyPath); err == nil {
 			key, err := os.ReadFile(keyPath)
@@ -278,41 +305,209 @@ func (s *SSHAdapter) CopyLocalPublicKey(vmid int) error {
 		return fmt.Errorf("key copy is disabled")
 	}
 
-	currentUser, err := user.Current()
+	keys, err := s.LocalPublicKeys()
 	if err != nil {
-		return fmt.Errorf("failed to get current user: %w", err)
+		return err
 	}
 
-	publicKeyPath := filepath.Join(currentUser.HomeDir, ".ssh", "id_rsa.pub")
-	publicKey, err := os.ReadFile(publicKeyPath)
+	_, err = s.InstallAuthorizedKeys(vmid, "", keys)
+	return err
+}
+
+// LocalPublicKeys returns every default public key found in the current
+// user's ~/.ssh directory, in the same priority order used for authentication.
+func (s *SSHAdapter) LocalPublicKeys() ([]string, error) {
+	currentUser, err := user.Current()
 	if err != nil {
-		return fmt.Errorf("failed to read public key from %s: %w", publicKeyPath, err)
+		return nil, fmt.Errorf("failed to get current user: %w", err)
+	}
+
+	sshDir := filepath.Join(currentUser.HomeDir, ".ssh")
+
+	var keys []string
+	for _, keyName := range defaultKeyNames {
+		publicKeyPath := filepath.Join(sshDir, keyName+".pub")
+		publicKey, err := os.ReadFile(publicKeyPath)
+		if err != nil {
+			continue
+		}
+		keys = append(keys, strings.TrimSpace(string(publicKey)))
+	}
+
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no public keys found in %s", sshDir)
+	}
+
+	return keys, nil
+}
+
+// InstallAuthorizedKeys adds the given keys to the authorized_keys file of
+// targetUser on the VM, skipping keys that are already present. An empty
+// targetUser means the user proxima connects as.
+func (s *SSHAdapter) InstallAuthorizedKeys(vmid int, targetUser string, keys []string) (int, error) {
+	return s.updateAuthorizedKeys(vmid, targetUser, keys, mergeAuthorizedKeys)
+}
+
+// RemoveAuthorizedKeys removes the given keys from the authorized_keys file of
+// targetUser on the VM.
+func (s *SSHAdapter) RemoveAuthorizedKeys(vmid int, targetUser string, keys []string) (int, error) {
+	return s.updateAuthorizedKeys(vmid, targetUser, keys, removeAuthorizedKeys)
+}
+
+func (s *SSHAdapter) updateAuthorizedKeys(vmid int, targetUser string, keys []string, apply func(string, []ssh.PublicKey, []string) (string, int)) (int, error) {
+	parsed := make([]ssh.PublicKey, 0, len(keys))
+	lines := make([]string, 0, len(keys))
+	for _, key := range keys {
+		publicKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(key))
+		if err != nil {
+			return 0, domain.WrapError(domain.ErrorKindValidation, fmt.Errorf("invalid public key %q: %w", truncateKey(key), err))
+		}
+		parsed = append(parsed, publicKey)
+		lines = append(lines, strings.TrimSpace(key))
 	}
 
 	host, err := s.getVMHost(vmid)
 	if err != nil {
-		return fmt.Errorf("failed to get VM host: %w", err)
+		return 0, fmt.Errorf("failed to get VM host: %w", err)
 	}
 	client, err := s.getSSHClient(host)
 	if err != nil {
-		return fmt.Errorf("failed to connect: %w", err)
+		return 0, fmt.Errorf("failed to connect: %w", err)
 	}
 	defer client.Close()
 
+	existing, err := s.runRemote(client, s.keysScript(targetUser, `cat "$home/.ssh/authorized_keys" 2>/dev/null || true`), nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read authorized_keys on VM %d: %w", vmid, err)
+	}
+
+	content, changed := apply(string(existing), parsed, lines)
+
+	// Permissions are fixed even when no key changed, so a broken ~/.ssh is repaired on every run
+	script := `mkdir -p "$home/.ssh"`
+	var stdin []byte
+	if changed > 0 {
+		script += ` && cat > "$home/.ssh/authorized_keys.proxima" && mv "$home/.ssh/authorized_keys.proxima" "$home/.ssh/authorized_keys"`
+		stdin = []byte(content)
+	} else {
+		script += ` && touch "$home/.ssh/authorized_keys"`
+	}
+	script += ` && chmod 700 "$home/.ssh" && chmod 600 "$home/.ssh/authorized_keys"`
+	if targetUser != "" {
+		script += fmt.Sprintf(` && chown -R %s: "$home/.ssh"`, shellQuote(targetUser))
+	}
+	script += ` && { command -v restorecon >/dev/null 2>&1 && restorecon -R "$home/.ssh" || true; }`
+
+	if _, err := s.runRemote(client, s.keysScript(targetUser, script), stdin); err != nil {
+		return 0, fmt.Errorf("failed to update authorized_keys on VM %d: %w", vmid, err)
+	}
+
+	return changed, nil
+}
+
+// keysScript wraps a shell snippet so that $home points to the home directory of
+// targetUser, escalating with sudo when connected as a different non-root user.
+func (s *SSHAdapter) keysScript(targetUser, body string) string {
+	if targetUser == "" {
+		return `home="$HOME" && ` + body
+	}
+
+	script := fmt.Sprintf(`home="$(getent passwd %[1]s | cut -d: -f6)" && [ -n "$home" ] || { echo "user %[1]s not found" >&2; exit 1; }; %[2]s`,
+		shellQuote(targetUser), body)
+
+	if s.config.User != "root" && s.config.User != targetUser {
+		return "sudo -n sh -c " + shellQuote(script)
+	}
+	return "sh -c " + shellQuote(script)
+}
+
+// runRemote runs command and returns its standard output. Its standard error,
+// such as sudo or login banners, is kept apart and only ends up in the error.
+func (s *SSHAdapter) runRemote(client *ssh.Client, command string, stdin []byte) ([]byte, error) {
 	session, err := client.NewSession()
 	if err != nil {
-		return fmt.Errorf("failed to create session: %w", err)
+		return nil, fmt.Errorf("failed to create session: %w", err)
 	}
 	defer session.Close()
 
-	// Create .ssh directory if it doesn't exist and add the key
-	command := fmt.Sprintf("mkdir -p ~/.ssh && echo '%s' >> ~/.ssh/authorized_keys && chmod 600 ~/.ssh/authorized_keys", string(publicKey))
-	output, err := session.CombinedOutput(command)
+	if stdin != nil {
+		session.Stdin = bytes.NewReader(stdin)
+	}
+	var stderr bytes.Buffer
+	session.Stderr = &stderr
+
+	output, err := session.Output(command)
 	if err != nil {
-		return fmt.Errorf("failed to copy public key to VM %d: %s - %w", vmid, string(output), err)
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return output, fmt.Errorf("%s: %w", message, err)
+		}
+		return output, err
 	}
+	return output, nil
+}
 
-	return nil
+// mergeAuthorizedKeys appends the keys missing from an authorized_keys file.
+// Keys are compared by type and blob, so differing comments do not duplicate them.
+func mergeAuthorizedKeys(existing string, keys []ssh.PublicKey, lines []string) (string, int) {
+	present := make(map[string]bool)
+	for _, line := range strings.Split(existing, "\n") {
+		if publicKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(line)); err == nil {
+			present[string(publicKey.Marshal())] = true
+		}
+	}
+
+	content := existing
+	if content != "" && !strings.HasSuffix(content, "\n") {
+		content += "\n"
+	}
+
+	added := 0
+	for i, key := range keys {
+		fingerprint := string(key.Marshal())
+		if present[fingerprint] {
+			continue
+		}
+		present[fingerprint] = true
+		content += lines[i] + "\n"
+		added++
+	}
+
+	return content, added
+}
+
+// removeAuthorizedKeys drops every line of an authorized_keys file matching one of keys.
+func removeAuthorizedKeys(existing string, keys []ssh.PublicKey, _ []string) (string, int) {
+	remove := make(map[string]bool)
+	for _, key := range keys {
+		remove[string(key.Marshal())] = true
+	}
+
+	var kept []string
+	removed := 0
+	for _, line := range strings.Split(strings.TrimSuffix(existing, "\n"), "\n") {
+		if publicKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(line)); err == nil && remove[string(publicKey.Marshal())] {
+			removed++
+			continue
+		}
+		kept = append(kept, line)
+	}
+
+	if len(kept) == 0 || (len(kept) == 1 && kept[0] == "") {
+		return "", removed
+	}
+	return strings.Join(kept, "\n") + "\n", removed
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+func truncateKey(key string) string {
+	key = strings.TrimSpace(key)
+	if len(key) > 40 {
+		return key[:40] + "..."
+	}
+	return key
 }
 
 func (s *SSHAdapter) getVMHost(vmid int) (string, error) {
@@ -0,0 +1,68 @@
+package ssh
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func generateAuthorizedKey(t *testing.T, comment string) (ssh.PublicKey, string) {
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+
+	publicKey, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatalf("Failed to convert key: %v", err)
+	}
+
+	line := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(publicKey))) + " " + comment
+	return publicKey, line
+}
+
+func TestMergeAuthorizedKeys(t *testing.T) {
+	existingKey, existingLine := generateAuthorizedKey(t, "old@host")
+	newKey, newLine := generateAuthorizedKey(t, "new@host")
+
+	// Same key with a different comment must not be added again
+	renamedLine := strings.Replace(existingLine, "old@host", "renamed@host", 1)
+
+	content, added := mergeAuthorizedKeys(existingLine, []ssh.PublicKey{existingKey, newKey}, []string{renamedLine, newLine})
+
+	if added != 1 {
+		t.Errorf("Expected 1 key added, got %d", added)
+	}
+
+	expected := existingLine + "\n" + newLine + "\n"
+	if content != expected {
+		t.Errorf("Expected content %q, got %q", expected, content)
+	}
+
+	// Running again must be a no-op
+	_, added = mergeAuthorizedKeys(content, []ssh.PublicKey{existingKey, newKey}, []string{existingLine, newLine})
+	if added != 0 {
+		t.Errorf("Expected no keys added on second run, got %d", added)
+	}
+}
+
+func TestRemoveAuthorizedKeys(t *testing.T) {
+	_, keepLine := generateAuthorizedKey(t, "keep@host")
+	dropKey, dropLine := generateAuthorizedKey(t, "drop@host")
+
+	existing := "# managed keys\n" + keepLine + "\n" + dropLine + "\n"
+
+	content, removed := removeAuthorizedKeys(existing, []ssh.PublicKey{dropKey}, nil)
+
+	if removed != 1 {
+		t.Errorf("Expected 1 key removed, got %d", removed)
+	}
+
+	expected := "# managed keys\n" + keepLine + "\n"
+	if content != expected {
+		t.Errorf("Expected content %q, got %q", expected, content)
+	}
+}
@@ -0,0 +1,98 @@
+package state
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"proxima/internal/core/ports"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+// FileName is the state file written next to the configuration file, or in
+// the configuration directory.
+const FileName = ".proxima-state.yaml"
+
+// State holds what proxima learned from the cluster and must remember between
+// runs, such as the VMIDs allocated to VMs declared without one.
+type State struct {
+	VMIDs map[string]int `yaml:"vmids"`
+}
+
+type StateAdapter struct {
+	path  string
+	state State
+	mu    sync.Mutex
+}
+
+// DefaultPath returns the state file path for a configuration file, or in a
+// configuration directory.
+func DefaultPath(configFile string) string {
+	if info, err := os.Stat(configFile); err == nil && info.IsDir() {
+		return filepath.Join(configFile, FileName)
+	}
+	return filepath.Join(filepath.Dir(configFile), FileName)
+}
+
+func NewStateAdapter(path string) (*StateAdapter, error) {
+	adapter := &StateAdapter{
+		path:  path,
+		state: State{VMIDs: make(map[string]int)},
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return adapter, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state file: %w", err)
+	}
+
+	if err := yaml.Unmarshal(data, &adapter.state); err != nil {
+		return nil, fmt.Errorf("failed to parse state file %s: %w", path, err)
+	}
+	if adapter.state.VMIDs == nil {
+		adapter.state.VMIDs = make(map[string]int)
+	}
+
+	return adapter, nil
+}
+
+func (s *StateAdapter) GetVMID(name string) (int, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id, ok := s.state.VMIDs[name]
+	return id, ok
+}
+
+func (s *StateAdapter) SetVMID(name string, id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if current, ok := s.state.VMIDs[name]; ok && current == id {
+		return nil
+	}
+	s.state.VMIDs[name] = id
+	return s.save()
+}
+
+func (s *StateAdapter) save() error {
+	data, err := yaml.Marshal(&s.state)
+	if err != nil {
+		return fmt.Errorf("failed to encode state: %w", err)
+	}
+
+	// Write to a temporary file first so an interrupted run never leaves a truncated state
+	tmpPath := s.path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write state file: %w", err)
+	}
+	if err := os.Rename(tmpPath, s.path); err != nil {
+		return fmt.Errorf("failed to write state file: %w", err)
+	}
+	return nil
+}
+
+var _ ports.StateRepository = (*StateAdapter)(nil)
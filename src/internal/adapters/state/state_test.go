@@ -0,0 +1,66 @@
+package state
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestStateAdapter_SetVMID(t *testing.T) {
+	path := filepath.Join(t.TempDir(), FileName)
+
+	adapter, err := NewStateAdapter(path)
+	if err != nil {
+		t.Fatalf("Failed to open missing state: %v", err)
+	}
+	if _, ok := adapter.GetVMID("web"); ok {
+		t.Error("Expected no VMID in an empty state")
+	}
+	if err := adapter.SetVMID("web", 201); err != nil {
+		t.Fatalf("Failed to set VMID: %v", err)
+	}
+	if _, err := os.Stat(path + ".tmp"); !os.IsNotExist(err) {
+		t.Errorf("Expected no temporary file left, got %v", err)
+	}
+
+	// A later run reads what the previous one recorded
+	reloaded, err := NewStateAdapter(path)
+	if err != nil {
+		t.Fatalf("Failed to reload state: %v", err)
+	}
+	if id, ok := reloaded.GetVMID("web"); !ok || id != 201 {
+		t.Errorf("Expected VMID 201 for web, got %d (%v)", id, ok)
+	}
+}
+
+func TestStateAdapter_Invalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), FileName)
+	if err := os.WriteFile(path, []byte("vmids: [web"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewStateAdapter(path); err == nil {
+		t.Error("Expected an error for a malformed state file")
+	}
+}
+
+func TestDefaultPath(t *testing.T) {
+	dir := t.TempDir()
+	configFile := filepath.Join(dir, "config.yaml")
+
+	tests := []struct {
+		name   string
+		config string
+		want   string
+	}{
+		{"config file", configFile, filepath.Join(dir, FileName)},
+		{"config directory", dir, filepath.Join(dir, FileName)},
+		{"nested directory", filepath.Join(dir, "infra", "config.yaml"), filepath.Join(dir, "infra", FileName)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DefaultPath(tt.config); got != tt.want {
+				t.Errorf("Expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
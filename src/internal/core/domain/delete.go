@@ -0,0 +1,20 @@
+package domain
+
+import "time"
+
+// DeleteOptions controls how a VM is taken down and destroyed.
+type DeleteOptions struct {
+	// Graceful asks the guest to shut down before forcing the VM off
+	Graceful        bool
+	ShutdownTimeout time.Duration
+	// Purge also removes the VM from backup jobs, HA and replication, and
+	// destroys disks it no longer references
+	Purge bool
+}
+
+func DefaultDeleteOptions() DeleteOptions {
+	return DeleteOptions{
+		ShutdownTimeout: 60 * time.Second,
+		Purge:           true,
+	}
+}
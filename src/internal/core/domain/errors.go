@@ -0,0 +1,75 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrorKind classifies failures so callers can react to them, e.g. retry on
+// transport errors but abort on authentication errors.
+type ErrorKind string
+
+const (
+	ErrorKindNotFound   ErrorKind = "not_found"
+	ErrorKindAuth       ErrorKind = "auth"
+	ErrorKindConflict   ErrorKind = "conflict"
+	ErrorKindTimeout    ErrorKind = "timeout"
+	ErrorKindValidation ErrorKind = "validation"
+	ErrorKindTransport  ErrorKind = "transport"
+)
+
+// Error attaches an ErrorKind to an error. It can be matched with errors.Is
+// against the sentinels below, regardless of how deeply it is wrapped.
+type Error struct {
+	Kind ErrorKind
+	Err  error
+}
+
+var (
+	ErrNotFound   = &Error{Kind: ErrorKindNotFound}
+	ErrAuth       = &Error{Kind: ErrorKindAuth}
+	ErrConflict   = &Error{Kind: ErrorKindConflict}
+	ErrTimeout    = &Error{Kind: ErrorKindTimeout}
+	ErrValidation = &Error{Kind: ErrorKindValidation}
+	ErrTransport  = &Error{Kind: ErrorKindTransport}
+)
+
+// Errorf formats an error of the given kind. Like fmt.Errorf, it supports %w.
+func Errorf(kind ErrorKind, format string, args ...any) error {
+	return &Error{Kind: kind, Err: fmt.Errorf(format, args...)}
+}
+
+// WrapError attaches a kind to err. A nil err or an empty kind leaves err unchanged.
+func WrapError(kind ErrorKind, err error) error {
+	if err == nil || kind == "" {
+		return err
+	}
+	return &Error{Kind: kind, Err: err}
+}
+
+func (e *Error) Error() string {
+	if e.Err == nil {
+		return string(e.Kind)
+	}
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is matches the kind sentinels (errors.Is(err, domain.ErrNotFound)).
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Err == nil && t.Kind == e.Kind
+}
+
+// KindOf returns the kind of the outermost classified error in err's chain,
+// or an empty kind when err is not classified.
+func KindOf(err error) ErrorKind {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Kind
+	}
+	return ""
+}
@@ -0,0 +1,45 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestError_Is(t *testing.T) {
+	err := fmt.Errorf("failed to start VM 999: %w", Errorf(ErrorKindNotFound, "VM %d does not exist", 999))
+
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected %v to match ErrNotFound", err)
+	}
+	if errors.Is(err, ErrAuth) {
+		t.Errorf("Expected %v not to match ErrAuth", err)
+	}
+	if err.Error() != "failed to start VM 999: VM 999 does not exist" {
+		t.Errorf("Expected message to be preserved, got '%s'", err.Error())
+	}
+}
+
+func TestKindOf(t *testing.T) {
+	cause := WrapError(ErrorKindTransport, errors.New("connection refused"))
+
+	tests := []struct {
+		name string
+		err  error
+		want ErrorKind
+	}{
+		{"nil", nil, ""},
+		{"plain", errors.New("boom"), ""},
+		{"wrapped", fmt.Errorf("ctx: %w", cause), ErrorKindTransport},
+		{"outermost wins", Errorf(ErrorKindTimeout, "gave up: %w", cause), ErrorKindTimeout},
+		{"empty kind", WrapError("", errors.New("boom")), ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := KindOf(tt.err); got != tt.want {
+				t.Errorf("Expected kind '%s', got '%s'", tt.want, got)
+			}
+		})
+	}
+}
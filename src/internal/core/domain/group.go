@@ -0,0 +1,70 @@
+package domain
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// IndexPlaceholder stands for the index of an instance in the name of a VM
+// group.
+const IndexPlaceholder = "{{index}}"
+
+// VMGroup is a VM defined once and created Count times. Its instances are
+// named after Pattern, with IndexPlaceholder replaced by their index from 1,
+// and numbered from VMIDStart unless it is 0.
+type VMGroup struct {
+	Name      string
+	Pattern   string
+	Count     int
+	VMIDStart int
+}
+
+// NewVMGroup returns the group of count instances named after pattern. The
+// group is named after the pattern without the index and the separators
+// around it: "web-{{index}}" is the group "web".
+func NewVMGroup(pattern string, count int) VMGroup {
+	name := strings.Trim(strings.Replace(pattern, IndexPlaceholder, "", 1), "-_.")
+	return VMGroup{Name: name, Pattern: pattern, Count: count}
+}
+
+// InstanceName returns the name of the instance with the given index. Indexes
+// have at least two digits, so that names sort and web-01 keeps its name when
+// the group grows past 9.
+func (g VMGroup) InstanceName(index int) string {
+	return strings.Replace(g.Pattern, IndexPlaceholder, fmt.Sprintf("%02d", index), 1)
+}
+
+// Index returns the index of the instance named name, and false when name is
+// not the name of an instance of the group.
+func (g VMGroup) Index(name string) (int, bool) {
+	prefix, suffix, _ := strings.Cut(g.Pattern, IndexPlaceholder)
+	if len(name) <= len(prefix)+len(suffix) || !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, suffix) {
+		return 0, false
+	}
+	index, err := strconv.Atoi(name[len(prefix) : len(name)-len(suffix)])
+	if err != nil || index < 1 || g.InstanceName(index) != name {
+		return 0, false
+	}
+	return index, true
+}
+
+// Surplus returns the VMs of vms that are instances of the group beyond its
+// count, such as web-09 once web is scaled down to 8. A VM named like an
+// instance is only one when its VMID is the one recorded for its name, which
+// recorded returns, or the one VMIDStart gives its index: VMs created apart
+// from the group are never surplus.
+func (g VMGroup) Surplus(vms []*VM, recorded func(name string) (int, bool)) []*VM {
+	var surplus []*VM
+	for _, vm := range vms {
+		index, ok := g.Index(vm.Name)
+		if !ok || index <= g.Count {
+			continue
+		}
+		id, ok := recorded(vm.Name)
+		if (ok && id == vm.ID) || (g.VMIDStart != 0 && g.VMIDStart+index-1 == vm.ID) {
+			surplus = append(surplus, vm)
+		}
+	}
+	return surplus
+}
@@ -0,0 +1,77 @@
+package domain
+
+import "testing"
+
+func TestNewVMGroup(t *testing.T) {
+	tests := []struct {
+		pattern string
+		name    string
+	}{
+		{"web-{{index}}", "web"},
+		{"{{index}}.cache", "cache"},
+		{"db{{index}}-eu", "db-eu"},
+	}
+
+	for _, tt := range tests {
+		if group := NewVMGroup(tt.pattern, 1); group.Name != tt.name {
+			t.Errorf("Expected group %q to be named %q, got %q", tt.pattern, tt.name, group.Name)
+		}
+	}
+}
+
+func TestVMGroup_Index(t *testing.T) {
+	group := NewVMGroup("web-{{index}}", 8)
+
+	tests := []struct {
+		name  string
+		index int
+		ok    bool
+	}{
+		{"web-01", 1, true},
+		{"web-12", 12, true},
+		{"web-100", 100, true},
+		{"web-1", 0, false},
+		{"web-00", 0, false},
+		{"web-+1", 0, false},
+		{"web-", 0, false},
+		{"web-db", 0, false},
+		{"api-01", 0, false},
+	}
+
+	for _, tt := range tests {
+		index, ok := group.Index(tt.name)
+		if index != tt.index || ok != tt.ok {
+			t.Errorf("Expected Index(%q) to be %d, %v, got %d, %v", tt.name, tt.index, tt.ok, index, ok)
+		}
+		if ok && group.InstanceName(index) != tt.name {
+			t.Errorf("Expected InstanceName(%d) to be %q, got %q", index, tt.name, group.InstanceName(index))
+		}
+	}
+}
+
+func TestVMGroup_Surplus(t *testing.T) {
+	group := NewVMGroup("web-{{index}}", 2)
+	vms := []*VM{NewVM("web-01", 200), NewVM("web-02", 201), NewVM("web-03", 202), NewVM("db-03", 300), NewVM("web-10", 209), NewVM("web-04", 150)}
+
+	// web-04 was created by hand, with another VMID than the one recorded
+	state := map[string]int{"web-01": 200, "web-02": 201, "web-03": 202, "db-03": 300, "web-10": 209, "web-04": 203}
+	recorded := func(name string) (int, bool) {
+		id, ok := state[name]
+		return id, ok
+	}
+	surplus := group.Surplus(vms, recorded)
+	if len(surplus) != 2 || surplus[0].Name != "web-03" || surplus[1].Name != "web-10" {
+		t.Errorf("Expected web-03 and web-10 to be surplus, got %v", surplus)
+	}
+
+	// Without a state, only the VMIDs numbered from vmid_start are instances
+	none := func(string) (int, bool) { return 0, false }
+	if surplus := group.Surplus(vms, none); len(surplus) != 0 {
+		t.Errorf("Expected no surplus without a state or vmid_start, got %v", surplus)
+	}
+	group.VMIDStart = 200
+	surplus = group.Surplus(vms, none)
+	if len(surplus) != 2 || surplus[0].Name != "web-03" || surplus[1].Name != "web-10" {
+		t.Errorf("Expected web-03 and web-10 to be surplus from vmid_start, got %v", surplus)
+	}
+}
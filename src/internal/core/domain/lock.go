@@ -0,0 +1,33 @@
+package domain
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+// IsLocked reports whether err is a conflict on a VM or storage lock held by
+// another task, e.g. a clone of the same template. Unlike other conflicts, it
+// goes away once that task ends.
+func IsLocked(err error) bool {
+	if !errors.Is(err, ErrConflict) {
+		return false
+	}
+	message := strings.ToLower(err.Error())
+	return strings.Contains(message, "lock") && !strings.Contains(message, "already exists")
+}
+
+// RetryLocked runs fn until it succeeds, fails for a reason other than a
+// lock, or opts.Timeout has elapsed, backing off between attempts.
+func RetryLocked(opts WaitOptions, fn func() error) error {
+	deadline := time.Now().Add(opts.Timeout)
+	interval := opts.Interval
+	for {
+		err := fn()
+		if !IsLocked(err) || time.Now().Add(interval).After(deadline) {
+			return err
+		}
+		time.Sleep(interval)
+		interval = opts.NextInterval(interval)
+	}
+}
@@ -0,0 +1,57 @@
+package domain
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestIsLocked(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"lock timeout", Errorf(ErrorKindConflict, "can't lock file '/var/lock/qemu-server/lock-9000.conf' - got timeout"), true},
+		{"VM locked", Errorf(ErrorKindConflict, "VM is locked (clone)"), true},
+		{"already exists", Errorf(ErrorKindConflict, "unable to create VM 101: config file already exists"), false},
+		{"unclassified", errors.New("can't lock file"), false},
+		{"nil", nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsLocked(tt.err); got != tt.want {
+				t.Errorf("Expected IsLocked(%v) to be %v", tt.err, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetryLocked(t *testing.T) {
+	opts := WaitOptions{Timeout: time.Second, Interval: time.Millisecond}
+	locked := Errorf(ErrorKindConflict, "VM is locked (clone)")
+
+	attempts := 0
+	err := RetryLocked(opts, func() error {
+		attempts++
+		if attempts < 3 {
+			return locked
+		}
+		return nil
+	})
+	if err != nil || attempts != 3 {
+		t.Errorf("Expected success on the third attempt, got %v after %d attempts", err, attempts)
+	}
+
+	attempts = 0
+	notFound := Errorf(ErrorKindNotFound, "VM 101 does not exist")
+	if err := RetryLocked(opts, func() error { attempts++; return notFound }); err != notFound || attempts != 1 {
+		t.Errorf("Expected other errors to be returned at once, got %v after %d attempts", err, attempts)
+	}
+
+	opts.Timeout = 5 * time.Millisecond
+	if err := RetryLocked(opts, func() error { return locked }); !IsLocked(err) {
+		t.Errorf("Expected the lock error once the timeout elapsed, got %v", err)
+	}
+}
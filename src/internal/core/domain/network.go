@@ -0,0 +1,181 @@
+package domain
+
+import (
+	"fmt"
+	"net"
+	"path"
+	"sort"
+	"strings"
+)
+
+type NetworkInterface struct {
+	Name      string
+	MAC       string
+	Addresses []IPAddress
+	Source    string
+}
+
+type IPAddress struct {
+	Address string
+	Prefix  int
+	Family  IPFamily
+}
+
+type IPFamily string
+
+const (
+	IPFamilyIPv4 IPFamily = "ipv4"
+	IPFamilyIPv6 IPFamily = "ipv6"
+)
+
+// IPPreferences controls which address is picked when a VM reports several.
+type IPPreferences struct {
+	// Interfaces are glob patterns (e.g. "eth0", "ens*") tried in order before any other interface.
+	Interfaces []string
+	// CIDRs restricts the candidates to addresses inside one of these networks.
+	CIDRs []string
+	// Prefer selects the family tried first; defaults to IPv4.
+	Prefer IPFamily
+	// SyntheticFallback allows deriving an address from the VMID when nothing else is known.
+	SyntheticFallback bool
+}
+
+func NewIPAddress(address string, prefix int) IPAddress {
+	family := IPFamilyIPv4
+	if ip := net.ParseIP(address); ip != nil && ip.To4() == nil {
+		family = IPFamilyIPv6
+	}
+	return IPAddress{Address: address, Prefix: prefix, Family: family}
+}
+
+// String returns the address in CIDR notation when the prefix is known.
+func (a IPAddress) String() string {
+	if a.Prefix > 0 {
+		return fmt.Sprintf("%s/%d", a.Address, a.Prefix)
+	}
+	return a.Address
+}
+
+// Usable reports whether the address can be used to reach the VM, excluding
+// loopback, link-local and unspecified addresses.
+func (a IPAddress) Usable() bool {
+	ip := net.ParseIP(a.Address)
+	if ip == nil {
+		return false
+	}
+	return !ip.IsLoopback() && !ip.IsLinkLocalUnicast() && !ip.IsUnspecified()
+}
+
+func (p IPPreferences) Validate() error {
+	for _, pattern := range p.Interfaces {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid interface pattern '%s': %w", pattern, err)
+		}
+	}
+	for _, cidr := range p.CIDRs {
+		if _, _, err := net.ParseCIDR(cidr); err != nil {
+			return fmt.Errorf("invalid CIDR '%s': %w", cidr, err)
+		}
+	}
+	switch p.Prefer {
+	case "", IPFamilyIPv4, IPFamilyIPv6:
+	default:
+		return fmt.Errorf("invalid IP family preference '%s' (expected ipv4 or ipv6)", p.Prefer)
+	}
+	return nil
+}
+
+// SelectIP returns the best address among the given interfaces according to the preferences.
+func (p IPPreferences) SelectIP(ifaces []NetworkInterface) (string, bool) {
+	var networks []*net.IPNet
+	for _, cidr := range p.CIDRs {
+		if _, network, err := net.ParseCIDR(cidr); err == nil {
+			networks = append(networks, network)
+		}
+	}
+
+	prefer := p.Prefer
+	if prefer == "" {
+		prefer = IPFamilyIPv4
+	}
+
+	type candidate struct {
+		address   string
+		ifaceRank int
+		family    int
+	}
+
+	var candidates []candidate
+	for _, iface := range ifaces {
+		if iface.Name == "lo" {
+			continue
+		}
+		rank := p.interfaceRank(iface.Name)
+		for _, addr := range iface.Addresses {
+			if !addr.Usable() || !inNetworks(addr.Address, networks) {
+				continue
+			}
+			family := 1
+			if addr.Family == prefer {
+				family = 0
+			}
+			candidates = append(candidates, candidate{addr.Address, rank, family})
+		}
+	}
+
+	if len(candidates) == 0 {
+		return "", false
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].ifaceRank != candidates[j].ifaceRank {
+			return candidates[i].ifaceRank < candidates[j].ifaceRank
+		}
+		return candidates[i].family < candidates[j].family
+	})
+
+	return candidates[0].address, true
+}
+
+// interfaceRank returns the index of the first pattern matching name, or
+// len(Interfaces) when none does.
+func (p IPPreferences) interfaceRank(name string) int {
+	for i, pattern := range p.Interfaces {
+		if ok, _ := path.Match(pattern, name); ok {
+			return i
+		}
+	}
+	return len(p.Interfaces)
+}
+
+func inNetworks(address string, networks []*net.IPNet) bool {
+	if len(networks) == 0 {
+		return true
+	}
+	ip := net.ParseIP(address)
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseIPConfig extracts the static addresses of a cloud-init ipconfigN value
+// such as "ip=10.0.0.5/24,gw=10.0.0.1,ip6=auto". DHCP and SLAAC entries are skipped.
+func ParseIPConfig(value string) []IPAddress {
+	var addresses []IPAddress
+	for _, part := range strings.Split(value, ",") {
+		key, val, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok || (key != "ip" && key != "ip6") {
+			continue
+		}
+		ip, network, err := net.ParseCIDR(val)
+		if err != nil {
+			continue
+		}
+		prefix, _ := network.Mask.Size()
+		addresses = append(addresses, NewIPAddress(ip.String(), prefix))
+	}
+	return addresses
+}
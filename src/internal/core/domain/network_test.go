@@ -0,0 +1,88 @@
+package domain
+
+import "testing"
+
+func TestIPPreferences_SelectIP(t *testing.T) {
+	ifaces := []NetworkInterface{
+		{Name: "lo", Addresses: []IPAddress{NewIPAddress("127.0.0.1", 8)}},
+		{Name: "docker0", Addresses: []IPAddress{NewIPAddress("172.17.0.1", 16)}},
+		{Name: "ens18", Addresses: []IPAddress{
+			NewIPAddress("fe80::1", 64),
+			NewIPAddress("2001:db8::10", 64),
+			NewIPAddress("192.168.1.50", 24),
+		}},
+	}
+
+	tests := []struct {
+		name     string
+		prefs    IPPreferences
+		expected string
+	}{
+		{
+			name:     "first usable IPv4 by default",
+			prefs:    IPPreferences{},
+			expected: "172.17.0.1",
+		},
+		{
+			name:     "preferred interface first",
+			prefs:    IPPreferences{Interfaces: []string{"ens*", "eth*"}},
+			expected: "192.168.1.50",
+		},
+		{
+			name:     "IPv6 preference",
+			prefs:    IPPreferences{Interfaces: []string{"ens*"}, Prefer: IPFamilyIPv6},
+			expected: "2001:db8::10",
+		},
+		{
+			name:     "CIDR filter",
+			prefs:    IPPreferences{CIDRs: []string{"192.168.0.0/16"}},
+			expected: "192.168.1.50",
+		},
+		{
+			name:     "nothing matches",
+			prefs:    IPPreferences{CIDRs: []string{"10.0.0.0/8"}},
+			expected: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ip, ok := tt.prefs.SelectIP(ifaces)
+			if ip != tt.expected {
+				t.Errorf("Expected IP '%s', got '%s'", tt.expected, ip)
+			}
+			if ok != (tt.expected != "") {
+				t.Errorf("Expected ok=%v, got %v", tt.expected != "", ok)
+			}
+		})
+	}
+}
+
+func TestIPPreferences_Validate(t *testing.T) {
+	if err := (IPPreferences{CIDRs: []string{"10.0.0.0/8"}, Prefer: IPFamilyIPv6}).Validate(); err != nil {
+		t.Errorf("Expected valid preferences, got: %v", err)
+	}
+	if err := (IPPreferences{CIDRs: []string{"10.0.0.0"}}).Validate(); err == nil {
+		t.Error("Expected error for CIDR without prefix")
+	}
+	if err := (IPPreferences{Prefer: "ipv5"}).Validate(); err == nil {
+		t.Error("Expected error for unknown family")
+	}
+}
+
+func TestParseIPConfig(t *testing.T) {
+	addresses := ParseIPConfig("ip=10.0.0.5/24,gw=10.0.0.1,ip6=2001:db8::5/64,gw6=2001:db8::1")
+	if len(addresses) != 2 {
+		t.Fatalf("Expected 2 addresses, got %d", len(addresses))
+	}
+	if addresses[0].Address != "10.0.0.5" || addresses[0].Prefix != 24 || addresses[0].Family != IPFamilyIPv4 {
+		t.Errorf("Unexpected IPv4 address: %+v", addresses[0])
+	}
+	if addresses[1].Address != "2001:db8::5" || addresses[1].Family != IPFamilyIPv6 {
+		t.Errorf("Unexpected IPv6 address: %+v", addresses[1])
+	}
+
+	if addresses := ParseIPConfig("ip=dhcp,ip6=auto"); len(addresses) != 0 {
+		t.Errorf("Expected no static addresses for DHCP, got %v", addresses)
+	}
+}
@@ -0,0 +1,67 @@
+package domain
+
+// StartWaves groups VMs into waves started one after another; the VMs of a
+// wave may start in parallel. A VM comes after the VMs it depends on and after
+// the VMs with a lower StartOrder. Dependencies outside vms are ignored.
+// Contradicting constraints are reported as a validation error.
+func StartWaves(vms []*VM) ([][]*VM, error) {
+	byName := make(map[string]*VM)
+	for _, vm := range vms {
+		if vm.Name != "" {
+			byName[vm.Name] = vm
+		}
+	}
+
+	levels := make(map[*VM]int)
+	visiting := make(map[*VM]bool)
+
+	var visit func(vm *VM) error
+	visit = func(vm *VM) error {
+		if _, done := levels[vm]; done {
+			return nil
+		}
+		if visiting[vm] {
+			return Errorf(ErrorKindValidation, "start_order and depends_on form a cycle through VM %s", vm.Label())
+		}
+		visiting[vm] = true
+		defer delete(visiting, vm)
+
+		var before []*VM
+		for _, name := range vm.DependsOn {
+			if dep, ok := byName[name]; ok {
+				before = append(before, dep)
+			}
+		}
+		for _, other := range vms {
+			if other.StartOrder < vm.StartOrder {
+				before = append(before, other)
+			}
+		}
+
+		level := 0
+		for _, dep := range before {
+			if err := visit(dep); err != nil {
+				return err
+			}
+			if levels[dep] >= level {
+				level = levels[dep] + 1
+			}
+		}
+		levels[vm] = level
+		return nil
+	}
+
+	var waves [][]*VM
+	for _, vm := range vms {
+		if err := visit(vm); err != nil {
+			return nil, err
+		}
+	}
+	for _, vm := range vms {
+		for len(waves) <= levels[vm] {
+			waves = append(waves, nil)
+		}
+		waves[levels[vm]] = append(waves[levels[vm]], vm)
+	}
+	return waves, nil
+}
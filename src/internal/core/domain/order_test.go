@@ -0,0 +1,53 @@
+package domain
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestStartWaves(t *testing.T) {
+	db := NewVM("db", 100)
+	cache := NewVM("cache", 101)
+	app := NewVM("app", 102)
+	app.DependsOn = []string{"db", "cache", "missing"}
+	proxy := NewVM("proxy", 103)
+	proxy.StartOrder = 1
+
+	waves, err := StartWaves([]*VM{proxy, app, cache, db})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := [][]string{{"cache", "db"}, {"app"}, {"proxy"}}
+	if len(waves) != len(expected) {
+		t.Fatalf("Expected %d waves, got %d", len(expected), len(waves))
+	}
+	for i, wave := range waves {
+		var names []string
+		for _, vm := range wave {
+			names = append(names, vm.Name)
+		}
+		if len(names) != len(expected[i]) {
+			t.Errorf("Expected wave %d to be %v, got %v", i, expected[i], names)
+			continue
+		}
+		for j := range names {
+			if names[j] != expected[i][j] {
+				t.Errorf("Expected wave %d to be %v, got %v", i, expected[i], names)
+				break
+			}
+		}
+	}
+}
+
+func TestStartWaves_Cycle(t *testing.T) {
+	db := NewVM("db", 100)
+	db.StartOrder = 2
+	app := NewVM("app", 101)
+	app.StartOrder = 1
+	app.DependsOn = []string{"db"}
+
+	if _, err := StartWaves([]*VM{db, app}); !errors.Is(err, ErrValidation) {
+		t.Errorf("Expected validation error, got %v", err)
+	}
+}
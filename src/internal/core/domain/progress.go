@@ -0,0 +1,24 @@
+package domain
+
+// CreatePhase is the step a VM creation has reached.
+type CreatePhase string
+
+const (
+	PhaseWaiting      CreatePhase = "waiting"
+	PhaseCloning      CreatePhase = "cloning"
+	PhaseConfiguring  CreatePhase = "configuring"
+	PhaseResizing     CreatePhase = "resizing"
+	PhaseStarting     CreatePhase = "starting"
+	PhaseProvisioning CreatePhase = "provisioning"
+)
+
+// ProgressFunc is told about each phase of a VM creation as it begins.
+// Creations run in parallel, so it must be safe for concurrent use.
+type ProgressFunc func(vm *VM, phase CreatePhase)
+
+// Report calls f, unless it is nil.
+func (f ProgressFunc) Report(vm *VM, phase CreatePhase) {
+	if f != nil {
+		f(vm, phase)
+	}
+}
@@ -0,0 +1,68 @@
+package domain
+
+import (
+	"io"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// redacted replaces secrets in redacted text.
+const redacted = "[REDACTED]"
+
+// MinSecretLength is the length below which secrets are not masked: a value as
+// short as "x" appears in most text, which masking it would mangle.
+const MinSecretLength = 6
+
+// Redactor masks known secret values, such as the passwords resolved from the
+// config, in text about to be logged or shown in an error message.
+type Redactor struct {
+	secrets []string
+	mu      sync.RWMutex
+}
+
+func NewRedactor() *Redactor {
+	return &Redactor{}
+}
+
+// Add registers secrets to mask. Values shorter than MinSecretLength are
+// ignored.
+func (r *Redactor) Add(secrets ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, secret := range secrets {
+		if len(secret) >= MinSecretLength {
+			r.secrets = append(r.secrets, secret)
+		}
+	}
+	// Longer secrets first, so that one containing another is masked whole
+	sort.Slice(r.secrets, func(i, j int) bool { return len(r.secrets[i]) > len(r.secrets[j]) })
+}
+
+// Redact returns text with every registered secret masked.
+func (r *Redactor) Redact(text string) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, secret := range r.secrets {
+		text = strings.ReplaceAll(text, secret, redacted)
+	}
+	return text
+}
+
+// Writer returns a writer masking secrets before writing to w. Each write is
+// redacted on its own, which suits line-oriented output such as logs.
+func (r *Redactor) Writer(w io.Writer) io.Writer {
+	return &redactingWriter{redactor: r, w: w}
+}
+
+type redactingWriter struct {
+	redactor *Redactor
+	w        io.Writer
+}
+
+func (w *redactingWriter) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(w.w, w.redactor.Redact(string(p))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
@@ -0,0 +1,41 @@
+package domain
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+func TestRedactor(t *testing.T) {
+	redactor := NewRedactor()
+	redactor.Add("hunter2", "", "hunter2-suffix")
+
+	err := fmt.Errorf("login failed for root@pam with password hunter2-suffix (was hunter2)")
+	want := "login failed for root@pam with password [REDACTED] (was [REDACTED])"
+	if got := redactor.Redact(err.Error()); got != want {
+		t.Errorf("Expected '%s', got '%s'", want, got)
+	}
+
+	var buf bytes.Buffer
+	n, writeErr := fmt.Fprintf(redactor.Writer(&buf), "sshpass -p hunter2 ssh root@pve\n")
+	if writeErr != nil || n != len("sshpass -p hunter2 ssh root@pve\n") {
+		t.Errorf("Expected the full write to be reported, got %d, %v", n, writeErr)
+	}
+	if buf.String() != "sshpass -p [REDACTED] ssh root@pve\n" {
+		t.Errorf("Expected the secret to be masked, got '%s'", buf.String())
+	}
+
+	if got := NewRedactor().Redact("nothing to hide"); got != "nothing to hide" {
+		t.Errorf("Expected text without secrets to be unchanged, got '%s'", got)
+	}
+}
+
+func TestRedactor_ShortSecrets(t *testing.T) {
+	redactor := NewRedactor()
+	redactor.Add("x", "pve1", "12345")
+
+	text := "vms[0].memory: invalid value 'max' (expected e.g. 32G); model virtio, vlan above the maximum 4094 on pve1"
+	if got := redactor.Redact(text); got != text {
+		t.Errorf("Expected short secrets to leave text intact, got '%s'", got)
+	}
+}
@@ -0,0 +1,91 @@
+package domain
+
+import (
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var vmidRangePattern = regexp.MustCompile(`^(\d+)-(\d+)$`)
+
+// VMSelector identifies one or more VMs by VMID, VMID range (e.g. "100-120"),
+// exact name, name glob (e.g. "web-*") or tag ("tag:frontend").
+type VMSelector struct {
+	Raw     string
+	ID      int
+	Min     int
+	Max     int
+	Name    string
+	Pattern string
+	Tag     string
+}
+
+func ParseVMSelector(raw string) (VMSelector, error) {
+	raw = strings.TrimSpace(raw)
+	selector := VMSelector{Raw: raw}
+
+	switch {
+	case raw == "":
+		return selector, Errorf(ErrorKindValidation, "empty VM selector")
+	case strings.HasPrefix(raw, "tag:"):
+		selector.Tag = strings.TrimPrefix(raw, "tag:")
+		if selector.Tag == "" {
+			return selector, Errorf(ErrorKindValidation, "empty tag in selector '%s'", raw)
+		}
+	case strings.ContainsAny(raw, "*?["):
+		if _, err := path.Match(raw, ""); err != nil {
+			return selector, Errorf(ErrorKindValidation, "invalid pattern '%s': %w", raw, err)
+		}
+		selector.Pattern = raw
+	case vmidRangePattern.MatchString(raw):
+		bounds := vmidRangePattern.FindStringSubmatch(raw)
+		selector.Min, _ = strconv.Atoi(bounds[1])
+		selector.Max, _ = strconv.Atoi(bounds[2])
+		if selector.Min <= 0 || selector.Max < selector.Min {
+			return selector, Errorf(ErrorKindValidation, "invalid vmid range '%s'", raw)
+		}
+	default:
+		if id, err := strconv.Atoi(raw); err == nil {
+			if id <= 0 {
+				return selector, Errorf(ErrorKindValidation, "invalid vmid '%s'", raw)
+			}
+			selector.ID = id
+		} else {
+			selector.Name = raw
+		}
+	}
+
+	return selector, nil
+}
+
+// IsExact reports whether the selector designates a single VM by ID or name.
+func (s VMSelector) IsExact() bool {
+	return s.ID != 0 || s.Name != ""
+}
+
+// IsRange reports whether the selector designates a VMID range.
+func (s VMSelector) IsRange() bool {
+	return s.Max != 0
+}
+
+func (s VMSelector) Matches(vm *VM) bool {
+	switch {
+	case s.ID != 0:
+		return vm.ID == s.ID
+	case s.Max != 0:
+		return vm.ID >= s.Min && vm.ID <= s.Max
+	case s.Name != "":
+		return vm.Name == s.Name
+	case s.Pattern != "":
+		ok, _ := path.Match(s.Pattern, vm.Name)
+		return ok
+	case s.Tag != "":
+		return vm.HasTag(s.Tag)
+	}
+	return false
+}
+
+func (s VMSelector) String() string {
+	return s.Raw
+}
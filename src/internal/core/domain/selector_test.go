@@ -0,0 +1,58 @@
+package domain
+
+import "testing"
+
+func TestParseVMSelector(t *testing.T) {
+	web := NewVM("web-01", 100)
+	web.Tags = []string{"frontend", "Prod"}
+	db := NewVM("db-01", 200)
+
+	tests := []struct {
+		raw        string
+		exact      bool
+		matchesWeb bool
+		matchesDB  bool
+	}{
+		{raw: "100", exact: true, matchesWeb: true},
+		{raw: "db-01", exact: true, matchesDB: true},
+		{raw: "web-*", matchesWeb: true},
+		{raw: "*-01", matchesWeb: true, matchesDB: true},
+		{raw: "tag:prod", matchesWeb: true},
+		{raw: "tag:backend"},
+		{raw: "100-150", matchesWeb: true},
+		{raw: "100-200", matchesWeb: true, matchesDB: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.raw, func(t *testing.T) {
+			selector, err := ParseVMSelector(tt.raw)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if selector.IsExact() != tt.exact {
+				t.Errorf("Expected IsExact=%v, got %v", tt.exact, selector.IsExact())
+			}
+			if selector.Matches(web) != tt.matchesWeb {
+				t.Errorf("Expected match on web=%v", tt.matchesWeb)
+			}
+			if selector.Matches(db) != tt.matchesDB {
+				t.Errorf("Expected match on db=%v", tt.matchesDB)
+			}
+		})
+	}
+}
+
+func TestParseVMSelector_Invalid(t *testing.T) {
+	for _, raw := range []string{"", "tag:", "web-[", "-5", "0-10", "200-100"} {
+		if _, err := ParseVMSelector(raw); err == nil {
+			t.Errorf("Expected error for selector '%s'", raw)
+		}
+	}
+}
+
+func TestParseTags(t *testing.T) {
+	tags := ParseTags("prod;web,linux")
+	if len(tags) != 3 || tags[0] != "prod" || tags[1] != "web" || tags[2] != "linux" {
+		t.Errorf("Unexpected tags: %v", tags)
+	}
+}
@@ -0,0 +1,9 @@
+package domain
+
+// Setting is an effective setting of a VM of the config: its dotted key, such
+// as network.bridge, its value, and where in the config it comes from.
+type Setting struct {
+	Key    string
+	Value  string
+	Source string
+}
@@ -0,0 +1,116 @@
+package domain
+
+import (
+	"errors"
+	"time"
+)
+
+type TaskStatus string
+
+const (
+	TaskStatusOK      TaskStatus = "ok"
+	TaskStatusFailed  TaskStatus = "failed"
+	TaskStatusSkipped TaskStatus = "skipped"
+)
+
+// TaskResult records the outcome of one operation on one VM.
+type TaskResult struct {
+	VMID      int
+	Name      string
+	Action    string
+	Status    TaskStatus
+	Message   string
+	Err       error
+	StartTime time.Time
+	EndTime   time.Time
+}
+
+func NewTaskResult(vm *VM, action string) *TaskResult {
+	return &TaskResult{
+		VMID:      vm.ID,
+		Name:      vm.Name,
+		Action:    action,
+		StartTime: time.Now(),
+	}
+}
+
+// skipped is returned by tasks that had nothing to do.
+type skipped struct {
+	reason string
+}
+
+func (s *skipped) Error() string {
+	return s.reason
+}
+
+// Skipped returns the error a task returns to be recorded as skipped by Finish.
+func Skipped(reason string) error {
+	return &skipped{reason: reason}
+}
+
+// Finish marks the task as done, failed when err is not nil, or skipped when
+// err comes from Skipped.
+func (t *TaskResult) Finish(err error) {
+	var skip *skipped
+	if errors.As(err, &skip) {
+		t.Skip(skip.reason)
+		return
+	}
+
+	t.EndTime = time.Now()
+	if err != nil {
+		t.Status = TaskStatusFailed
+		t.Message = err.Error()
+		t.Err = err
+		return
+	}
+	t.Status = TaskStatusOK
+}
+
+func (t *TaskResult) Skip(reason string) {
+	t.EndTime = time.Now()
+	t.Status = TaskStatusSkipped
+	t.Message = reason
+}
+
+func (t *TaskResult) Duration() time.Duration {
+	if t.EndTime.IsZero() {
+		return time.Since(t.StartTime)
+	}
+	return t.EndTime.Sub(t.StartTime)
+}
+
+type PlanAction string
+
+const (
+	PlanActionCreate PlanAction = "create"
+	PlanActionKeep   PlanAction = "keep"
+	PlanActionDelete PlanAction = "delete"
+)
+
+// PlanStep is an action proxima intends to take on a VM.
+type PlanStep struct {
+	Action PlanAction
+	VM     *VM
+	Reason string
+}
+
+// Plan is what apply does to bring the cluster in line with a config.
+type Plan struct {
+	Steps []PlanStep
+}
+
+func (p *Plan) Add(action PlanAction, vm *VM, reason string) {
+	p.Steps = append(p.Steps, PlanStep{Action: action, VM: vm, Reason: reason})
+}
+
+// VMs returns the VMs of the steps with the given action, in plan order.
+func (p *Plan) VMs(action PlanAction) []*VM {
+	var vms []*VM
+	for _, step := range p.Steps {
+		if step.Action == action {
+			vms = append(vms, step.VM)
+		}
+	}
+	return vms
+}
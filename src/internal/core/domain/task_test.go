@@ -0,0 +1,33 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestTaskResult_Finish(t *testing.T) {
+	vm := NewVM("web", 100)
+
+	tests := []struct {
+		err     error
+		status  TaskStatus
+		message string
+	}{
+		{err: nil, status: TaskStatusOK},
+		{err: errors.New("VM is locked"), status: TaskStatusFailed, message: "VM is locked"},
+		{err: Skipped("already exists"), status: TaskStatusSkipped, message: "already exists"},
+		{err: fmt.Errorf("create: %w", Skipped("already exists")), status: TaskStatusSkipped, message: "already exists"},
+	}
+
+	for _, tt := range tests {
+		result := NewTaskResult(vm, "create")
+		result.Finish(tt.err)
+		if result.Status != tt.status || result.Message != tt.message {
+			t.Errorf("Expected %s '%s' for %v, got %s '%s'", tt.status, tt.message, tt.err, result.Status, result.Message)
+		}
+		if tt.status == TaskStatusSkipped && result.Err != nil {
+			t.Errorf("Expected no error on a skipped task, got %v", result.Err)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package domain
+
+import (
+	"slices"
+	"sort"
+	"strconv"
+)
+
+// TemplateEntry is a template of the cluster with the aliases of the config
+// that refer to it. An alias whose template does not exist on the cluster
+// makes an entry with no ID, recording the VMID or name it refers to as
+// Source.
+type TemplateEntry struct {
+	ID      int
+	Name    string
+	Aliases []string
+	Source  string
+}
+
+// Found reports whether the entry is a template of the cluster.
+func (e TemplateEntry) Found() bool {
+	return e.ID != 0
+}
+
+// MatchTemplates lists the templates among vms, by VMID, with the aliases
+// referring to them by VMID or name, then the aliases referring to no template,
+// by name. aliases maps each alias to the VMID or name it refers to.
+func MatchTemplates(vms []*VM, aliases map[string]string) []TemplateEntry {
+	var entries []TemplateEntry
+	matched := make(map[string]bool)
+	for _, vm := range vms {
+		if !vm.IsTemplate {
+			continue
+		}
+		entry := TemplateEntry{ID: vm.ID, Name: vm.Name}
+		for alias, source := range aliases {
+			if source == strconv.Itoa(vm.ID) || (source == vm.Name && vm.Name != "") {
+				entry.Aliases = append(entry.Aliases, alias)
+				matched[alias] = true
+			}
+		}
+		slices.Sort(entry.Aliases)
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].ID < entries[j].ID })
+
+	var missing []string
+	for alias := range aliases {
+		if !matched[alias] {
+			missing = append(missing, alias)
+		}
+	}
+	slices.Sort(missing)
+	for _, alias := range missing {
+		entries = append(entries, TemplateEntry{Aliases: []string{alias}, Source: aliases[alias]})
+	}
+	return entries
+}
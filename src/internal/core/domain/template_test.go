@@ -0,0 +1,36 @@
+package domain
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMatchTemplates(t *testing.T) {
+	ubuntu := NewVM("ubuntu-24.04", 9000)
+	ubuntu.IsTemplate = true
+	debian := NewVM("debian-12", 9001)
+	debian.IsTemplate = true
+	web := NewVM("web", 100)
+
+	entries := MatchTemplates([]*VM{web, debian, ubuntu}, map[string]string{
+		"ubuntu":  "9000",
+		"lts":     "ubuntu-24.04",
+		"centos":  "9002",
+		"web":     "100",
+		"archive": "old-template",
+	})
+
+	expected := []TemplateEntry{
+		{ID: 9000, Name: "ubuntu-24.04", Aliases: []string{"lts", "ubuntu"}},
+		{ID: 9001, Name: "debian-12"},
+		{Aliases: []string{"archive"}, Source: "old-template"},
+		{Aliases: []string{"centos"}, Source: "9002"},
+		{Aliases: []string{"web"}, Source: "100"},
+	}
+	if !reflect.DeepEqual(entries, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, entries)
+	}
+	if !entries[0].Found() || entries[2].Found() {
+		t.Errorf("Expected only cluster templates to be found")
+	}
+}
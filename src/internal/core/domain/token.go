@@ -0,0 +1,48 @@
+package domain
+
+import "strings"
+
+// APIToken is a Proxmox API token of a user, identified as USER@REALM!NAME.
+// A privilege-separated token only has the permissions granted to it, not
+// those of its user.
+type APIToken struct {
+	User    string
+	Name    string
+	Secret  string
+	Comment string
+	PrivSep bool
+}
+
+// ParseAPIToken reads a token in the form Proxmox expects in its
+// Authorization header: USER@REALM!NAME=SECRET.
+func ParseAPIToken(value string) (APIToken, error) {
+	id, secret, _ := strings.Cut(value, "=")
+	token, err := ParseAPITokenID(id)
+	if err != nil {
+		return APIToken{}, err
+	}
+	if secret == "" {
+		return APIToken{}, Errorf(ErrorKindValidation, "API token %s has no secret (expected USER@REALM!NAME=SECRET)", id)
+	}
+	token.Secret = secret
+	return token, nil
+}
+
+// ParseAPITokenID reads a token ID: USER@REALM!NAME.
+func ParseAPITokenID(id string) (APIToken, error) {
+	user, name, ok := strings.Cut(id, "!")
+	if !ok || name == "" || !strings.Contains(user, "@") {
+		return APIToken{}, Errorf(ErrorKindValidation, "invalid API token ID '%s' (expected USER@REALM!NAME)", id)
+	}
+	return APIToken{User: user, Name: name}, nil
+}
+
+// ID returns the full token ID, USER@REALM!NAME.
+func (t APIToken) ID() string {
+	return t.User + "!" + t.Name
+}
+
+// Credential returns the value of the PVEAPIToken authorization.
+func (t APIToken) Credential() string {
+	return t.ID() + "=" + t.Secret
+}
@@ -0,0 +1,25 @@
+package domain
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseAPIToken(t *testing.T) {
+	token, err := ParseAPIToken("proxima@pve!ci=0e8a6d42-1c7b-4b8e-a6f6-2d5c3f1b9e70")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if token.User != "proxima@pve" || token.Name != "ci" || token.Secret != "0e8a6d42-1c7b-4b8e-a6f6-2d5c3f1b9e70" {
+		t.Errorf("Expected proxima@pve, ci and the secret, got %+v", token)
+	}
+	if token.Credential() != "proxima@pve!ci=0e8a6d42-1c7b-4b8e-a6f6-2d5c3f1b9e70" {
+		t.Errorf("Expected the credential to round-trip, got '%s'", token.Credential())
+	}
+
+	for _, value := range []string{"", "proxima@pve!ci", "proxima@pve!ci=", "proxima@pve=secret", "proxima!ci=secret", "proxima@pve!=secret"} {
+		if _, err := ParseAPIToken(value); !errors.Is(err, ErrValidation) {
+			t.Errorf("Expected a validation error for '%s', got %v", value, err)
+		}
+	}
+}
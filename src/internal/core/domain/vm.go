@@ -1,22 +1,40 @@
 package domain
 
-import "time"
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
 
 type VM struct {
-	ID        int
-	Name      string
-	Status    VMStatus
-	Cores     int
-	Memory    int
-	DiskSize  string
-	Network   Network
-	Template  string
-	Tags      []string
-	AutoStart bool
-	SSH       SSHConfig
-	Scripts   []Script
-	CreatedAt time.Time
-	UpdatedAt time.Time
+	ID           int
+	IDRange      VMIDRange
+	Name         string
+	Node         string
+	Status       VMStatus
+	Uptime       time.Duration
+	Cores        int
+	Memory       int
+	DiskSize     string
+	IP           string
+	Network      Network
+	Template     string
+	Storage      string
+	OSType       string
+	CIUser       string
+	Tags         []string
+	AutoStart    bool
+	Protected    bool
+	IsTemplate   bool
+	StartOrder   int
+	DependsOn    []string
+	BootOrder    int
+	StartupDelay time.Duration
+	SSH          SSHConfig
+	Scripts      []Script
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
 }
 
 type VMStatus string
@@ -28,14 +46,65 @@ const (
 	VMStatusCreating VMStatus = "creating"
 	VMStatusDeleting VMStatus = "deleting"
 	VMStatusError    VMStatus = "error"
+	// VMStatusPaused is a VM whose vCPUs are halted in memory (suspend).
+	VMStatusPaused VMStatus = "paused"
+	// VMStatusSuspended is a VM whose state was saved to disk (hibernate).
+	VMStatusSuspended VMStatus = "suspended"
+	VMStatusUnknown   VMStatus = "unknown"
 )
 
+// ParseVMStatus maps the state reported by Proxmox to a VMStatus. status is
+// the process state (running or stopped), qmpStatus the QEMU state of a
+// running VM, and lock the config lock, which is "suspended" while the VM is
+// hibernated. Empty qmpStatus or lock are ignored.
+func ParseVMStatus(status, qmpStatus, lock string) VMStatus {
+	if lock == "suspended" {
+		return VMStatusSuspended
+	}
+
+	switch status {
+	case "stopped":
+		return VMStatusStopped
+	case "running":
+		switch qmpStatus {
+		case "paused", "suspended":
+			return VMStatusPaused
+		case "prelaunch", "inmigrate":
+			return VMStatusStarting
+		}
+		return VMStatusRunning
+	}
+
+	return VMStatusUnknown
+}
+
+// VMIDRange bounds the VMID allocated for a VM created without a fixed ID.
+// A zero range means any free ID.
+type VMIDRange struct {
+	Min int
+	Max int
+}
+
+func (r VMIDRange) IsZero() bool {
+	return r.Min == 0 && r.Max == 0
+}
+
+func (r VMIDRange) Contains(id int) bool {
+	return r.IsZero() || (id >= r.Min && id <= r.Max)
+}
+
 type Network struct {
 	Bridge string
 	VLAN   int
 	Model  string
 }
 
+// NetworkModels are the NIC models Proxmox emulates.
+var NetworkModels = []string{"virtio", "e1000", "e1000e", "rtl8139", "vmxnet3", "i82551", "i82557b", "i82559er", "ne2k_isa", "ne2k_pci", "pcnet"}
+
+// OSTypes are the guest OS types Proxmox knows.
+var OSTypes = []string{"other", "wxp", "w2k", "w2k3", "w2k8", "wvista", "win7", "win8", "win10", "win11", "l24", "l26", "solaris"}
+
 type SSHConfig struct {
 	User           string
 	Password       string
@@ -61,6 +130,121 @@ func NewVM(name string, vmid int) *VM {
 	}
 }
 
+func (vm *VM) HasTag(tag string) bool {
+	for _, t := range vm.Tags {
+		if strings.EqualFold(t, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// Label returns a human readable reference to the VM, including its name when known.
+func (vm *VM) Label() string {
+	switch {
+	case vm.Name == "":
+		return strconv.Itoa(vm.ID)
+	case vm.ID == 0:
+		return vm.Name
+	}
+	return fmt.Sprintf("%s (%d)", vm.Name, vm.ID)
+}
+
+// Startup returns the Proxmox startup property of the VM ("order=1,up=30"), or
+// "" when it has neither a boot order nor a startup delay.
+func (vm *VM) Startup() string {
+	var parts []string
+	if vm.BootOrder > 0 {
+		parts = append(parts, fmt.Sprintf("order=%d", vm.BootOrder))
+	}
+	if vm.StartupDelay > 0 {
+		parts = append(parts, fmt.Sprintf("up=%d", int(vm.StartupDelay.Seconds())))
+	}
+	return strings.Join(parts, ",")
+}
+
+// FormatDiskSize renders a byte count the way Proxmox writes disk sizes (e.g. "32G").
+func FormatDiskSize(bytes int64) string {
+	units := []struct {
+		suffix string
+		size   int64
+	}{
+		{"T", 1 << 40},
+		{"G", 1 << 30},
+		{"M", 1 << 20},
+		{"K", 1 << 10},
+	}
+
+	for _, unit := range units {
+		if bytes >= unit.size {
+			if bytes%unit.size == 0 {
+				return fmt.Sprintf("%d%s", bytes/unit.size, unit.suffix)
+			}
+			return fmt.Sprintf("%.1f%s", float64(bytes)/float64(unit.size), unit.suffix)
+		}
+	}
+	return strconv.FormatInt(bytes, 10)
+}
+
+// ParseDiskSize reads a disk size the way Proxmox writes them ("32G", "512M",
+// "1.5T" or a byte count) and returns it in bytes.
+func ParseDiskSize(size string) (int64, error) {
+	number, multiplier := strings.TrimSpace(size), 1.0
+	units := map[string]float64{"K": 1 << 10, "M": 1 << 20, "G": 1 << 30, "T": 1 << 40}
+	if n := len(number); n > 0 {
+		if unit, ok := units[strings.ToUpper(number[n-1:])]; ok {
+			number, multiplier = number[:n-1], unit
+		}
+	}
+
+	value, err := strconv.ParseFloat(number, 64)
+	if err != nil || value < 0 {
+		return 0, Errorf(ErrorKindValidation, "invalid disk size '%s' (expected e.g. 32G)", size)
+	}
+	return int64(value * multiplier), nil
+}
+
+// BootDisk finds the disk a VM boots from in its Proxmox config: the first
+// disk of the boot order, the legacy bootdisk, or else the first of scsi0,
+// virtio0, sata0 and ide0. CD-ROM drives are ignored. It returns the name of
+// the disk and its size in bytes.
+func BootDisk(config map[string]string) (string, int64, bool) {
+	var candidates []string
+	if order, ok := strings.CutPrefix(config["boot"], "order="); ok {
+		candidates = strings.Split(order, ";")
+	}
+	if config["bootdisk"] != "" {
+		candidates = append(candidates, config["bootdisk"])
+	}
+	candidates = append(candidates, "scsi0", "virtio0", "sata0", "ide0")
+
+	for _, name := range candidates {
+		_, options, _ := strings.Cut(config[name], ",")
+		var size int64
+		cdrom := false
+		for _, option := range strings.Split(options, ",") {
+			key, value, _ := strings.Cut(option, "=")
+			switch key {
+			case "media":
+				cdrom = value == "cdrom"
+			case "size":
+				size, _ = ParseDiskSize(value)
+			}
+		}
+		if size > 0 && !cdrom {
+			return name, size, true
+		}
+	}
+	return "", 0, false
+}
+
+// ParseTags splits a Proxmox tag list, which uses ';' (and historically ',' or spaces) as separators.
+func ParseTags(value string) []string {
+	return strings.FieldsFunc(value, func(r rune) bool {
+		return r == ';' || r == ',' || r == ' '
+	})
+}
+
 func (vm *VM) Start() {
 	vm.Status = VMStatusRunning
 	vm.UpdatedAt = time.Now()
@@ -81,6 +81,114 @@ func TestVM_Delete(t *testing.T) {
 	}
 }
 
+func TestParseVMStatus(t *testing.T) {
+	tests := []struct {
+		status    string
+		qmpStatus string
+		lock      string
+		expected  VMStatus
+	}{
+		{"running", "running", "", VMStatusRunning},
+		{"running", "", "", VMStatusRunning},
+		{"running", "paused", "", VMStatusPaused},
+		{"running", "suspended", "", VMStatusPaused},
+		{"running", "prelaunch", "", VMStatusStarting},
+		{"stopped", "", "", VMStatusStopped},
+		{"stopped", "", "suspended", VMStatusSuspended},
+		{"stopped", "", "backup", VMStatusStopped},
+		{"", "", "", VMStatusUnknown},
+	}
+
+	for _, tt := range tests {
+		if got := ParseVMStatus(tt.status, tt.qmpStatus, tt.lock); got != tt.expected {
+			t.Errorf("Expected %s for status=%q qmpstatus=%q lock=%q, got %s", tt.expected, tt.status, tt.qmpStatus, tt.lock, got)
+		}
+	}
+}
+
+func TestVM_Startup(t *testing.T) {
+	vm := NewVM("db", 100)
+	if vm.Startup() != "" {
+		t.Errorf("Expected no startup property, got '%s'", vm.Startup())
+	}
+
+	vm.BootOrder = 1
+	vm.StartupDelay = 30 * time.Second
+	if vm.Startup() != "order=1,up=30" {
+		t.Errorf("Expected 'order=1,up=30', got '%s'", vm.Startup())
+	}
+}
+
+func TestParseDiskSize(t *testing.T) {
+	tests := []struct {
+		size     string
+		expected int64
+	}{
+		{"32G", 32 << 30},
+		{"512M", 512 << 20},
+		{"1.5T", 3 << 39},
+		{"20g", 20 << 30},
+		{"4096", 4096},
+	}
+
+	for _, tt := range tests {
+		if got, err := ParseDiskSize(tt.size); err != nil || got != tt.expected {
+			t.Errorf("Expected %d for '%s', got %d, %v", tt.expected, tt.size, got, err)
+		}
+	}
+
+	for _, size := range []string{"", "G", "big", "-1G"} {
+		if _, err := ParseDiskSize(size); err == nil {
+			t.Errorf("Expected an error for '%s'", size)
+		}
+	}
+}
+
+func TestBootDisk(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   map[string]string
+		disk     string
+		size     int64
+		expected bool
+	}{
+		{
+			name:     "boot order",
+			config:   map[string]string{"boot": "order=ide2;virtio0;net0", "ide2": "local:iso/debian.iso,media=cdrom,size=600M", "virtio0": "local-lvm:base-9000-disk-0,size=8G", "scsi0": "local-lvm:base-9000-disk-1,size=2G"},
+			disk:     "virtio0",
+			size:     8 << 30,
+			expected: true,
+		},
+		{
+			name:     "legacy bootdisk",
+			config:   map[string]string{"bootdisk": "sata0", "sata0": "local-lvm:base-9000-disk-0,size=10G"},
+			disk:     "sata0",
+			size:     10 << 30,
+			expected: true,
+		},
+		{
+			name:     "first disk",
+			config:   map[string]string{"scsi0": "local-lvm:base-9000-disk-0,cache=writeback,size=2252M"},
+			disk:     "scsi0",
+			size:     2252 << 20,
+			expected: true,
+		},
+		{
+			name:   "cdrom only",
+			config: map[string]string{"ide0": "none,media=cdrom"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			disk, size, ok := BootDisk(tt.config)
+			if ok != tt.expected || disk != tt.disk || size != tt.size {
+				t.Errorf("Expected %s of %d bytes (%v), got %s of %d bytes (%v)", tt.disk, tt.size, tt.expected, disk, size, ok)
+			}
+		})
+	}
+}
+
 func TestNewCommand(t *testing.T) {
 	vmid := 100
 	command := "ls"
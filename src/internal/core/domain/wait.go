@@ -0,0 +1,38 @@
+package domain
+
+import "time"
+
+type WaitOptions struct {
+	Timeout     time.Duration
+	Interval    time.Duration
+	MaxInterval time.Duration
+	Backoff     float64
+}
+
+func DefaultWaitOptions() WaitOptions {
+	return WaitOptions{
+		Timeout:     5 * time.Minute,
+		Interval:    1 * time.Second,
+		MaxInterval: 10 * time.Second,
+		Backoff:     1.5,
+	}
+}
+
+// WithTimeout returns a copy of the options with a different timeout.
+func (o WaitOptions) WithTimeout(timeout time.Duration) WaitOptions {
+	o.Timeout = timeout
+	return o
+}
+
+// NextInterval returns the delay to use after the given one, applying the
+// backoff factor and capping it at MaxInterval.
+func (o WaitOptions) NextInterval(current time.Duration) time.Duration {
+	if o.Backoff <= 1 {
+		return current
+	}
+	next := time.Duration(float64(current) * o.Backoff)
+	if o.MaxInterval > 0 && next > o.MaxInterval {
+		return o.MaxInterval
+	}
+	return next
+}
@@ -3,21 +3,59 @@ package ports
 import "proxima/internal/core/domain"
 
 type VMRepository interface {
-	Create(vm *domain.VM) error
+	Create(vm *domain.VM, progress domain.ProgressFunc) error
 	GetByID(id int) (*domain.VM, error)
 	GetByName(name string) (*domain.VM, error)
 	Update(vm *domain.VM) error
-	Delete(id int) error
+	Delete(id int, purge bool) error
 	List() ([]*domain.VM, error)
+	NextID(idRange domain.VMIDRange) (int, error)
 	Start(id int) error
 	Stop(id int) error
 	Shutdown(id int) error
+	Reboot(id int) error
+	Reset(id int) error
+	Suspend(id int) error
+	Resume(id int) error
+	Hibernate(id int) error
 	GetStatus(id int) (domain.VMStatus, error)
+	GetVMIP(id int) (string, error)
+	GetNetworkInterfaces(id int) ([]domain.NetworkInterface, error)
+	PingAgent(id int) error
 }
 
 type SSHRepository interface {
 	ExecuteCommand(vmid int, command string, args []string, timeout int) (*domain.Command, error)
 	ExecuteScript(vmid int, scriptPath string, args []string, timeout int) (*domain.Command, error)
 	GetCommandHistory(vmid int) ([]*domain.Command, error)
+	CheckConnection(vmid int) error
 	CopyLocalPublicKey(vmid int) error
+	LocalPublicKeys() ([]string, error)
+	InstallAuthorizedKeys(vmid int, user string, keys []string) (int, error)
+	RemoveAuthorizedKeys(vmid int, user string, keys []string) (int, error)
+}
+
+type StateRepository interface {
+	GetVMID(name string) (int, bool)
+	SetVMID(name string, id int) error
+}
+
+// CommandPlanner is implemented by VM repositories that can tell which API
+// calls or qm commands a mutating operation would run, without running them.
+// Dry runs rely on it.
+type CommandPlanner interface {
+	PlanCreate(vm *domain.VM) ([]string, error)
+	PlanDelete(id int, purge bool) ([]string, error)
+	// PlanPower covers the power actions: start, stop, shutdown, reboot,
+	// reset, suspend, resume and hibernate.
+	PlanPower(id int, action string) ([]string, error)
+}
+
+// AccessRepository manages the API tokens of Proxmox users and their
+// permissions.
+type AccessRepository interface {
+	// CreateToken creates token and sets its secret, which Proxmox only
+	// reveals at creation.
+	CreateToken(token *domain.APIToken) error
+	GrantRole(path, role, tokenID string) error
 }
@@ -3,16 +3,33 @@ package ports
 import "proxima/internal/core/domain"
 
 type VMService interface {
-	CreateVM(vm *domain.VM) error
+	CreateVM(vm *domain.VM, progress domain.ProgressFunc) error
+	AssignVMID(vm *domain.VM) error
+	PlanApply(vms []*domain.VM, groups []domain.VMGroup) (*domain.Plan, error)
 	StartVM(id int) error
 	StopVM(id int) error
 	ShutdownVM(id int) error
-	DeleteVM(id int) error
+	RebootVM(id int) error
+	ResetVM(id int) error
+	SuspendVM(id int) error
+	ResumeVM(id int) error
+	HibernateVM(id int) error
+	DeleteVM(id int, opts domain.DeleteOptions) error
 	GetVM(id int) (*domain.VM, error)
+	WaitForStatus(id int, status domain.VMStatus, opts domain.WaitOptions) error
+	WaitForAgent(id int, opts domain.WaitOptions) error
+	WaitForIP(id int, opts domain.WaitOptions) (string, error)
+	WaitForSSH(id int, opts domain.WaitOptions) error
 	ListVMs() ([]*domain.VM, error)
+	ResolveVMs(selectors []string, all bool) ([]*domain.VM, error)
+	RunParallel(vms []*domain.VM, action string, workers int, fn func(vm *domain.VM) error) []*domain.TaskResult
+	GetVMIP(id int) (string, error)
+	GetVMInterfaces(id int) ([]domain.NetworkInterface, error)
 	ExecuteScriptOnVM(vmid int, script *domain.Script) (*domain.Command, error)
 	ExecuteCommandOnVM(vmid int, command string, args []string, timeout int) (*domain.Command, error)
 	CopySSHKey(vmid int) error
+	InstallSSHKeys(vmid int, sshConfig domain.SSHConfig) (int, error)
+	RemoveSSHKeys(vmid int, sshConfig domain.SSHConfig) (int, error)
 }
 
 type ConfigService interface {
@@ -20,3 +37,7 @@ type ConfigService interface {
 	GetVMConfig(name string) (*domain.VM, error)
 	GetAllVMConfigs() ([]*domain.VM, error)
 }
+
+type AccessService interface {
+	CreateAPIToken(token *domain.APIToken, role string) error
+}
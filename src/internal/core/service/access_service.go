@@ -0,0 +1,33 @@
+package service
+
+import (
+	"fmt"
+
+	"proxima/internal/core/domain"
+	"proxima/internal/core/ports"
+)
+
+type AccessService struct {
+	accessRepo ports.AccessRepository
+}
+
+func NewAccessService(accessRepo ports.AccessRepository) ports.AccessService {
+	return &AccessService{accessRepo: accessRepo}
+}
+
+// CreateAPIToken creates token and sets its secret. A privilege-separated
+// token starts without any permission, so it is granted role on the whole
+// cluster (/). When that fails, the token exists and its secret is set anyway.
+func (s *AccessService) CreateAPIToken(token *domain.APIToken, role string) error {
+	if err := s.accessRepo.CreateToken(token); err != nil {
+		return fmt.Errorf("failed to create API token %s: %w", token.ID(), err)
+	}
+
+	if !token.PrivSep || role == "" {
+		return nil
+	}
+	if err := s.accessRepo.GrantRole("/", role, token.ID()); err != nil {
+		return fmt.Errorf("API token %s created but role %s could not be granted to it: %w", token.ID(), role, err)
+	}
+	return nil
+}
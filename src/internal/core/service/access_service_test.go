@@ -0,0 +1,69 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"proxima/internal/core/domain"
+)
+
+type fakeAccessRepository struct {
+	calls    []string
+	grantErr error
+}
+
+func (r *fakeAccessRepository) CreateToken(token *domain.APIToken) error {
+	r.calls = append(r.calls, fmt.Sprintf("create %s privsep=%v", token.ID(), token.PrivSep))
+	token.Secret = "0e8a6d42-1c7b-4b8e-a6f6-2d5c3f1b9e70"
+	return nil
+}
+
+func (r *fakeAccessRepository) GrantRole(path, role, tokenID string) error {
+	r.calls = append(r.calls, fmt.Sprintf("grant %s on %s to %s", role, path, tokenID))
+	return r.grantErr
+}
+
+func TestAccessService_CreateAPIToken(t *testing.T) {
+	tests := []struct {
+		name     string
+		privSep  bool
+		grantErr error
+		expected []string
+	}{
+		{
+			name:     "privilege-separated",
+			privSep:  true,
+			expected: []string{"create proxima@pve!ci privsep=true", "grant PVEVMAdmin on / to proxima@pve!ci"},
+		},
+		{
+			name:     "with the permissions of the user",
+			expected: []string{"create proxima@pve!ci privsep=false"},
+		},
+		{
+			name:     "grant refused",
+			privSep:  true,
+			grantErr: domain.Errorf(domain.ErrorKindAuth, "permission check failed"),
+			expected: []string{"create proxima@pve!ci privsep=true", "grant PVEVMAdmin on / to proxima@pve!ci"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &fakeAccessRepository{grantErr: tt.grantErr}
+			token := &domain.APIToken{User: "proxima@pve", Name: "ci", PrivSep: tt.privSep}
+
+			err := NewAccessService(repo).CreateAPIToken(token, "PVEVMAdmin")
+			if !errors.Is(err, tt.grantErr) || (tt.grantErr == nil && err != nil) {
+				t.Errorf("Expected error %v, got %v", tt.grantErr, err)
+			}
+			if token.Secret == "" {
+				t.Error("Expected the secret of the created token to be set")
+			}
+			if !reflect.DeepEqual(repo.calls, tt.expected) {
+				t.Errorf("Expected calls %v, got %v", tt.expected, repo.calls)
+			}
+		})
+	}
+}
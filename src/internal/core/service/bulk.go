@@ -0,0 +1,43 @@
+package service
+
+import (
+	"sync"
+
+	"proxima/internal/core/domain"
+)
+
+// RunParallel runs fn on every VM through a pool of at most workers
+// goroutines and returns one result per VM, in the order of vms. A worker
+// count below 1 runs the VMs one at a time.
+func (s *VMService) RunParallel(vms []*domain.VM, action string, workers int, fn func(vm *domain.VM) error) []*domain.TaskResult {
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > len(vms) {
+		workers = len(vms)
+	}
+
+	results := make([]*domain.TaskResult, len(vms))
+	jobs := make(chan int)
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				result := domain.NewTaskResult(vms[i], action)
+				result.Finish(fn(vms[i]))
+				results[i] = result
+			}
+		}()
+	}
+
+	for i := range vms {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	return results
+}
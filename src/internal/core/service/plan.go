@@ -0,0 +1,102 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+
+	"proxima/internal/core/domain"
+)
+
+// PlanApply decides what apply does with the VMs of a config: those missing
+// from the cluster are created and the others kept, and the instances of
+// groups beyond their count are deleted. The VMs of the config get their
+// VMIDs first, so the plan and their dependencies refer to real IDs. A VM
+// declared without a VMID exists when a VM of the cluster has its name.
+func (s *VMService) PlanApply(vms []*domain.VM, groups []domain.VMGroup) (*domain.Plan, error) {
+	existing, err := s.ListVMs()
+	if err != nil {
+		return nil, err
+	}
+	exists := make(map[int]bool)
+	for _, vm := range existing {
+		exists[vm.ID] = true
+	}
+
+	plan := &domain.Plan{}
+	for _, vm := range vms {
+		if err := s.adopt(vm, existing); err != nil {
+			return nil, err
+		}
+		if err := s.AssignVMID(vm); err != nil {
+			return nil, err
+		}
+		if exists[vm.ID] {
+			plan.Add(domain.PlanActionKeep, vm, "already exists")
+		} else {
+			plan.Add(domain.PlanActionCreate, vm, "")
+		}
+	}
+
+	for _, group := range groups {
+		for _, vm := range group.Surplus(existing, s.recordedVMID) {
+			plan.Add(domain.PlanActionDelete, vm, fmt.Sprintf("beyond the count of %s (%d)", group.Name, group.Count))
+		}
+	}
+	return plan, nil
+}
+
+// recordedVMID returns the VMID recorded in the state for the VM called name.
+func (s *VMService) recordedVMID(name string) (int, bool) {
+	if s.stateRepo == nil {
+		return 0, false
+	}
+	return s.stateRepo.GetVMID(name)
+}
+
+// adopt gives a VM declared without a VMID the ID of the VM of the cluster
+// with its name, in its range, and records it in the state. A checkout
+// without the state file, such as a teammate's, thus finds the VMs created
+// from another one instead of creating them again.
+func (s *VMService) adopt(vm *domain.VM, existing []*domain.VM) error {
+	if vm.ID != 0 {
+		return nil
+	}
+
+	var matches []*domain.VM
+	for _, other := range existing {
+		if other.Name == vm.Name && !other.IsTemplate && vm.IDRange.Contains(other.ID) {
+			matches = append(matches, other)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return nil
+	case 1:
+	default:
+		labels := make([]string, len(matches))
+		for i, match := range matches {
+			labels[i] = match.Label()
+		}
+		return domain.Errorf(domain.ErrorKindConflict, "several VMs are named %s (%s); set the vmid of the one in the config", vm.Name, strings.Join(labels, ", "))
+	}
+
+	id := matches[0].ID
+	s.mu.Lock()
+	owner, reserved := s.reserved[id]
+	if reserved && owner != vm.Name {
+		s.mu.Unlock()
+		return nil
+	}
+	s.reserved[id] = vm.Name
+	s.mu.Unlock()
+
+	vm.ID = id
+	if s.stateRepo != nil {
+		if recorded, ok := s.recordedVMID(vm.Name); !ok || recorded != id {
+			if err := s.stateRepo.SetVMID(vm.Name, id); err != nil {
+				return fmt.Errorf("failed to record VMID %d of %s: %w", id, vm.Name, err)
+			}
+		}
+	}
+	return nil
+}
@@ -4,33 +4,121 @@ import (
 	"fmt"
 	"proxima/internal/core/domain"
 	"proxima/internal/core/ports"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 )
 
 type VMService struct {
-	vmRepo  ports.VMRepository
-	sshRepo ports.SSHRepository
+	vmRepo    ports.VMRepository
+	sshRepo   ports.SSHRepository
+	stateRepo ports.StateRepository
+
+	// reserved maps the IDs assigned to VMs that may not exist yet to their
+	// names, so VMs created in parallel never get the same ID
+	reserved map[int]string
+	mu       sync.Mutex
 }
 
 func NewVMService(vmRepo ports.VMRepository, sshRepo ports.SSHRepository) ports.VMService {
+	return NewVMServiceWithState(vmRepo, sshRepo, nil)
+}
+
+func NewVMServiceWithState(vmRepo ports.VMRepository, sshRepo ports.SSHRepository, stateRepo ports.StateRepository) ports.VMService {
 	return &VMService{
-		vmRepo:  vmRepo,
-		sshRepo: sshRepo,
+		vmRepo:    vmRepo,
+		sshRepo:   sshRepo,
+		stateRepo: stateRepo,
+		reserved:  make(map[int]string),
 	}
 }
 
-func (s *VMService) CreateVM(vm *domain.VM) error {
-	if err := s.vmRepo.Create(vm); err != nil {
+// CreateVM creates vm, assigning it a VMID when it has none, and starts it
+// when AutoStart is set. The ID is recorded in the state when this service
+// assigned it, here or by an earlier AssignVMID. Each phase of the creation is
+// reported to progress, which may be nil.
+func (s *VMService) CreateVM(vm *domain.VM, progress domain.ProgressFunc) error {
+	if err := s.AssignVMID(vm); err != nil {
+		return err
+	}
+
+	if err := s.vmRepo.Create(vm, progress); err != nil {
 		return fmt.Errorf("failed to create VM: %w", err)
 	}
 
+	if s.assigned(vm) && s.stateRepo != nil {
+		if err := s.stateRepo.SetVMID(vm.Name, vm.ID); err != nil {
+			return fmt.Errorf("VM %d created but its ID could not be recorded: %w", vm.ID, err)
+		}
+	}
+
 	if vm.AutoStart {
+		progress.Report(vm, domain.PhaseStarting)
 		return s.StartVM(vm.ID)
 	}
 
 	return nil
 }
 
+// AssignVMID sets the ID of a VM declared without one. The ID recorded for its
+// name in the state is reused unless another VM took it meanwhile; otherwise
+// the next free ID in the VM's range is requested from the cluster. IDs
+// assigned earlier by this service are never handed out twice.
+func (s *VMService) AssignVMID(vm *domain.VM) error {
+	if vm.ID != 0 {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.stateRepo != nil {
+		id, ok := s.stateRepo.GetVMID(vm.Name)
+		owner, reserved := s.reserved[id]
+		if ok && vm.IDRange.Contains(id) && (!reserved || owner == vm.Name) {
+			existing, err := s.vmRepo.GetByID(id)
+			if err != nil || existing.Name == "" || existing.Name == vm.Name {
+				s.reserved[id] = vm.Name
+				vm.ID = id
+				return nil
+			}
+		}
+	}
+
+	idRange := vm.IDRange
+	for {
+		id, err := s.vmRepo.NextID(idRange)
+		if err != nil {
+			return fmt.Errorf("failed to allocate VMID for '%s': %w", vm.Name, err)
+		}
+		if _, taken := s.reserved[id]; !taken {
+			s.reserved[id] = vm.Name
+			vm.ID = id
+			return nil
+		}
+
+		// The cluster still sees the reserved ID as free until its VM is created
+		max := idRange.Max
+		if idRange.IsZero() {
+			max = 999999999
+		}
+		if id >= max {
+			return domain.Errorf(domain.ErrorKindConflict, "no free VMID in range %d-%d for '%s'", idRange.Min, idRange.Max, vm.Name)
+		}
+		idRange = domain.VMIDRange{Min: id + 1, Max: max}
+	}
+}
+
+// assigned reports whether AssignVMID gave vm its ID, rather than the config.
+func (s *VMService) assigned(vm *domain.VM) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	owner, ok := s.reserved[vm.ID]
+	return ok && owner == vm.Name
+}
+
 func (s *VMService) StartVM(id int) error {
 	if err := s.vmRepo.Start(id); err != nil {
 		return fmt.Errorf("failed to start VM %d: %w", id, err)
@@ -46,6 +134,63 @@ func (s *VMService) StopVM(id int) error {
 }
 
 func (s *VMService) ShutdownVM(id int) error {
+	return s.shutdown(id, 60*time.Second)
+}
+
+func (s *VMService) RebootVM(id int) error {
+	if err := s.vmRepo.Reboot(id); err != nil {
+		return fmt.Errorf("failed to reboot VM %d: %w", id, err)
+	}
+	return nil
+}
+
+func (s *VMService) ResetVM(id int) error {
+	if err := s.vmRepo.Reset(id); err != nil {
+		return fmt.Errorf("failed to reset VM %d: %w", id, err)
+	}
+	return nil
+}
+
+// SuspendVM pauses a VM in memory.
+func (s *VMService) SuspendVM(id int) error {
+	if err := s.vmRepo.Suspend(id); err != nil {
+		return fmt.Errorf("failed to suspend VM %d: %w", id, err)
+	}
+	return nil
+}
+
+// ResumeVM resumes a paused VM. A hibernated VM has no running process to
+// resume: Proxmox restores its saved state when it is started.
+func (s *VMService) ResumeVM(id int) error {
+	status, err := s.vmRepo.GetStatus(id)
+	if err != nil {
+		return fmt.Errorf("failed to get VM %d status: %w", id, err)
+	}
+
+	switch status {
+	case domain.VMStatusSuspended:
+		err = s.vmRepo.Start(id)
+	case domain.VMStatusPaused:
+		err = s.vmRepo.Resume(id)
+	default:
+		return domain.Errorf(domain.ErrorKindConflict, "VM %d is %s, not paused or suspended", id, status)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to resume VM %d: %w", id, err)
+	}
+	return nil
+}
+
+// HibernateVM saves the VM state to disk and stops it.
+func (s *VMService) HibernateVM(id int) error {
+	if err := s.vmRepo.Hibernate(id); err != nil {
+		return fmt.Errorf("failed to hibernate VM %d: %w", id, err)
+	}
+	return nil
+}
+
+// shutdown asks the guest to power off and waits up to timeout for it to stop.
+func (s *VMService) shutdown(id int, timeout time.Duration) error {
 	// Check if VM is running first
 	status, err := s.vmRepo.GetStatus(id)
 	if err != nil {
@@ -60,60 +205,82 @@ func (s *VMService) ShutdownVM(id int) error {
 	// If VM is starting, wait for it to fully start before shutting down
 	if status == domain.VMStatusStarting {
 		fmt.Printf("VM %d is starting, waiting for it to fully start before shutdown...\n", id)
-		for i := 0; i < 120; i++ { // Wait up to 2 minutes for startup
-			time.Sleep(1 * time.Second)
-			currentStatus, err := s.vmRepo.GetStatus(id)
+		opts := domain.DefaultWaitOptions().WithTimeout(2 * time.Minute)
+		err := poll(opts, func() (bool, error) {
+			status, err = s.vmRepo.GetStatus(id)
 			if err != nil {
-				continue
-			}
-			if currentStatus == domain.VMStatusRunning {
-				fmt.Printf("VM %d is now running, proceeding with shutdown...\n", id)
-				break
-			}
-			if currentStatus == domain.VMStatusStopped {
-				fmt.Printf("VM %d stopped during startup phase\n", id)
-				return nil
-			}
-			if i == 119 { // Last iteration
-				return fmt.Errorf("timeout waiting for VM %d to fully start", id)
+				return false, err
 			}
+			return status == domain.VMStatusRunning || status == domain.VMStatusStopped, nil
+		})
+		if err != nil {
+			return fmt.Errorf("timeout waiting for VM %d to fully start: %w", id, err)
+		}
+		if status == domain.VMStatusStopped {
+			fmt.Printf("VM %d stopped during startup phase\n", id)
+			return nil
 		}
+		fmt.Printf("VM %d is now running, proceeding with shutdown...\n", id)
 	}
 
 	if err := s.vmRepo.Shutdown(id); err != nil {
 		return fmt.Errorf("failed to shutdown VM %d: %w", id, err)
 	}
 
-	// Wait for VM to actually shutdown (max 60 seconds)
+	// Wait for VM to actually shutdown
 	fmt.Printf("Waiting for VM %d to shutdown...\n", id)
-	for i := 0; i < 60; i++ {
-		time.Sleep(1 * time.Second)
-		currentStatus, err := s.vmRepo.GetStatus(id)
-		if err != nil {
-			// If we can't get status during shutdown, that might be normal
-			continue
-		}
-		if currentStatus == domain.VMStatusStopped {
-			fmt.Printf("VM %d shutdown successfully\n", id)
-			return nil
-		}
+	if err := s.WaitForStatus(id, domain.VMStatusStopped, domain.DefaultWaitOptions().WithTimeout(timeout)); err != nil {
+		return err
 	}
 
-	return fmt.Errorf("timeout waiting for VM %d to shutdown", id)
+	fmt.Printf("VM %d shutdown successfully\n", id)
+	return nil
 }
 
-func (s *VMService) DeleteVM(id int) error {
-	if err := s.vmRepo.Stop(id); err != nil {
-		return fmt.Errorf("failed to stop VM before deletion %d: %w", id, err)
+// DeleteVM takes a VM down and destroys it. VMs with Proxmox protection
+// enabled are refused before anything is stopped. A running VM is shut down
+// gracefully first when requested, and forced off if it is still running.
+func (s *VMService) DeleteVM(id int, opts domain.DeleteOptions) error {
+	vm, err := s.vmRepo.GetByID(id)
+	if err != nil {
+		return fmt.Errorf("failed to get VM %d: %w", id, err)
+	}
+	if vm.Protected {
+		return domain.Errorf(domain.ErrorKindConflict, "VM %s is protected; disable protection in Proxmox before deleting it", vm.Label())
+	}
+
+	// Stopping an already stopped VM fails on some PVE versions. A hibernated
+	// VM has no running process either.
+	if vm.Status != domain.VMStatusStopped && vm.Status != domain.VMStatusSuspended {
+		if err := s.powerOff(id, opts); err != nil {
+			return fmt.Errorf("failed to stop VM before deletion %d: %w", id, err)
+		}
 	}
 
-	if err := s.vmRepo.Delete(id); err != nil {
+	if err := s.vmRepo.Delete(id, opts.Purge); err != nil {
 		return fmt.Errorf("failed to delete VM %d: %w", id, err)
 	}
 
 	return nil
 }
 
+// powerOff stops a running VM, trying a graceful shutdown first when requested.
+func (s *VMService) powerOff(id int, opts domain.DeleteOptions) error {
+	if opts.Graceful {
+		timeout := opts.ShutdownTimeout
+		if timeout <= 0 {
+			timeout = domain.DefaultDeleteOptions().ShutdownTimeout
+		}
+		err := s.shutdown(id, timeout)
+		if err == nil {
+			return nil
+		}
+		fmt.Printf("Graceful shutdown of VM %d failed (%v), forcing stop\n", id, err)
+	}
+
+	return s.vmRepo.Stop(id)
+}
+
 func (s *VMService) GetVM(id int) (*domain.VM, error) {
 	vm, err := s.vmRepo.GetByID(id)
 	if err != nil {
@@ -122,6 +289,192 @@ func (s *VMService) GetVM(id int) (*domain.VM, error) {
 	return vm, nil
 }
 
+func (s *VMService) WaitForStatus(id int, status domain.VMStatus, opts domain.WaitOptions) error {
+	err := poll(opts, func() (bool, error) {
+		current, err := s.vmRepo.GetStatus(id)
+		if err != nil {
+			// Status may be unavailable while the VM is transitioning
+			return false, err
+		}
+		return current == status, nil
+	})
+	if err != nil {
+		return fmt.Errorf("timeout waiting for VM %d to be %s: %w", id, status, err)
+	}
+	return nil
+}
+
+func (s *VMService) WaitForAgent(id int, opts domain.WaitOptions) error {
+	err := poll(opts, func() (bool, error) {
+		if err := s.vmRepo.PingAgent(id); err != nil {
+			return false, err
+		}
+		return true, nil
+	})
+	if err != nil {
+		return fmt.Errorf("timeout waiting for guest agent of VM %d: %w", id, err)
+	}
+	return nil
+}
+
+func (s *VMService) WaitForIP(id int, opts domain.WaitOptions) (string, error) {
+	var ip string
+	err := poll(opts, func() (bool, error) {
+		var err error
+		ip, err = s.vmRepo.GetVMIP(id)
+		if err != nil {
+			return false, err
+		}
+		return ip != "", nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("timeout waiting for IP of VM %d: %w", id, err)
+	}
+	return ip, nil
+}
+
+func (s *VMService) WaitForSSH(id int, opts domain.WaitOptions) error {
+	err := poll(opts, func() (bool, error) {
+		if err := s.sshRepo.CheckConnection(id); err != nil {
+			return false, err
+		}
+		return true, nil
+	})
+	if err != nil {
+		return fmt.Errorf("timeout waiting for SSH on VM %d: %w", id, err)
+	}
+	return nil
+}
+
+// poll calls check until it reports done or the timeout expires, sleeping with
+// exponential backoff between attempts. Errors from check are treated as
+// "not ready yet" and the last one is reported on timeout.
+func poll(opts domain.WaitOptions, check func() (bool, error)) error {
+	deadline := time.Now().Add(opts.Timeout)
+	interval := opts.Interval
+	if interval <= 0 {
+		interval = time.Second
+	}
+
+	var lastErr error
+	for {
+		done, err := check()
+		if err == nil && done {
+			return nil
+		}
+		if err != nil {
+			lastErr = err
+		}
+
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			if lastErr != nil {
+				return domain.Errorf(domain.ErrorKindTimeout, "gave up after %s: %w", opts.Timeout, lastErr)
+			}
+			return domain.Errorf(domain.ErrorKindTimeout, "gave up after %s", opts.Timeout)
+		}
+
+		if interval > remaining {
+			interval = remaining
+		}
+		time.Sleep(interval)
+		interval = opts.NextInterval(interval)
+	}
+}
+
+// ResolveVMs returns the VMs designated by selectors (VMID, VMID range, exact
+// name, glob or tag:name), without duplicates and sorted by ID. A glob or tag
+// matching several VMs is refused unless all is set; with all and no selector,
+// every VM is returned. Numeric selectors are not checked against the VM list,
+// so they keep working for VMs the repository cannot list.
+func (s *VMService) ResolveVMs(selectors []string, all bool) ([]*domain.VM, error) {
+	if len(selectors) == 0 {
+		if !all {
+			return nil, domain.Errorf(domain.ErrorKindValidation, "no VM selected; give a VMID, range, name, pattern or tag:name, or --all for every VM")
+		}
+		listed, err := s.ListVMs()
+		if err != nil {
+			return nil, err
+		}
+		var vms []*domain.VM
+		for _, vm := range listed {
+			if !vm.IsTemplate {
+				vms = append(vms, vm)
+			}
+		}
+		sort.Slice(vms, func(i, j int) bool { return vms[i].ID < vms[j].ID })
+		return vms, nil
+	}
+
+	var listed []*domain.VM
+	seen := make(map[int]bool)
+	var resolved []*domain.VM
+	for _, raw := range selectors {
+		selector, err := domain.ParseVMSelector(raw)
+		if err != nil {
+			return nil, err
+		}
+
+		if selector.ID != 0 {
+			if !seen[selector.ID] {
+				seen[selector.ID] = true
+				resolved = append(resolved, domain.NewVM("", selector.ID))
+			}
+			continue
+		}
+
+		if listed == nil {
+			if listed, err = s.ListVMs(); err != nil {
+				return nil, err
+			}
+		}
+		matched, err := matchVMs(listed, selector, all)
+		if err != nil {
+			return nil, err
+		}
+		for _, vm := range matched {
+			if !seen[vm.ID] {
+				seen[vm.ID] = true
+				resolved = append(resolved, vm)
+			}
+		}
+	}
+
+	sort.Slice(resolved, func(i, j int) bool { return resolved[i].ID < resolved[j].ID })
+	return resolved, nil
+}
+
+// matchVMs returns the VMs matched by a non-numeric selector. Ranges select
+// several VMs explicitly; other selectors need all to do so. Templates are
+// only matched by their exact name, so that --all, patterns, tags and ranges
+// never act on the templates VMs are cloned from.
+func matchVMs(vms []*domain.VM, selector domain.VMSelector, all bool) ([]*domain.VM, error) {
+	var matched []*domain.VM
+	for _, vm := range vms {
+		if vm.IsTemplate && !selector.IsExact() {
+			continue
+		}
+		if selector.Matches(vm) {
+			matched = append(matched, vm)
+		}
+	}
+
+	if len(matched) == 0 {
+		return nil, domain.Errorf(domain.ErrorKindNotFound, "no VM matches '%s'", selector)
+	}
+	sort.Slice(matched, func(i, j int) bool { return matched[i].ID < matched[j].ID })
+
+	if len(matched) > 1 && !all && !selector.IsRange() {
+		labels := make([]string, len(matched))
+		for i, vm := range matched {
+			labels[i] = vm.Label()
+		}
+		return nil, domain.Errorf(domain.ErrorKindValidation, "'%s' matches %d VMs (%s); use --all to act on all of them", selector, len(matched), strings.Join(labels, ", "))
+	}
+
+	return matched, nil
+}
+
 func (s *VMService) ListVMs() ([]*domain.VM, error) {
 	vms, err := s.vmRepo.List()
 	if err != nil {
@@ -130,6 +483,22 @@ func (s *VMService) ListVMs() ([]*domain.VM, error) {
 	return vms, nil
 }
 
+func (s *VMService) GetVMIP(id int) (string, error) {
+	ip, err := s.vmRepo.GetVMIP(id)
+	if err != nil {
+		return "", fmt.Errorf("failed to get IP of VM %d: %w", id, err)
+	}
+	return ip, nil
+}
+
+func (s *VMService) GetVMInterfaces(id int) ([]domain.NetworkInterface, error) {
+	ifaces, err := s.vmRepo.GetNetworkInterfaces(id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get network interfaces of VM %d: %w", id, err)
+	}
+	return ifaces, nil
+}
+
 func (s *VMService) ExecuteScriptOnVM(vmid int, script *domain.Script) (*domain.Command, error) {
 	command, err := s.sshRepo.ExecuteScript(vmid, script.Path, script.Args, script.Timeout)
 	if err != nil {
@@ -138,10 +507,12 @@ func (s *VMService) ExecuteScriptOnVM(vmid int, script *domain.Script) (*domain.
 	return command, nil
 }
 
+// ExecuteCommandOnVM runs a command on a VM over SSH. The command is returned
+// with its output even when it failed, unless it could not be run at all.
 func (s *VMService) ExecuteCommandOnVM(vmid int, command string, args []string, timeout int) (*domain.Command, error) {
 	cmd, err := s.sshRepo.ExecuteCommand(vmid, command, args, timeout)
 	if err != nil {
-		return nil, fmt.Errorf("failed to execute command on VM %d: %w", vmid, err)
+		return cmd, fmt.Errorf("failed to execute command on VM %d: %w", vmid, err)
 	}
 	return cmd, nil
 }
@@ -152,3 +523,47 @@ func (s *VMService) CopySSHKey(vmid int) error {
 	}
 	return nil
 }
+
+func (s *VMService) InstallSSHKeys(vmid int, sshConfig domain.SSHConfig) (int, error) {
+	keys, err := s.resolveSSHKeys(sshConfig)
+	if err != nil {
+		return 0, err
+	}
+
+	installed, err := s.sshRepo.InstallAuthorizedKeys(vmid, sshConfig.User, keys)
+	if err != nil {
+		return 0, fmt.Errorf("failed to install SSH keys on VM %d: %w", vmid, err)
+	}
+	return installed, nil
+}
+
+// RemoveSSHKeys removes the configured authorized keys from the VM. Unlike
+// InstallSSHKeys, it never adds the local public keys, even with CopyLocalKey,
+// as removing them would lock their owner out.
+func (s *VMService) RemoveSSHKeys(vmid int, sshConfig domain.SSHConfig) (int, error) {
+	if len(sshConfig.AuthorizedKeys) == 0 {
+		return 0, domain.Errorf(domain.ErrorKindValidation, "no keys to remove from VM %d: give them with --key or in the ssh.authorized_keys of the VM", vmid)
+	}
+
+	removed, err := s.sshRepo.RemoveAuthorizedKeys(vmid, sshConfig.User, sshConfig.AuthorizedKeys)
+	if err != nil {
+		return 0, fmt.Errorf("failed to remove SSH keys from VM %d: %w", vmid, err)
+	}
+	return removed, nil
+}
+
+// resolveSSHKeys returns the configured authorized keys, adding the local public
+// keys when CopyLocalKey is set or when no key was configured at all.
+func (s *VMService) resolveSSHKeys(sshConfig domain.SSHConfig) ([]string, error) {
+	keys := append([]string{}, sshConfig.AuthorizedKeys...)
+
+	if sshConfig.CopyLocalKey || len(keys) == 0 {
+		localKeys, err := s.sshRepo.LocalPublicKeys()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read local SSH keys: %w", err)
+		}
+		keys = append(keys, localKeys...)
+	}
+
+	return keys, nil
+}
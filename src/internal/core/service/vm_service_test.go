@@ -0,0 +1,741 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"proxima/internal/core/domain"
+)
+
+type fakeVMRepository struct {
+	vms      map[int]*domain.VM
+	statuses []domain.VMStatus
+	ip       string
+	agentErr error
+	calls    []string
+}
+
+func newFakeVMRepository(vms ...*domain.VM) *fakeVMRepository {
+	repo := &fakeVMRepository{vms: make(map[int]*domain.VM)}
+	for _, vm := range vms {
+		repo.vms[vm.ID] = vm
+	}
+	return repo
+}
+
+func (r *fakeVMRepository) record(format string, args ...any) {
+	r.calls = append(r.calls, fmt.Sprintf(format, args...))
+}
+
+func (r *fakeVMRepository) Create(vm *domain.VM, progress domain.ProgressFunc) error {
+	r.record("create %d", vm.ID)
+	progress.Report(vm, domain.PhaseCloning)
+	r.vms[vm.ID] = vm
+	return nil
+}
+
+func (r *fakeVMRepository) GetByID(id int) (*domain.VM, error) {
+	vm, ok := r.vms[id]
+	if !ok {
+		return nil, domain.Errorf(domain.ErrorKindNotFound, "VM %d not found", id)
+	}
+	return vm, nil
+}
+
+func (r *fakeVMRepository) GetByName(name string) (*domain.VM, error) {
+	for _, vm := range r.vms {
+		if vm.Name == name {
+			return vm, nil
+		}
+	}
+	return nil, fmt.Errorf("VM with name %s not found", name)
+}
+
+func (r *fakeVMRepository) Update(vm *domain.VM) error {
+	r.record("update %d", vm.ID)
+	return nil
+}
+
+func (r *fakeVMRepository) Delete(id int, purge bool) error {
+	if purge {
+		r.record("purge %d", id)
+	} else {
+		r.record("delete %d", id)
+	}
+	delete(r.vms, id)
+	return nil
+}
+
+func (r *fakeVMRepository) List() ([]*domain.VM, error) {
+	var vms []*domain.VM
+	for _, vm := range r.vms {
+		vms = append(vms, vm)
+	}
+	return vms, nil
+}
+
+// NextID returns the lowest unused ID in the range, starting at 100.
+func (r *fakeVMRepository) NextID(idRange domain.VMIDRange) (int, error) {
+	min, max := 100, 999999999
+	if !idRange.IsZero() {
+		min, max = idRange.Min, idRange.Max
+	}
+	for id := min; id <= max; id++ {
+		if _, used := r.vms[id]; !used {
+			return id, nil
+		}
+	}
+	return 0, fmt.Errorf("no free VMID in range %d-%d", min, max)
+}
+
+func (r *fakeVMRepository) Start(id int) error {
+	r.record("start %d", id)
+	return nil
+}
+
+func (r *fakeVMRepository) Stop(id int) error {
+	r.record("stop %d", id)
+	return nil
+}
+
+func (r *fakeVMRepository) Shutdown(id int) error {
+	r.record("shutdown %d", id)
+	return nil
+}
+
+func (r *fakeVMRepository) Reboot(id int) error {
+	r.record("reboot %d", id)
+	return nil
+}
+
+func (r *fakeVMRepository) Reset(id int) error {
+	r.record("reset %d", id)
+	return nil
+}
+
+func (r *fakeVMRepository) Suspend(id int) error {
+	r.record("suspend %d", id)
+	return nil
+}
+
+func (r *fakeVMRepository) Resume(id int) error {
+	r.record("resume %d", id)
+	return nil
+}
+
+func (r *fakeVMRepository) Hibernate(id int) error {
+	r.record("hibernate %d", id)
+	return nil
+}
+
+// GetStatus returns the queued statuses one by one, repeating the last one.
+func (r *fakeVMRepository) GetStatus(id int) (domain.VMStatus, error) {
+	if len(r.statuses) == 0 {
+		return "", fmt.Errorf("no status for VM %d", id)
+	}
+	status := r.statuses[0]
+	if len(r.statuses) > 1 {
+		r.statuses = r.statuses[1:]
+	}
+	return status, nil
+}
+
+func (r *fakeVMRepository) GetVMIP(id int) (string, error) {
+	if r.ip == "" {
+		return "", fmt.Errorf("no IP for VM %d", id)
+	}
+	return r.ip, nil
+}
+
+func (r *fakeVMRepository) GetNetworkInterfaces(id int) ([]domain.NetworkInterface, error) {
+	if r.ip == "" {
+		return nil, fmt.Errorf("no interfaces for VM %d", id)
+	}
+	return []domain.NetworkInterface{{Name: "eth0", Addresses: []domain.IPAddress{domain.NewIPAddress(r.ip, 24)}, Source: "agent"}}, nil
+}
+
+func (r *fakeVMRepository) PingAgent(id int) error {
+	return r.agentErr
+}
+
+type fakeStateRepository map[string]int
+
+func (r fakeStateRepository) GetVMID(name string) (int, bool) {
+	id, ok := r[name]
+	return id, ok
+}
+
+func (r fakeStateRepository) SetVMID(name string, id int) error {
+	r[name] = id
+	return nil
+}
+
+type fakeSSHRepository struct {
+	connectErr error
+}
+
+func (r *fakeSSHRepository) ExecuteCommand(vmid int, command string, args []string, timeout int) (*domain.Command, error) {
+	return domain.NewCommand(vmid, command, args, timeout), nil
+}
+
+func (r *fakeSSHRepository) ExecuteScript(vmid int, scriptPath string, args []string, timeout int) (*domain.Command, error) {
+	return domain.NewCommand(vmid, scriptPath, args, timeout), nil
+}
+
+func (r *fakeSSHRepository) GetCommandHistory(vmid int) ([]*domain.Command, error) {
+	return nil, nil
+}
+
+func (r *fakeSSHRepository) CheckConnection(vmid int) error {
+	return r.connectErr
+}
+
+func (r *fakeSSHRepository) CopyLocalPublicKey(vmid int) error {
+	return nil
+}
+
+func (r *fakeSSHRepository) LocalPublicKeys() ([]string, error) {
+	return []string{"ssh-ed25519 AAAA local"}, nil
+}
+
+func (r *fakeSSHRepository) InstallAuthorizedKeys(vmid int, user string, keys []string) (int, error) {
+	return len(keys), nil
+}
+
+func (r *fakeSSHRepository) RemoveAuthorizedKeys(vmid int, user string, keys []string) (int, error) {
+	return len(keys), nil
+}
+
+func fastWait(timeout time.Duration) domain.WaitOptions {
+	return domain.WaitOptions{
+		Timeout:     timeout,
+		Interval:    time.Millisecond,
+		MaxInterval: 5 * time.Millisecond,
+		Backoff:     2,
+	}
+}
+
+func TestVMService_WaitForStatus(t *testing.T) {
+	repo := newFakeVMRepository()
+	repo.statuses = []domain.VMStatus{domain.VMStatusStarting, domain.VMStatusStarting, domain.VMStatusRunning}
+	svc := NewVMService(repo, &fakeSSHRepository{})
+
+	if err := svc.WaitForStatus(100, domain.VMStatusRunning, fastWait(time.Second)); err != nil {
+		t.Fatalf("Expected VM to reach running, got: %v", err)
+	}
+}
+
+func TestVMService_WaitForStatus_Timeout(t *testing.T) {
+	repo := newFakeVMRepository()
+	repo.statuses = []domain.VMStatus{domain.VMStatusRunning}
+	svc := NewVMService(repo, &fakeSSHRepository{})
+
+	err := svc.WaitForStatus(100, domain.VMStatusStopped, fastWait(20*time.Millisecond))
+	if !errors.Is(err, domain.ErrTimeout) {
+		t.Fatalf("Expected timeout error, got %v", err)
+	}
+}
+
+func TestVMService_WaitForSSH(t *testing.T) {
+	sshRepo := &fakeSSHRepository{connectErr: fmt.Errorf("connection refused")}
+	svc := NewVMService(newFakeVMRepository(), sshRepo)
+
+	err := svc.WaitForSSH(100, fastWait(20*time.Millisecond))
+	if err == nil {
+		t.Fatal("Expected timeout error, got nil")
+	}
+	if !strings.Contains(err.Error(), "connection refused") {
+		t.Errorf("Expected last error in message, got '%s'", err.Error())
+	}
+
+	sshRepo.connectErr = nil
+	if err := svc.WaitForSSH(100, fastWait(time.Second)); err != nil {
+		t.Errorf("Expected SSH to be ready, got: %v", err)
+	}
+}
+
+func TestVMService_CreateVM_AllocatesVMID(t *testing.T) {
+	repo := newFakeVMRepository(domain.NewVM("existing", 200))
+	stateRepo := fakeStateRepository{}
+	svc := NewVMServiceWithState(repo, &fakeSSHRepository{}, stateRepo)
+
+	vm := domain.NewVM("web", 0)
+	vm.IDRange = domain.VMIDRange{Min: 200, Max: 299}
+
+	if err := svc.CreateVM(vm, nil); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if vm.ID != 201 {
+		t.Errorf("Expected VMID 201, got %d", vm.ID)
+	}
+	if stateRepo["web"] != 201 {
+		t.Errorf("Expected VMID 201 recorded in state, got %d", stateRepo["web"])
+	}
+
+	// A later run reuses the recorded ID
+	again := domain.NewVM("web", 0)
+	again.IDRange = vm.IDRange
+	if err := svc.AssignVMID(again); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if again.ID != 201 {
+		t.Errorf("Expected recorded VMID 201, got %d", again.ID)
+	}
+
+	// Fixed IDs are not recorded
+	fixed := domain.NewVM("db", 300)
+	if err := svc.CreateVM(fixed, nil); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, ok := stateRepo["db"]; ok {
+		t.Error("Expected fixed VMID not to be recorded in state")
+	}
+}
+
+func TestVMService_CreateVM_AssignedFirst(t *testing.T) {
+	stateRepo := fakeStateRepository{}
+	svc := NewVMServiceWithState(newFakeVMRepository(), &fakeSSHRepository{}, stateRepo)
+
+	// apply and create assign the VMIDs before creating the VMs
+	vm := domain.NewVM("web", 0)
+	if err := svc.AssignVMID(vm); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := svc.CreateVM(vm, nil); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if stateRepo["web"] != 100 {
+		t.Errorf("Expected VMID 100 recorded in state, got %d", stateRepo["web"])
+	}
+}
+
+// applyPlan runs apply the way the apply command does, in a new process each
+// time: PlanApply decides, then the planned VMs are created and deleted.
+func applyPlan(t *testing.T, repo *fakeVMRepository, stateRepo fakeStateRepository, group domain.VMGroup) *domain.Plan {
+	t.Helper()
+	svc := NewVMServiceWithState(repo, &fakeSSHRepository{}, stateRepo)
+	var vms []*domain.VM
+	for index := 1; index <= group.Count; index++ {
+		vms = append(vms, domain.NewVM(group.InstanceName(index), 0))
+	}
+	plan, err := svc.PlanApply(vms, []domain.VMGroup{group})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for _, vm := range plan.VMs(domain.PlanActionCreate) {
+		if err := svc.CreateVM(vm, nil); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	for _, vm := range plan.VMs(domain.PlanActionDelete) {
+		if err := repo.Delete(vm.ID, true); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	return plan
+}
+
+func TestVMService_ApplyTwice(t *testing.T) {
+	repo := newFakeVMRepository()
+	stateRepo := fakeStateRepository{}
+	group := domain.NewVMGroup("web-{{index}}", 2)
+
+	applyPlan(t, repo, stateRepo, group)
+	if want := []string{"create 100", "create 101"}; !reflect.DeepEqual(repo.calls, want) {
+		t.Fatalf("Expected calls %v, got %v", want, repo.calls)
+	}
+	repo.calls = nil
+	plan := applyPlan(t, repo, stateRepo, group)
+	if len(repo.calls) != 0 {
+		t.Errorf("Expected the second apply to create nothing, got %v", repo.calls)
+	}
+	if kept := plan.VMs(domain.PlanActionKeep); len(kept) != 2 {
+		t.Errorf("Expected both instances kept, got %v", plan.Steps)
+	}
+}
+
+func TestVMService_PlanApply_ScaleDown(t *testing.T) {
+	repo := newFakeVMRepository()
+	stateRepo := fakeStateRepository{}
+	applyPlan(t, repo, stateRepo, domain.NewVMGroup("web-{{index}}", 3))
+
+	// web-04 was created by hand and is not an instance of the group
+	repo.vms[150] = domain.NewVM("web-04", 150)
+	repo.calls = nil
+	applyPlan(t, repo, stateRepo, domain.NewVMGroup("web-{{index}}", 2))
+	if want := []string{"purge 102"}; !reflect.DeepEqual(repo.calls, want) {
+		t.Errorf("Expected calls %v, got %v", want, repo.calls)
+	}
+}
+
+func TestVMService_PlanApply_ExistingName(t *testing.T) {
+	// web was created from another checkout; this one has no state file
+	repo := newFakeVMRepository(domain.NewVM("web", 120), domain.NewVM("db", 130))
+	stateRepo := fakeStateRepository{}
+	svc := NewVMServiceWithState(repo, &fakeSSHRepository{}, stateRepo)
+
+	web, db := domain.NewVM("web", 0), domain.NewVM("db", 140)
+	plan, err := svc.PlanApply([]*domain.VM{web, db}, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if kept := plan.VMs(domain.PlanActionKeep); len(kept) != 1 || kept[0] != web || web.ID != 120 {
+		t.Errorf("Expected web kept with VMID 120, got %+v", plan.Steps)
+	}
+	if stateRepo["web"] != 120 {
+		t.Errorf("Expected VMID 120 recorded for web, got %d", stateRepo["web"])
+	}
+	// A fixed VMID is never replaced by that of a VM with the same name
+	if created := plan.VMs(domain.PlanActionCreate); len(created) != 1 || created[0] != db || db.ID != 140 {
+		t.Errorf("Expected db created with VMID 140, got %+v", plan.Steps)
+	}
+}
+
+func TestVMService_PlanApply_AmbiguousName(t *testing.T) {
+	repo := newFakeVMRepository(domain.NewVM("web", 120), domain.NewVM("web", 121))
+	svc := NewVMServiceWithState(repo, &fakeSSHRepository{}, fakeStateRepository{})
+
+	if _, err := svc.PlanApply([]*domain.VM{domain.NewVM("web", 0)}, nil); !errors.Is(err, domain.ErrConflict) {
+		t.Errorf("Expected a conflict for two VMs named web, got %v", err)
+	}
+}
+
+func TestVMService_CreateVM_Progress(t *testing.T) {
+	repo := newFakeVMRepository()
+	svc := NewVMService(repo, &fakeSSHRepository{})
+
+	vm := domain.NewVM("web", 100)
+	vm.AutoStart = true
+
+	var phases []domain.CreatePhase
+	err := svc.CreateVM(vm, func(vm *domain.VM, phase domain.CreatePhase) {
+		phases = append(phases, phase)
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	want := []domain.CreatePhase{domain.PhaseCloning, domain.PhaseStarting}
+	if !reflect.DeepEqual(phases, want) {
+		t.Errorf("Expected phases %v, got %v", want, phases)
+	}
+	if want := []string{"create 100", "start 100"}; !reflect.DeepEqual(repo.calls, want) {
+		t.Errorf("Expected calls %v, got %v", want, repo.calls)
+	}
+}
+
+func TestVMService_AssignVMID_RecordedIDTaken(t *testing.T) {
+	repo := newFakeVMRepository(domain.NewVM("other", 100))
+	svc := NewVMServiceWithState(repo, &fakeSSHRepository{}, fakeStateRepository{"web": 100})
+
+	vm := domain.NewVM("web", 0)
+	if err := svc.AssignVMID(vm); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if vm.ID != 101 {
+		t.Errorf("Expected a fresh VMID 101, got %d", vm.ID)
+	}
+}
+
+func TestVMService_AssignVMID_Reserved(t *testing.T) {
+	svc := NewVMService(newFakeVMRepository(domain.NewVM("other", 100)), &fakeSSHRepository{})
+
+	// Neither VM exists yet, so the repository offers 101 both times
+	web, db := domain.NewVM("web", 0), domain.NewVM("db", 0)
+	if err := svc.AssignVMID(web); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := svc.AssignVMID(db); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if web.ID != 101 || db.ID != 102 {
+		t.Errorf("Expected VMIDs 101 and 102, got %d and %d", web.ID, db.ID)
+	}
+
+	full := domain.NewVM("cache", 0)
+	full.IDRange = domain.VMIDRange{Min: 101, Max: 102}
+	if err := svc.AssignVMID(full); !errors.Is(err, domain.ErrConflict) {
+		t.Errorf("Expected conflict once the range is reserved, got %v", err)
+	}
+}
+
+func TestVMService_ResolveVMs(t *testing.T) {
+	web1 := domain.NewVM("web-01", 101)
+	web1.Tags = []string{"frontend"}
+	web2 := domain.NewVM("web-02", 102)
+	web2.Tags = []string{"frontend"}
+	db := domain.NewVM("db", 200)
+	svc := NewVMService(newFakeVMRepository(web1, web2, db), &fakeSSHRepository{})
+
+	vms, err := svc.ResolveVMs([]string{"db"}, false)
+	if err != nil || len(vms) != 1 || vms[0].ID != 200 {
+		t.Errorf("Expected db (200), got %v, %v", vms, err)
+	}
+
+	if _, err := svc.ResolveVMs([]string{"web-*"}, false); !errors.Is(err, domain.ErrValidation) || !strings.Contains(err.Error(), "--all") {
+		t.Errorf("Expected ambiguity error mentioning --all, got %v", err)
+	}
+
+	vms, err = svc.ResolveVMs([]string{"tag:frontend"}, true)
+	if err != nil || len(vms) != 2 || vms[0].ID != 101 || vms[1].ID != 102 {
+		t.Errorf("Expected web-01 and web-02 sorted by ID, got %v, %v", vms, err)
+	}
+
+	if _, err := svc.ResolveVMs([]string{"cache"}, false); !errors.Is(err, domain.ErrNotFound) {
+		t.Errorf("Expected not found error, got %v", err)
+	}
+
+	// Numeric selectors resolve without listing
+	vms, err = svc.ResolveVMs([]string{"999"}, false)
+	if err != nil || len(vms) != 1 || vms[0].ID != 999 {
+		t.Errorf("Expected VM 999, got %v, %v", vms, err)
+	}
+
+	// Several selectors are merged without duplicates; ranges need no --all
+	vms, err = svc.ResolveVMs([]string{"db", "101-150", "web-01"}, false)
+	if err != nil || len(vms) != 3 || vms[0].ID != 101 || vms[1].ID != 102 || vms[2].ID != 200 {
+		t.Errorf("Expected VMs 101, 102 and 200, got %v, %v", vms, err)
+	}
+
+	if vms, err = svc.ResolveVMs(nil, true); err != nil || len(vms) != 3 {
+		t.Errorf("Expected every VM with --all and no selector, got %v, %v", vms, err)
+	}
+	if _, err := svc.ResolveVMs(nil, false); !errors.Is(err, domain.ErrValidation) {
+		t.Errorf("Expected validation error without selector, got %v", err)
+	}
+}
+
+func TestVMService_ResolveVMs_Templates(t *testing.T) {
+	web := domain.NewVM("web-01", 101)
+	web.Tags = []string{"ubuntu"}
+	template := domain.NewVM("web-template", 9000)
+	template.IsTemplate = true
+	template.Tags = []string{"ubuntu"}
+	svc := NewVMService(newFakeVMRepository(web, template), &fakeSSHRepository{})
+
+	for _, selectors := range [][]string{nil, {"web-*"}, {"tag:ubuntu"}, {"100-9999"}} {
+		vms, err := svc.ResolveVMs(selectors, true)
+		if err != nil || len(vms) != 1 || vms[0].ID != 101 {
+			t.Errorf("Expected %v to select web-01 only, got %v, %v", selectors, vms, err)
+		}
+	}
+
+	// Templates are selected by their exact name or VMID
+	for _, selector := range []string{"web-template", "9000"} {
+		vms, err := svc.ResolveVMs([]string{selector}, false)
+		if err != nil || len(vms) != 1 || vms[0].ID != 9000 {
+			t.Errorf("Expected %s to select the template, got %v, %v", selector, vms, err)
+		}
+	}
+}
+
+func TestVMService_RunParallel(t *testing.T) {
+	svc := NewVMService(newFakeVMRepository(), &fakeSSHRepository{})
+
+	var vms []*domain.VM
+	for id := 100; id < 110; id++ {
+		vms = append(vms, domain.NewVM("", id))
+	}
+
+	var mu sync.Mutex
+	running, peak := 0, 0
+	results := svc.RunParallel(vms, "start", 3, func(vm *domain.VM) error {
+		mu.Lock()
+		running++
+		if running > peak {
+			peak = running
+		}
+		mu.Unlock()
+
+		time.Sleep(5 * time.Millisecond)
+
+		mu.Lock()
+		running--
+		mu.Unlock()
+		if vm.ID == 105 {
+			return domain.Errorf(domain.ErrorKindConflict, "VM 105 is locked")
+		}
+		return nil
+	})
+
+	if peak > 3 {
+		t.Errorf("Expected at most 3 VMs at a time, got %d", peak)
+	}
+	if len(results) != len(vms) {
+		t.Fatalf("Expected %d results, got %d", len(vms), len(results))
+	}
+	for i, result := range results {
+		if result.VMID != vms[i].ID {
+			t.Errorf("Expected result %d for VM %d, got VM %d", i, vms[i].ID, result.VMID)
+		}
+		expected := domain.TaskStatusOK
+		if result.VMID == 105 {
+			expected = domain.TaskStatusFailed
+		}
+		if result.Status != expected {
+			t.Errorf("Expected VM %d to be %s, got %s", result.VMID, expected, result.Status)
+		}
+	}
+	if !errors.Is(results[5].Err, domain.ErrConflict) {
+		t.Errorf("Expected the error of VM 105 to be kept, got %v", results[5].Err)
+	}
+}
+
+func TestVMService_DeleteVM_Protected(t *testing.T) {
+	vm := domain.NewVM("db", 200)
+	vm.Protected = true
+	repo := newFakeVMRepository(vm, domain.NewVM("scratch", 201))
+	svc := NewVMService(repo, &fakeSSHRepository{})
+
+	opts := domain.DeleteOptions{}
+	if err := svc.DeleteVM(200, opts); !errors.Is(err, domain.ErrConflict) {
+		t.Errorf("Expected conflict error for protected VM, got %v", err)
+	}
+	if len(repo.calls) != 0 {
+		t.Errorf("Expected protected VM to be left untouched, got calls %v", repo.calls)
+	}
+
+	// A stopped VM is deleted without being stopped again
+	if err := svc.DeleteVM(201, opts); err != nil {
+		t.Fatalf("Expected VM 201 to be deleted, got: %v", err)
+	}
+	if strings.Join(repo.calls, ",") != "delete 201" {
+		t.Errorf("Expected delete only, got %v", repo.calls)
+	}
+
+	if err := svc.DeleteVM(999, opts); !errors.Is(err, domain.ErrNotFound) {
+		t.Errorf("Expected not found error, got %v", err)
+	}
+}
+
+func TestVMService_DeleteVM_Running(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     domain.DeleteOptions
+		statuses []domain.VMStatus
+		expected string
+	}{
+		{
+			name:     "forced stop",
+			opts:     domain.DeleteOptions{},
+			expected: "stop 100,delete 100",
+		},
+		{
+			name:     "graceful shutdown with purge",
+			opts:     domain.DeleteOptions{Graceful: true, ShutdownTimeout: time.Second, Purge: true},
+			statuses: []domain.VMStatus{domain.VMStatusRunning, domain.VMStatusStopped},
+			expected: "shutdown 100,purge 100",
+		},
+		{
+			name:     "graceful shutdown timing out",
+			opts:     domain.DeleteOptions{Graceful: true, ShutdownTimeout: 10 * time.Millisecond},
+			statuses: []domain.VMStatus{domain.VMStatusRunning},
+			expected: "shutdown 100,stop 100,delete 100",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vm := domain.NewVM("web", 100)
+			vm.Status = domain.VMStatusRunning
+			repo := newFakeVMRepository(vm)
+			repo.statuses = tt.statuses
+			svc := NewVMService(repo, &fakeSSHRepository{})
+
+			if err := svc.DeleteVM(100, tt.opts); err != nil {
+				t.Fatalf("Expected VM 100 to be deleted, got: %v", err)
+			}
+			if got := strings.Join(repo.calls, ","); got != tt.expected {
+				t.Errorf("Expected calls %s, got %s", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestVMService_ResumeVM(t *testing.T) {
+	tests := []struct {
+		status   domain.VMStatus
+		expected string
+		wantErr  error
+	}{
+		{status: domain.VMStatusPaused, expected: "resume 100"},
+		{status: domain.VMStatusSuspended, expected: "start 100"},
+		{status: domain.VMStatusRunning, wantErr: domain.ErrConflict},
+	}
+
+	for _, tt := range tests {
+		repo := newFakeVMRepository(domain.NewVM("web", 100))
+		repo.statuses = []domain.VMStatus{tt.status}
+		svc := NewVMService(repo, &fakeSSHRepository{})
+
+		err := svc.ResumeVM(100)
+		if tt.wantErr != nil {
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Expected %v resuming a %s VM, got %v", tt.wantErr, tt.status, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Expected %s VM to be resumed, got: %v", tt.status, err)
+		}
+		if got := strings.Join(repo.calls, ","); got != tt.expected {
+			t.Errorf("Expected %s for a %s VM, got %s", tt.expected, tt.status, got)
+		}
+	}
+}
+
+func TestVMService_InstallSSHKeys(t *testing.T) {
+	svc := NewVMService(newFakeVMRepository(), &fakeSSHRepository{})
+
+	// No keys configured: local keys are used
+	installed, err := svc.InstallSSHKeys(100, domain.SSHConfig{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if installed != 1 {
+		t.Errorf("Expected 1 local key, got %d", installed)
+	}
+
+	// Configured keys plus CopyLocalKey
+	installed, err = svc.InstallSSHKeys(100, domain.SSHConfig{
+		AuthorizedKeys: []string{"ssh-ed25519 AAAA configured"},
+		CopyLocalKey:   true,
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if installed != 2 {
+		t.Errorf("Expected 2 keys, got %d", installed)
+	}
+}
+
+func TestVMService_RemoveSSHKeys(t *testing.T) {
+	svc := NewVMService(newFakeVMRepository(), &fakeSSHRepository{})
+
+	// Without keys, the local keys must not be removed by default
+	if _, err := svc.RemoveSSHKeys(100, domain.SSHConfig{}); !errors.Is(err, domain.ErrValidation) {
+		t.Errorf("Expected a validation error without keys, got %v", err)
+	}
+
+	removed, err := svc.RemoveSSHKeys(100, domain.SSHConfig{AuthorizedKeys: []string{"ssh-ed25519 AAAA old"}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if removed != 1 {
+		t.Errorf("Expected only the given key removed, got %d", removed)
+	}
+
+	// copy_local_key adds the local keys on install, never on removal
+	removed, err = svc.RemoveSSHKeys(100, domain.SSHConfig{AuthorizedKeys: []string{"ssh-ed25519 AAAA old"}, CopyLocalKey: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if removed != 1 {
+		t.Errorf("Expected only the given key removed with copy_local_key, got %d", removed)
+	}
+}